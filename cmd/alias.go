@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sarkartanmay393/ah/pkg/manager"
+	"github.com/spf13/cobra"
+)
+
+var aliasCmd = &cobra.Command{
+	Use:   "alias",
+	Short: "Enable or disable single aliases of an installed package",
+	Long: `Turn off the definitions of a package you don't want while keeping the rest.
+Definitions are named package/name: an alias, function or executable, or
+package/$NAME for an env variable. 'ah list --aliases' shows their status.`,
+}
+
+var aliasDisableCmd = &cobra.Command{
+	Use:   "disable <package/alias>...",
+	Short: "Stop compiling an alias of a package",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		toggleAliases(args, manager.DisableDefinition, "disabled")
+	},
+}
+
+var aliasEnableCmd = &cobra.Command{
+	Use:   "enable <package/alias>...",
+	Short: "Compile a disabled alias again",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		toggleAliases(args, manager.EnableDefinition, "enabled")
+	},
+}
+
+func toggleAliases(args []string, toggle func(pkg, name string) error, done string) {
+	for _, arg := range args {
+		pkg, name, ok := strings.Cut(arg, "/")
+		if !ok || pkg == "" || name == "" {
+			fmt.Printf("Error: %q is not of the form package/alias\n", arg)
+			continue
+		}
+		if err := toggle(pkg, name); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			continue
+		}
+		fmt.Printf("%s/%s %s.\n", pkg, name, done)
+	}
+}
+
+func init() {
+	aliasCmd.AddCommand(aliasDisableCmd, aliasEnableCmd)
+	rootCmd.AddCommand(aliasCmd)
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/sarkartanmay393/ah/pkg/manager"
+	"github.com/spf13/cobra"
+)
+
+var applyDryRun bool
+
+var applyCmd = &cobra.Command{
+	Use:   "apply [file]",
+	Short: "Converge installed packages to an Ahfile",
+	Long: `Reads an Ahfile (default: ./Ahfile) listing packages, pinned versions, disabled
+definitions and conflict choices, and installs, switches, enables and disables
+packages until ~/.ah matches it exactly. Nothing is asked interactively.
+
+Example Ahfile:
+
+  packages:
+    - name: git-tools
+      version: 1.2.0
+      disabled: [gp]
+    - name: kube
+  conflicts:
+    gs: git-tools`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := "Ahfile"
+		if len(args) == 1 {
+			path = args[0]
+		}
+
+		f, err := manager.LoadAhfile(path)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+
+		plan, err := manager.Apply(f, applyDryRun)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if len(plan) == 0 {
+			fmt.Println("Already up to date.")
+			return
+		}
+
+		if applyDryRun {
+			fmt.Println("Plan (dry run, nothing changed):")
+		} else {
+			fmt.Println("Applied:")
+		}
+		for _, a := range plan {
+			fmt.Printf("  %s\n", a)
+		}
+	},
+}
+
+func init() {
+	applyCmd.Flags().BoolVar(&applyDryRun, "dry-run", false, "Show the plan without changing anything")
+	rootCmd.AddCommand(applyCmd)
+}
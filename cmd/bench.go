@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/sarkartanmay393/ah/pkg/shell"
+	"github.com/spf13/cobra"
+)
+
+var benchShells string
+var benchIterations int
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measure the per-prompt overhead of the live update hook",
+	Long: `Runs the live update hook of each installed shell in a scratch directory and
+reports the average time it adds to every prompt, next to the stat-based hook
+used by earlier versions of ah.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var shells []*shell.Shell
+		if benchShells != "" {
+			var err error
+			shells, err = shell.Parse(benchShells)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+		} else {
+			for _, sh := range shell.All() {
+				if _, err := exec.LookPath(sh.Name); err == nil {
+					shells = append(shells, sh)
+				}
+			}
+		}
+		if len(shells) == 0 {
+			fmt.Println("No supported shells found in PATH.")
+			return
+		}
+
+		fmt.Printf("Per-prompt hook overhead (%d iterations):\n\n", benchIterations)
+		fmt.Printf("%-6s %-14s %s\n", "SHELL", "BEFORE (stat)", "AFTER (read)")
+		for _, sh := range shells {
+			res, err := sh.Benchmark(benchIterations)
+			if err != nil {
+				fmt.Printf("%-6s error: %v\n", sh.Name, err)
+				continue
+			}
+			fmt.Printf("%-6s %-14s %s\n", res.Shell, res.Legacy, res.Current)
+		}
+	},
+}
+
+func init() {
+	benchCmd.Flags().StringVar(&benchShells, "shell", "", "Comma-separated shells to benchmark (default: all installed)")
+	benchCmd.Flags().IntVarP(&benchIterations, "iterations", "n", 1000, "Number of hook calls to time")
+	rootCmd.AddCommand(benchCmd)
+}
@@ -4,9 +4,9 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-	"strings"
 
 	"github.com/sarkartanmay393/ah/pkg/manager"
+	"github.com/sarkartanmay393/ah/pkg/shell"
 	"github.com/spf13/cobra"
 )
 
@@ -51,28 +51,60 @@ var doctorCmd = &cobra.Command{
 			fmt.Println("[OK] env.sh exists.")
 		}
 
-		// Check 3: Dependencies
+		// Check 3: Dependencies (git is only needed for git registries)
+		needsGit := false
+		regs, _ := manager.LoadRegistries()
+		for _, r := range regs {
+			needsGit = needsGit || r.Type == manager.RegistryGit
+		}
 		if _, err := exec.LookPath("git"); err != nil {
-			fmt.Println("[FAIL] 'git' is not installed or not in PATH.")
+			if needsGit {
+				fmt.Println("[FAIL] 'git' is not installed or not in PATH.")
+			} else {
+				fmt.Println("[INFO] 'git' is not installed (not needed: all registries use http).")
+			}
 		} else {
 			fmt.Println("[OK] 'git' is installed.")
 		}
 
-		// Check 4: Shell configuration
+		// Check 4: Shell configuration (every supported shell)
 		home, _ := os.UserHomeDir()
-		shell := os.Getenv("SHELL")
-		var rcFile string
-		if strings.Contains(shell, "zsh") {
-			rcFile = home + "/.zshrc"
-		} else {
-			rcFile = home + "/.bashrc"
+		login := shell.Detect()
+		anyConfigured := false
+		for _, sh := range shell.All() {
+			if rcFile, ok := sh.Installed(home); ok {
+				fmt.Printf("[OK] %s configured in %s (hook: %s)\n", sh.Name, rcFile, sh.Hook)
+				anyConfigured = true
+				continue
+			}
+			if sh == login {
+				fmt.Printf("[WARN] %s (your login shell) is not configured. Run 'ah init --shell %s'.\n", sh.Name, sh.Name)
+			} else if _, err := exec.LookPath(sh.Name); err == nil {
+				fmt.Printf("[INFO] %s is installed but not configured. Run 'ah init --shell %s' to use ah there.\n", sh.Name, sh.Name)
+			}
 		}
-		content, _ := os.ReadFile(rcFile)
-		if strings.Contains(string(content), "AH_PATH") {
-			fmt.Printf("[OK] Shell configured in %s\n", rcFile)
-		} else {
+		if !anyConfigured {
 			fmt.Printf("[WARN] Shell not configured. Run 'ah init' to set up.\n")
 		}
+
+		// Check 5: Registry freshness
+		if manager.Offline() {
+			fmt.Println("[INFO] Offline mode: registries are not fetched.")
+		}
+		printRegistryStatus("[INFO] ")
+
+		// Check 6: Every enabled package matches its pin in ah.lock
+		problems, err := manager.VerifyLock()
+		if err != nil {
+			fmt.Printf("[FAIL] Could not read %s: %v\n", manager.LockFile, err)
+		} else if len(problems) == 0 {
+			fmt.Printf("[OK] All enabled packages match %s.\n", manager.LockFile)
+		} else {
+			for pkg, problem := range problems {
+				fmt.Printf("[WARN] %s: %s\n", pkg, problem)
+			}
+			fmt.Println("  -> Hint: Run 'ah upgrade <package>' to pin it again.")
+		}
 	},
 }
 
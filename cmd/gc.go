@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/sarkartanmay393/ah/pkg/manager"
+	"github.com/spf13/cobra"
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Delete stored package versions that are no longer installed",
+	Long: `Installed packages are copied to ~/.ah/packages/<name>/<version>. Old versions
+are removed automatically on upgrade and removal; gc cleans up anything left behind.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		removed, err := manager.GarbageCollect()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if len(removed) == 0 {
+			fmt.Println("Nothing to clean up.")
+			return
+		}
+		for _, v := range removed {
+			fmt.Printf("Removed %s\n", v)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gcCmd)
+}
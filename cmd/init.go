@@ -3,29 +3,35 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"path/filepath"
-	"strings"
 
 	"github.com/sarkartanmay393/ah/pkg/manager"
+	"github.com/sarkartanmay393/ah/pkg/shell"
 	"github.com/spf13/cobra"
 )
 
+var initShells string
+
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialize ah and setup shell configuration",
+	Long: `Creates ~/.ah and adds a snippet that loads ah to your shell's startup file.
+By default the shell from $SHELL is configured; use --shell to configure one or
+more shells explicitly (e.g. --shell zsh,bash,fish).`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := manager.EnsureDirs(); err != nil {
 			fmt.Printf("Error creating directories: %v\n", err)
 			return
 		}
 
-		root, _ := manager.GetRootDir()
-		configScript := fmt.Sprintf(`
-# >>> Alias Hub >>>
-export AH_PATH="%s"
-[ -f "$AH_PATH/env.sh" ] && source "$AH_PATH/env.sh"
-# <<< Alias Hub <<<
-`, root)
+		shells := []*shell.Shell{shell.Detect()}
+		if initShells != "" {
+			var err error
+			shells, err = shell.Parse(initShells)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+		}
 
 		// Auto-Install Logic
 		home, err := os.UserHomeDir()
@@ -33,42 +39,33 @@ export AH_PATH="%s"
 			fmt.Println("Error: Could not find home directory.")
 			return
 		}
+		root, _ := manager.GetRootDir()
 
-		shell := os.Getenv("SHELL")
-		var rcFile string
-		if strings.Contains(shell, "zsh") {
-			rcFile = filepath.Join(home, ".zshrc")
-		} else {
-			rcFile = filepath.Join(home, ".bashrc")
-		}
-
-		// Check if file exists, create if not
-		f, err := os.OpenFile(rcFile, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
-		if err != nil {
-			fmt.Printf("Error opening %s: %v\n", rcFile, err)
-			return
-		}
-		defer f.Close()
-
-		// Read file to check for existence
-		content, _ := os.ReadFile(rcFile)
-		if strings.Contains(string(content), "export AH_PATH=") {
-			fmt.Printf("✅ Alias Hub usage is already configured in %s\n", rcFile)
-			return
+		var configured []string
+		for _, sh := range shells {
+			rcFile, already, err := sh.Install(home, root)
+			if err != nil {
+				fmt.Printf("Error writing to %s: %v\n", rcFile, err)
+				continue
+			}
+			if already {
+				fmt.Printf("✅ Alias Hub usage is already configured in %s\n", rcFile)
+				continue
+			}
+			fmt.Printf("✅ Setup complete! Added configuration to %s\n", rcFile)
+			configured = append(configured, rcFile)
 		}
 
-		// Append
-		if _, err := f.WriteString(configScript); err != nil {
-			fmt.Printf("Error writing to %s: %v\n", rcFile, err)
-			return
+		if len(configured) > 0 {
+			fmt.Println("👉 Please restart your terminal or run:")
+			for _, rcFile := range configured {
+				fmt.Printf("   source %s\n", rcFile)
+			}
 		}
-
-		fmt.Printf("✅ Setup complete! Added configuration to %s\n", rcFile)
-		fmt.Println("👉 Please restart your terminal or run:")
-		fmt.Printf("   source %s\n", rcFile)
 	},
 }
 
 func init() {
+	initCmd.Flags().StringVar(&initShells, "shell", "", "Comma-separated shells to configure (zsh, bash, fish)")
 	rootCmd.AddCommand(initCmd)
 }
@@ -5,26 +5,62 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/sarkartanmay393/ah/pkg/manager"
-	"github.com/sarkartanmay393/ah/pkg/parser"
 	"github.com/sarkartanmay393/ah/pkg/server"
 	"github.com/spf13/cobra"
 )
 
 var installCmd = &cobra.Command{
-	Use:   "install [package]",
-	Short: "Install a package from the registry",
-	Args:  cobra.MinimumNArgs(1),
+	Use:   "install [package[@version]]",
+	Short: "Install a package from the registry, a local path, git URL or archive",
+	Long: `Installs packages by registry name ("git-tools", "corp/git-tools"), optionally
+with a version constraint ("git-tools@^2.1" installs the highest matching version),
+or from a source:
+
+  ah install ./my-pkg                              a local directory
+  ah install git+https://host/repo#subdir@ref      a git repository
+  ah install my-pkg.tar.gz                         an archive
+
+Packages installed from a source are fetched from it again by 'ah upgrade';
+packages installed with a constraint are upgraded within it.
+
+--rename gc=gcc compiles the package's alias gc as gcc, e.g. to avoid a conflict.`,
+	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
+		renameFlags, _ := cmd.Flags().GetStringSlice("rename")
+		renames := make(map[string]string)
+		for _, r := range renameFlags {
+			from, to, ok := strings.Cut(r, "=")
+			if !ok || from == "" || to == "" {
+				fmt.Printf("Error: --rename %q is not of the form alias=newname\n", r)
+				return
+			}
+			renames[from] = to
+		}
+		if len(renames) > 0 && len(args) > 1 {
+			fmt.Println("Error: --rename can only be used when installing one package")
+			return
+		}
+
 		for _, pkgName := range args {
 			fmt.Printf("\nInstalling %s...\n", pkgName)
-			if err := manager.InstallPackage(pkgName); err != nil {
+			if err := manager.InstallPackage(pkgName, renames); err != nil {
 				// Check if it's a conflict error
 				if conflictErr, ok := err.(*manager.ConflictError); ok {
 					fmt.Println("\n[!] CONFLICTS DETECTED")
 					fmt.Printf("Package '%s' has %d conflicting aliases.\n", pkgName, len(conflictErr.Conflicts))
+					fmt.Println("(Install it with --rename <alias>=<newname> to keep both.)")
+					if _, fromSource := manager.ParseSource(pkgName); fromSource {
+						// The web UI resolves registry packages only.
+						for name, owner := range conflictErr.Conflicts {
+							fmt.Printf("  %s (from %s)\n", name, owner)
+						}
+						fmt.Println("Installation aborted.")
+						continue
+					}
 					fmt.Print("Launch Web UI to resolve? [Y/n]: ")
 
 					reader := bufio.NewReader(os.Stdin)
@@ -42,14 +78,29 @@ var installCmd = &cobra.Command{
 						// 3. Compile (in case the server didn't, or to be safe)
 						manager.CompileAliases()
 
-						// 4. Show Status
-						targetDir, _ := manager.GetRegistryPackagePath(pkgName)
-						meta, _ := manager.LoadMetadata(targetDir)
-						aliasPath := filepath.Join(targetDir, "alias.sh")
-						aliases, _ := parser.ParseAliases(aliasPath)
+						// 4. Show Status (of the revision the UI pinned)
+						name, _, _ := strings.Cut(pkgName, "@")
+						if _, bare, ok := strings.Cut(name, "/"); ok {
+							name = bare
+						}
+						enabled, _ := manager.ListPackages()
+						if !slices.Contains(enabled, name) {
+							fmt.Printf("\n%s was not enabled: conflicts remain. Run 'ah resolve %s' to continue.\n", name, pkgName)
+							continue
+						}
+						root, _ := manager.GetRootDir()
+						meta, err := manager.LoadMetadata(filepath.Join(root, manager.ActiveDir, name))
+						if err != nil {
+							fmt.Printf("Error reading %s: %v\n", name, err)
+							continue
+						}
+						var names []string
+						if content, err := manager.LoadActiveContent(name); err == nil {
+							names = content.Names()
+						}
 
 						fmt.Printf("\n📦 Package: %s (%s)\n", meta.Name, meta.Version)
-						fmt.Printf("✅ Installation Complete! %d aliases available.\n", len(aliases))
+						fmt.Printf("✅ Installation Complete! %d aliases available.\n", len(names))
 						continue
 					}
 					fmt.Println("Installation aborted.")
@@ -64,5 +115,6 @@ var installCmd = &cobra.Command{
 }
 
 func init() {
+	installCmd.Flags().StringSlice("rename", nil, "Compile an alias of the package under another name (alias=newname, repeatable)")
 	rootCmd.AddCommand(installCmd)
 }
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sarkartanmay393/ah/pkg/manager"
+	"github.com/sarkartanmay393/ah/pkg/parser"
+	"github.com/spf13/cobra"
+)
+
+var lintCmd = &cobra.Command{
+	Use:   "lint [path]",
+	Short: "Check a package or alias file for problems",
+	Long: `Parses an alias.sh or functions.sh file (or a package directory containing them
+and ah.yaml) and reports every problem with its file, line and column. Use "-" to read from stdin.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := args[0]
+		var failed bool
+		var res *parser.ParseResult
+		var err error
+
+		if path == "-" {
+			res, err = parser.Parse(os.Stdin, "<stdin>")
+		} else {
+			res, err = lintPath(path, &failed)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		for _, d := range res.Diagnostics {
+			fmt.Println(d)
+		}
+		if res.HasErrors() {
+			failed = true
+		}
+
+		fmt.Printf("\n%d aliases, %d functions, %d problems\n", len(res.Aliases), len(res.Functions), len(res.Filter(parser.SeverityWarning)))
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// lintPath parses an alias file, functions file or package directory.
+// Metadata problems are printed directly and recorded in failed.
+func lintPath(path string, failed *bool) (*parser.ParseResult, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		if filepath.Base(path) == "functions.sh" {
+			return parser.ParseFunctionsFile(path)
+		}
+		return parser.ParseFile(path)
+	}
+
+	if _, err := manager.LoadMetadata(path); err != nil {
+		if os.IsNotExist(err) {
+			err = fmt.Errorf("file is missing")
+		}
+		fmt.Printf("%s: error: %v\n", filepath.Join(path, "ah.yaml"), err)
+		*failed = true
+	}
+
+	content, err := manager.LoadPackageContent(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s has neither alias.sh nor functions.sh", path)
+		}
+		return nil, err
+	}
+	return &parser.ParseResult{
+		Aliases:     content.Aliases,
+		Functions:   content.Functions,
+		Diagnostics: content.Diagnostics,
+	}, nil
+}
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+}
@@ -15,6 +15,11 @@ var listCmd = &cobra.Command{
 	Short: "List installed alias packages",
 	Run: func(cmd *cobra.Command, args []string) {
 		showAll, _ := cmd.Flags().GetBool("all")
+		showAliases, _ := cmd.Flags().GetBool("aliases")
+		if shadowed, _ := cmd.Flags().GetBool("shadowed"); shadowed {
+			printShadowed()
+			return
+		}
 
 		// 1. Get Active (Installed) Packages
 		activePkgs, err := manager.ListPackages()
@@ -28,14 +33,16 @@ var listCmd = &cobra.Command{
 			activeMap[p] = true
 		}
 
-		// 2. Get Registry (Available) Packages - ONLY if requested
-		var registryPkgs []string
+		// 2. Get Registry (Available) Packages from the indexes - ONLY if requested
+		registryDesc := make(map[string]string)
 		if showAll {
-			var err error
-			registryPkgs, err = manager.ListRegistryPackages()
+			registryPkgs, err := manager.AvailablePackages()
 			if err != nil {
 				// If registry fails (e.g. not cloned yet), just show active
-				registryPkgs = []string{}
+				registryPkgs = nil
+			}
+			for _, p := range registryPkgs {
+				registryDesc[p.Name] = p.Description
 			}
 		}
 
@@ -44,7 +51,7 @@ var listCmd = &cobra.Command{
 		for _, p := range activePkgs {
 			allMap[p] = true
 		}
-		for _, p := range registryPkgs {
+		for p := range registryDesc {
 			allMap[p] = true
 		}
 
@@ -76,36 +83,75 @@ var listCmd = &cobra.Command{
 				status = "[Enabled]"
 			}
 
-			// Try to get metadata from Registry info logic
-			// If enabled, it's in active. If not, it's in registry.
-			var metaPath string
+			// If enabled, read its metadata from active. If not, the
+			// registry index describes it.
+			desc := registryDesc[pkg]
 			if activeMap[pkg] {
-				metaPath = filepath.Join(root, manager.ActiveDir, pkg)
-			} else {
-				regPath, err := manager.GetRegistryPackagePath(pkg)
-				if err == nil {
-					metaPath = regPath
-				}
-			}
-
-			desc := ""
-			if metaPath != "" {
-				meta, err := manager.LoadMetadata(metaPath)
+				meta, err := manager.LoadMetadata(filepath.Join(root, manager.ActiveDir, pkg))
 				if err == nil {
 					desc = meta.Description
 				}
 			}
 
 			fmt.Printf("%-20s %-12s %s\n", pkg, status, desc)
+			if showAliases && activeMap[pkg] {
+				printDefinitions(pkg)
+			}
 		}
 	},
 }
 
+// printDefinitions lists a package's definitions below it, with their
+// status.
+func printDefinitions(pkg string) {
+	defs, err := manager.PackageDefinitions(pkg)
+	if err != nil {
+		fmt.Printf("  (failed to read definitions: %v)\n", err)
+		return
+	}
+	for _, d := range defs {
+		status := "on"
+		if d.Disabled {
+			status = "off"
+		}
+		value := d.Value
+		if len(value) > 40 {
+			value = value[:37] + "..."
+		}
+		name := d.Name
+		if d.RenamedTo != "" {
+			name += " -> " + d.RenamedTo
+		}
+		fmt.Printf("  %-18s %-4s %-10s %s\n", name, status, d.Kind, value)
+	}
+}
+
+// printShadowed lists the definitions hidden by another package's.
+func printShadowed() {
+	shadows, err := manager.ShadowedDefinitions()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if len(shadows) == 0 {
+		fmt.Println("No shadowed aliases.")
+		return
+	}
+	fmt.Printf("%-18s %-20s %s\n", "NAME", "PACKAGE", "SHADOWED BY")
+	fmt.Println(algoLine(60))
+	for _, s := range shadows {
+		fmt.Printf("%-18s %-20s %s\n", s.Name, s.Package, s.By)
+	}
+	fmt.Println("\nChange the winner with 'ah priority <package> <n>' (higher wins).")
+}
+
 func algoLine(n int) string {
 	return strings.Repeat("-", n)
 }
 
 func init() {
 	listCmd.Flags().BoolP("all", "a", false, "Show all available packages in registry")
+	listCmd.Flags().Bool("aliases", false, "Show the aliases of enabled packages and whether each is disabled")
+	listCmd.Flags().Bool("shadowed", false, "Show aliases of enabled packages hidden by another package's definition")
 	rootCmd.AddCommand(listCmd)
 }
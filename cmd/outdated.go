@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/sarkartanmay393/ah/pkg/manager"
+	"github.com/spf13/cobra"
+)
+
+var outdatedCmd = &cobra.Command{
+	Use:   "outdated",
+	Short: "List enabled packages that changed in the registry",
+	Long: `Compares every enabled package with its copy in the local registry and shows
+the version change and which aliases were added, removed or changed.
+Run 'ah update' first to fetch the latest registry.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		updates, err := manager.Outdated()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if len(updates) == 0 {
+			fmt.Println("All packages are up to date.")
+			return
+		}
+
+		for _, u := range updates {
+			fmt.Printf("📦 %s  %s -> %s\n", u.Name, u.InstalledVersion, u.AvailableVersion)
+			if len(u.Changes) == 0 {
+				fmt.Println("  (no definitions change)")
+			}
+			for _, c := range u.Changes {
+				fmt.Printf("  %s\n", c)
+			}
+		}
+		fmt.Printf("\n%d packages can be upgraded. Run 'ah upgrade' to apply.\n", len(updates))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(outdatedCmd)
+}
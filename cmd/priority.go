@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/sarkartanmay393/ah/pkg/manager"
+	"github.com/spf13/cobra"
+)
+
+var priorityCmd = &cobra.Command{
+	Use:   "priority [package <n>]",
+	Short: "Set which package wins when several define the same alias",
+	Long: `When enabled packages define the same name, only the definition of the
+package with the highest priority is compiled (default 0; ties go to the
+name that sorts first). Conflict choices take precedence over priorities.
+Without arguments, lists the priorities set. 'ah list --shadowed' shows
+the definitions that lose.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 && len(args) != 2 {
+			return fmt.Errorf("expected a package and a priority, got %d arguments", len(args))
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			priorities, err := manager.Priorities()
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			if len(priorities) == 0 {
+				fmt.Println("No priorities set; all packages have priority 0.")
+				return
+			}
+			for _, pkg := range slices.Sorted(maps.Keys(priorities)) {
+				fmt.Printf("%-20s %d\n", pkg, priorities[pkg])
+			}
+			return
+		}
+
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			fmt.Printf("Error: invalid priority %q: must be an integer\n", args[1])
+			os.Exit(1)
+		}
+		if err := manager.SetPriority(args[0], n); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Priority of %s set to %d.\n", args[0], n)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(priorityCmd)
+}
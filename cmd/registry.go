@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sarkartanmay393/ah/pkg/manager"
+	"github.com/spf13/cobra"
+)
+
+var registryCmd = &cobra.Command{
+	Use:   "registry",
+	Short: "Manage package registries",
+	Long: `ah can install from several registries. Bare package names resolve to the
+registry a package was installed from, then to the first registry (in the order
+shown by 'ah registry list') that has it. Use 'registry/package' to pick one.`,
+}
+
+var registryAddCmd = &cobra.Command{
+	Use:   "add <name> <url>",
+	Short: "Add a registry",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		subdir, _ := cmd.Flags().GetString("subdir")
+		regType, _ := cmd.Flags().GetString("type")
+		position, _ := cmd.Flags().GetInt("position")
+
+		if err := manager.EnsureDirs(); err != nil {
+			fmt.Printf("Error ensuring directories: %v\n", err)
+			return
+		}
+		if err := manager.AddRegistry(manager.Registry{Name: args[0], URL: args[1], Type: regType, Subdir: subdir}, position-1); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		// Reload to get the defaults filled in
+		regs, _ := manager.LoadRegistries()
+		var reg manager.Registry
+		for _, r := range regs {
+			if r.Name == args[0] {
+				reg = r
+			}
+		}
+		if err := manager.WithLock(reg.Update); err != nil {
+			fmt.Printf("Warning: Failed to clone %s (will retry on 'ah update'): %v\n", reg.Name, err)
+		}
+		fmt.Printf("Added registry %s. Install from it with 'ah install %s/<package>'.\n", reg.Name, reg.Name)
+	},
+}
+
+var registryRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a registry and its local clone",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := manager.RemoveRegistry(args[0]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Printf("Removed registry %s. Packages installed from it keep working but cannot be upgraded.\n", args[0])
+	},
+}
+
+var registryListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List registries in resolution order",
+	Run: func(cmd *cobra.Command, args []string) {
+		regs, err := manager.LoadRegistries()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Printf("%-3s %-15s %-5s %-10s %s\n", "#", "NAME", "TYPE", "STATUS", "URL")
+		fmt.Println(algoLine(60))
+		for i, r := range regs {
+			status := "cloned"
+			if _, err := os.Stat(r.Dir()); err != nil {
+				status = "missing"
+			}
+			url := r.URL
+			if r.Type == manager.RegistryGit && r.Subdir != "registry" {
+				url += " (" + r.Subdir + ")"
+			}
+			fmt.Printf("%-3d %-15s %-5s %-10s %s\n", i+1, r.Name, r.Type, status, url)
+		}
+	},
+}
+
+var registryOrderCmd = &cobra.Command{
+	Use:   "order <name>...",
+	Short: "Move registries to the front of the resolution order",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := manager.ReorderRegistries(args); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		registryListCmd.Run(cmd, nil)
+	},
+}
+
+var registryBuildIndexCmd = &cobra.Command{
+	Use:   "build-index [dir]",
+	Short: "Write index.json for a registry's package directory",
+	Long: `For registry maintainers: reads every package in dir (default: the current
+directory) and writes the index.json that search and list read. Commit it
+whenever packages change. With --tarballs, writes what an HTTP registry serves
+instead: index.json plus a verified tarball per package.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := "."
+		if len(args) == 1 {
+			dir = args[0]
+		}
+		outDir, _ := cmd.Flags().GetString("tarballs")
+		index, problems, err := manager.WriteIndex(dir, outDir)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		for name, problem := range problems {
+			fmt.Printf("Skipped %s: %s\n", name, problem)
+		}
+		if outDir == "" {
+			outDir = dir
+		}
+		fmt.Printf("Indexed %d packages in %s.\n", len(index.Packages), filepath.Join(outDir, manager.IndexFile))
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// printRegistryStatus prints when each registry was last fetched, and at
+// which commit, with lines prefixed by prefix.
+func printRegistryStatus(prefix string) {
+	regs, err := manager.LoadRegistries()
+	if err != nil {
+		fmt.Printf("%sError: %v\n", prefix, err)
+		return
+	}
+	ttl := manager.RegistryTTL()
+	for _, r := range regs {
+		status, ok := r.Status()
+		if !ok {
+			fmt.Printf("%sRegistry %s: never fetched\n", prefix, r.Name)
+			continue
+		}
+		age := time.Since(status.FetchedAt).Round(time.Second)
+		commit := status.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		stale := ""
+		if age >= ttl {
+			stale = " (stale)"
+		}
+		fmt.Printf("%sRegistry %s: fetched %s ago%s at %s\n", prefix, r.Name, age, stale, commit)
+	}
+}
+
+func init() {
+	registryAddCmd.Flags().String("type", manager.RegistryGit, "Transport: git, or http for an index.json and tarballs served over HTTP(S)")
+	registryAddCmd.Flags().String("subdir", "", "Directory inside a git repository that holds the packages (default \"registry\")")
+	registryAddCmd.Flags().Int("position", 0, "Position in the resolution order (1 is first; default last)")
+	registryBuildIndexCmd.Flags().String("tarballs", "", "Write index.json and package tarballs for an HTTP registry to this directory")
+	registryCmd.AddCommand(registryAddCmd, registryRemoveCmd, registryListCmd, registryOrderCmd, registryBuildIndexCmd)
+	rootCmd.AddCommand(registryCmd)
+}
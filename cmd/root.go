@@ -19,14 +19,30 @@ var rootCmd = &cobra.Command{
 It features conflict detection, live updates, and a public registry.`,
 	Version: version.Version,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if offline {
+			os.Setenv("AH_OFFLINE", "1")
+		}
+		if manager.Offline() {
+			return
+		}
 		// Background check for updates (non-blocking, with 24h debounce)
 		go checkForUpdates()
 	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		// On stderr, so output captured from ah (e.g. 'ah init') is not
+		// affected.
+		warnings, _ := manager.PinWarnings()
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+		}
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		cmd.Help()
 	},
 }
 
+var offline bool
+
 const updateCheckInterval = 24 * time.Hour
 
 func checkForUpdates() {
@@ -60,6 +76,10 @@ func checkForUpdates() {
 	}
 }
 
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&offline, "offline", false, "Do not access the network; use registries as last fetched (same as AH_OFFLINE=1)")
+}
+
 func Execute() error {
 	return rootCmd.Execute()
 }
@@ -4,10 +4,10 @@ import (
 	"bufio"
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/sarkartanmay393/ah/pkg/manager"
+	"github.com/sarkartanmay393/ah/pkg/shell"
 	"github.com/spf13/cobra"
 )
 
@@ -19,7 +19,7 @@ var uninstallCmd = &cobra.Command{
 		fmt.Println("  - All installed alias packages")
 		fmt.Println("  - The registry cache")
 		fmt.Println("  - The entire ~/.ah directory")
-		fmt.Println("  - Shell configuration lines in .zshrc/.bashrc")
+		fmt.Println("  - Shell configuration for zsh, bash and fish")
 		fmt.Println("")
 		fmt.Print("Are you sure? Type 'DELETE' to confirm: ")
 
@@ -62,56 +62,14 @@ func removeShellConfig() {
 		return
 	}
 
-	shell := os.Getenv("SHELL")
-	var rcFile string
-	if strings.Contains(shell, "zsh") {
-		rcFile = filepath.Join(home, ".zshrc")
-	} else {
-		rcFile = filepath.Join(home, ".bashrc")
-	}
-
-	content, err := os.ReadFile(rcFile)
-	if err != nil {
-		return
-	}
-
-	lines := strings.Split(string(content), "\n")
-	var newLines []string
-	inBlock := false
-
-	for _, line := range lines {
-		// Check for block start marker (new style)
-		if strings.Contains(line, "# >>> Alias Hub >>>") {
-			inBlock = true
-			continue
-		}
-		// Check for block end marker (new style)
-		if strings.Contains(line, "# <<< Alias Hub <<<") {
-			inBlock = false
-			continue
-		}
-		// Legacy support: old style marker
-		if strings.Contains(line, "# Alias Hub") && !inBlock {
-			// Start of legacy block - skip until we find a non-matching line
-			inBlock = true
-			continue
-		}
-		if inBlock {
-			// For legacy blocks, exit when we hit a line that's not part of our config
-			if !strings.Contains(line, "AH_PATH") && !strings.Contains(line, "env.sh") && strings.TrimSpace(line) != "" {
-				inBlock = false
-				newLines = append(newLines, line)
-			}
-			continue
-		}
-		newLines = append(newLines, line)
-	}
-
-	// Write back only if changes were made
-	if len(lines) != len(newLines) {
-		if err := os.WriteFile(rcFile, []byte(strings.Join(newLines, "\n")), 0644); err == nil {
+	for _, sh := range shell.All() {
+		cleaned, err := sh.Remove(home)
+		for _, rcFile := range cleaned {
 			fmt.Printf("Cleaned configuration from %s\n", rcFile)
 		}
+		if err != nil {
+			fmt.Printf("Warning: Failed to clean %s configuration: %v\n", sh.Name, err)
+		}
 	}
 }
 
@@ -10,7 +10,8 @@ import (
 var updateCmd = &cobra.Command{
 	Use:   "update",
 	Short: "Update the package registry and re-compile aliases",
-	Long:  `Downloads the latest package definitions from the registry and re-generates your alias configurations.`,
+	Long: `Downloads the latest package definitions from every registry (ignoring the
+freshness TTL) and re-generates your alias configurations.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := manager.EnsureDirs(); err != nil {
 			fmt.Printf("Error ensuring directories: %v\n", err)
@@ -20,7 +21,7 @@ var updateCmd = &cobra.Command{
 		// Use WithLock for thread-safe registry update and compile
 		if err := manager.WithLock(func() error {
 			fmt.Println("Updating registry...")
-			if err := manager.UpdateRegistry(); err != nil {
+			if err := manager.RefreshRegistry(); err != nil {
 				return fmt.Errorf("registry update failed: %w", err)
 			}
 
@@ -34,6 +35,7 @@ var updateCmd = &cobra.Command{
 			return
 		}
 
+		printRegistryStatus("")
 		fmt.Println("All set! Registry and aliases updated.")
 	},
 }
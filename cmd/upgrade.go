@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/sarkartanmay393/ah/pkg/manager"
+	"github.com/spf13/cobra"
+)
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade [package...]",
+	Short: "Switch enabled packages to their latest registry content",
+	Long: `Upgrades the given packages, or every outdated package if none are given.
+Each upgrade is checked for conflicts and shows the alias diff for confirmation.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		pkgs := args
+		if len(pkgs) == 0 {
+			updates, err := manager.Outdated()
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			if len(updates) == 0 {
+				fmt.Println("All packages are up to date.")
+				return
+			}
+			for _, u := range updates {
+				pkgs = append(pkgs, u.Name)
+			}
+		}
+
+		for _, pkgName := range pkgs {
+			if err := manager.UpgradePackage(pkgName); err != nil {
+				if conflictErr, ok := err.(*manager.ConflictError); ok {
+					fmt.Printf("Error upgrading '%s': the new version conflicts with enabled packages:\n", pkgName)
+					for name, owner := range conflictErr.Conflicts {
+						fmt.Printf("  %s (from %s)\n", name, owner)
+					}
+					continue
+				}
+				fmt.Printf("Error upgrading '%s': %v\n", pkgName, err)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(upgradeCmd)
+}
@@ -0,0 +1,522 @@
+package manager
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/sarkartanmay393/ah/pkg/semver"
+	"gopkg.in/yaml.v3"
+)
+
+// Ahfile is a declarative description of the packages a user (or a team)
+// wants enabled, applied with Apply.
+//
+//	packages:
+//	  - name: git-tools
+//	    version: 1.2.0          # optional; default: keep installed or latest
+//	    disabled: [gp]          # definitions not to compile
+//	    renames: {gc: gcm}      # aliases and functions to compile as another name
+//	    priority: 10            # wins names other packages define (default 0)
+//	  - name: kube
+//	    registry: corp          # optional; default: registry order
+//	conflicts:
+//	  gs: git-tools             # which package wins a name both define
+type Ahfile struct {
+	Packages  []AhfilePackage   `yaml:"packages"`
+	Conflicts map[string]string `yaml:"conflicts,omitempty"`
+}
+
+// AhfilePackage is one package entry of an Ahfile.
+type AhfilePackage struct {
+	Name     string            `yaml:"name"`
+	Version  string            `yaml:"version,omitempty"`
+	Registry string            `yaml:"registry,omitempty"`
+	Disabled []string          `yaml:"disabled,omitempty"`
+	Renames  map[string]string `yaml:"renames,omitempty"`
+	Priority int               `yaml:"priority,omitempty"`
+}
+
+var packageNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// LoadAhfile reads and validates an Ahfile.
+func LoadAhfile(path string) (*Ahfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f Ahfile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", filepath.Base(path), err)
+	}
+	if err := f.validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", filepath.Base(path), err)
+	}
+	return &f, nil
+}
+
+func (f *Ahfile) validate() error {
+	seen := make(map[string]bool)
+	for _, p := range f.Packages {
+		if !packageNamePattern.MatchString(p.Name) {
+			return fmt.Errorf("invalid package name %q", p.Name)
+		}
+		if p.Registry != "" && !packageNamePattern.MatchString(p.Registry) {
+			return fmt.Errorf("invalid registry name %q for %s", p.Registry, p.Name)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("package %s is listed twice", p.Name)
+		}
+		if p.Version != "" {
+			if _, err := semver.Parse(p.Version); err != nil {
+				return fmt.Errorf("invalid version %q for %s: %w", p.Version, p.Name, err)
+			}
+		}
+		for from, to := range p.Renames {
+			if !validDefinitionName(to) {
+				return fmt.Errorf("invalid name %q to rename %s/%s to", to, p.Name, from)
+			}
+		}
+		seen[p.Name] = true
+	}
+	for name, owner := range f.Conflicts {
+		if !seen[owner] {
+			return fmt.Errorf("conflict choice for %s names %s, which is not listed", name, owner)
+		}
+	}
+	return nil
+}
+
+// overrides returns the overrides the Ahfile asks for.
+func (f *Ahfile) overrides() *Overrides {
+	o := &Overrides{Disabled: make(map[string][]string), Owners: make(map[string]string), Renames: make(map[string]map[string]string), Priorities: make(map[string]int)}
+	for _, p := range f.Packages {
+		o.Priorities[p.Name] = p.Priority
+		if len(p.Disabled) > 0 {
+			o.Disabled[p.Name] = append([]string(nil), p.Disabled...)
+		}
+		if len(p.Renames) > 0 {
+			o.Renames[p.Name] = maps.Clone(p.Renames)
+		}
+	}
+	for name, owner := range f.Conflicts {
+		o.Owners[name] = owner
+	}
+	return o.normalize()
+}
+
+// ApplyAction is one step needed to converge to an Ahfile.
+type ApplyAction struct {
+	Kind    ApplyKind
+	Package string
+	// From and To are the installed and wanted versions, where known.
+	From string
+	To   string
+	// Detail describes override changes.
+	Detail string
+
+	// registry, files and commit are the revision to pin for installs and
+	// switches.
+	registry *Registry
+	files    packageFiles
+	commit   string
+}
+
+// ApplyKind is the kind of an ApplyAction.
+type ApplyKind int
+
+// Kinds of apply actions.
+const (
+	ApplyInstall ApplyKind = iota
+	ApplySwitch
+	ApplyEnable
+	ApplyDisable
+	ApplyOverride
+)
+
+func (a ApplyAction) String() string {
+	switch a.Kind {
+	case ApplyInstall:
+		return fmt.Sprintf("+ install %s %s", a.Package, a.To)
+	case ApplySwitch:
+		return fmt.Sprintf("~ switch %s %s -> %s", a.Package, a.From, a.To)
+	case ApplyEnable:
+		return fmt.Sprintf("+ enable %s %s", a.Package, a.To)
+	case ApplyDisable:
+		return fmt.Sprintf("- disable %s", a.Package)
+	default:
+		return "~ " + a.Detail
+	}
+}
+
+// Apply converges ~/.ah to the Ahfile without prompting: packages it lists
+// are installed, switched to the wanted version or enabled; enabled
+// packages it does not list are disabled; and the overrides are replaced
+// by its disabled definitions and conflict choices. It returns the actions
+// taken, or with dryRun only the ones that would be.
+func Apply(f *Ahfile, dryRun bool) ([]ApplyAction, error) {
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+	if err := EnsureDirs(); err != nil {
+		return nil, err
+	}
+
+	var plan []ApplyAction
+	err := WithLock(func() error {
+		if err := UpdateRegistry(); err != nil {
+			return fmt.Errorf("failed to update registry: %w", err)
+		}
+
+		lock, err := LoadLockfile()
+		if err != nil {
+			return err
+		}
+		plan, err = planApply(f, lock)
+		if err != nil || dryRun {
+			return err
+		}
+		return executeApply(f, lock, plan)
+	})
+	return plan, err
+}
+
+// planApply computes the actions that converge the current state to f and
+// checks that the result has no unresolved conflicts. Assumes LOCK IS HELD.
+func planApply(f *Ahfile, lock *Lockfile) ([]ApplyAction, error) {
+	active, err := ListPackages()
+	if err != nil {
+		return nil, err
+	}
+	isActive := make(map[string]bool)
+	for _, p := range active {
+		isActive[p] = true
+	}
+
+	root, err := GetRootDir()
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []ApplyAction
+	wanted := make(map[string]bool)
+	contents := make(map[string]*PackageContent)
+	metas := make(map[string]*PackageMetadata)
+	for _, p := range f.Packages {
+		wanted[p.Name] = true
+		installed := lock.installedVersion(p.Name)
+		entry, pinned := lock.Packages[p.Name]
+		sameRegistry := p.Registry == "" || p.Registry == entry.registry()
+
+		var files packageFiles
+		switch {
+		case pinned && sameRegistry && (p.Version == "" || p.Version == installed):
+			files = lock.pinnedFiles(p.Name)
+			if !isActive[p.Name] {
+				plan = append(plan, ApplyAction{Kind: ApplyEnable, Package: p.Name, To: installed})
+			}
+		default:
+			action, err := resolveRevision(lock, p)
+			if err != nil {
+				return nil, err
+			}
+			files = action.files
+			if pinned {
+				action.Kind = ApplySwitch
+				action.From = installed
+			}
+			plan = append(plan, action)
+		}
+
+		meta, err := loadMetadata(files)
+		if err != nil {
+			return nil, fmt.Errorf("invalid package metadata for %s: %w", p.Name, err)
+		}
+		metas[p.Name] = meta
+		content, err := loadContent(files, filepath.Join(root, ActiveDir, p.Name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("invalid package: %s defines no aliases, functions, executables, env variables or dependencies", p.Name)
+			}
+			return nil, fmt.Errorf("failed to read %s: %w", p.Name, err)
+		}
+		contents[p.Name] = content
+	}
+	if err := checkAhfileDependencies(metas); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(active)
+	for _, p := range active {
+		if !wanted[p] {
+			plan = append(plan, ApplyAction{Kind: ApplyDisable, Package: p})
+		}
+	}
+
+	current, err := LoadOverrides()
+	if err != nil {
+		return nil, err
+	}
+	// Resolutions are kept; they apply among the wanted packages.
+	want := f.overrides()
+	want.resolved, want.active = current.resolved, wanted
+	if err := checkResolved(contents, want); err != nil {
+		return nil, err
+	}
+	plan = append(plan, diffOverrides(current, want)...)
+	return plan, nil
+}
+
+// resolveRevision finds the registry revision an Ahfile entry asks for:
+// the latest one, or the wanted version wherever 'ah install pkg@version'
+// would find it (see Registry.selectVersion).
+func resolveRevision(lock *Lockfile, p AhfilePackage) (ApplyAction, error) {
+	name := p.Name
+	if p.Registry != "" {
+		name = p.Registry + "/" + p.Name
+	}
+	reg, _, err := lock.findPackage(name)
+	if err != nil {
+		return ApplyAction{}, err
+	}
+	files, commit := reg.headFiles(p.Name)
+	head := ""
+	if meta, err := loadMetadata(files); err == nil {
+		head = meta.Version
+	}
+	if p.Version == "" || p.Version == head {
+		return ApplyAction{Kind: ApplyInstall, Package: p.Name, To: head, registry: reg, files: files, commit: commit}, nil
+	}
+
+	exact, err := semver.ParseConstraint("=" + p.Version)
+	if err != nil {
+		return ApplyAction{}, err
+	}
+	files, commit, err = reg.selectVersion(p.Name, exact)
+	if err != nil {
+		return ApplyAction{}, fmt.Errorf("version %s of %s not found: %w", p.Version, p.Name, err)
+	}
+	return ApplyAction{Kind: ApplyInstall, Package: p.Name, To: p.Version, registry: reg, files: files, commit: commit}, nil
+}
+
+// checkAhfileDependencies returns an error if a package the Ahfile lists
+// depends on one it does not list, or on another version than it lists.
+func checkAhfileDependencies(metas map[string]*PackageMetadata) error {
+	var problems []string
+	for _, pkg := range sortedKeys(metas) {
+		for _, dep := range sortedKeys(metas[pkg].Dependencies) {
+			_, bare := splitPackageName(dep)
+			c, err := semver.ParseConstraint(metas[pkg].Dependencies[dep])
+			if err != nil {
+				return err
+			}
+			switch meta, ok := metas[bare]; {
+			case !ok:
+				problems = append(problems, fmt.Sprintf("%s needs %s %s; add it to 'packages'", pkg, bare, c))
+			case !satisfies(c, meta.Version):
+				problems = append(problems, fmt.Sprintf("%s needs %s %s, not %s", pkg, bare, c, meta.Version))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("unmet dependencies:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// checkResolved returns an error if two packages define the same name
+// differently and neither the overrides, a resolution nor a higher
+// priority say which one wins, or if a conflict choice names a package
+// that does not define the name.
+func checkResolved(contents map[string]*PackageContent, o *Overrides) error {
+	definedBy := make(map[string][]string)
+	variants := make(map[string]map[string]bool)
+	for pkg, content := range contents {
+		for name, desc := range o.expose(pkg, content).definitions() {
+			definedBy[name] = append(definedBy[name], pkg)
+			if variants[name] == nil {
+				variants[name] = make(map[string]bool)
+			}
+			variants[name][desc] = true
+		}
+	}
+
+	var problems []string
+	for name, pkgs := range definedBy {
+		sort.Strings(pkgs)
+		_, chosen := o.Owners[name]
+		chosen = chosen || slices.Contains(pkgs, o.resolved[name])
+		if len(pkgs) > 1 {
+			ranked := slices.Clone(pkgs)
+			o.byPrecedence(ranked)
+			chosen = chosen || o.Priorities[ranked[0]] > o.Priorities[ranked[1]]
+		}
+		if !chosen && len(variants[name]) > 1 {
+			problems = append(problems, fmt.Sprintf("%s is defined by %s; add it to 'conflicts'", name, strings.Join(pkgs, " and ")))
+		}
+	}
+	for name, owner := range o.Owners {
+		found := false
+		for _, pkg := range definedBy[name] {
+			found = found || pkg == owner
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("conflict choice %s: %s does not define it", name, owner))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("unresolved conflicts:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// diffOverrides describes how the overrides change.
+func diffOverrides(current, want *Overrides) []ApplyAction {
+	var out []ApplyAction
+	add := func(format string, args ...any) {
+		out = append(out, ApplyAction{Kind: ApplyOverride, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	pkgs := make(map[string]bool)
+	for pkg := range current.Disabled {
+		pkgs[pkg] = true
+	}
+	for pkg := range want.Disabled {
+		pkgs[pkg] = true
+	}
+	for _, pkg := range sortedKeys(pkgs) {
+		for _, name := range want.Disabled[pkg] {
+			if !current.IsDisabled(pkg, name) {
+				add("disable %s/%s", pkg, name)
+			}
+		}
+		for _, name := range current.Disabled[pkg] {
+			if !want.IsDisabled(pkg, name) {
+				add("re-enable %s/%s", pkg, name)
+			}
+		}
+	}
+
+	renamed := make(map[string]bool)
+	for pkg := range current.Renames {
+		renamed[pkg] = true
+	}
+	for pkg := range want.Renames {
+		renamed[pkg] = true
+	}
+	for _, pkg := range sortedKeys(renamed) {
+		cur, next := current.Renames[pkg], want.Renames[pkg]
+		for _, name := range sortedKeys(next) {
+			if cur[name] != next[name] {
+				add("rename %s/%s to %s", pkg, name, next[name])
+			}
+		}
+		for _, name := range sortedKeys(cur) {
+			if _, ok := next[name]; !ok {
+				add("undo rename of %s/%s (was %s)", pkg, name, cur[name])
+			}
+		}
+	}
+
+	prioritized := make(map[string]bool)
+	for pkg := range current.Priorities {
+		prioritized[pkg] = true
+	}
+	for pkg := range want.Priorities {
+		prioritized[pkg] = true
+	}
+	for _, pkg := range sortedKeys(prioritized) {
+		if cur, next := current.Priorities[pkg], want.Priorities[pkg]; cur != next {
+			add("set priority of %s to %d (was %d)", pkg, next, cur)
+		}
+	}
+
+	names := make(map[string]bool)
+	for name := range current.Owners {
+		names[name] = true
+	}
+	for name := range want.Owners {
+		names[name] = true
+	}
+	for _, name := range sortedKeys(names) {
+		cur, had := current.Owners[name]
+		next, has := want.Owners[name]
+		switch {
+		case has && cur != next:
+			add("use %s from %s", name, next)
+		case had && !has:
+			add("forget conflict choice for %s (was %s)", name, cur)
+		}
+	}
+	return out
+}
+
+// executeApply carries out a plan. Assumes LOCK IS HELD.
+func executeApply(f *Ahfile, lock *Lockfile, plan []ApplyAction) error {
+	root, err := GetRootDir()
+	if err != nil {
+		return err
+	}
+
+	for _, a := range plan {
+		switch a.Kind {
+		case ApplyInstall, ApplySwitch:
+			if err := lock.pinRevision(a.registry, a.Package, a.files, a.commit); err != nil {
+				return fmt.Errorf("failed to pin %s: %w", a.Package, err)
+			}
+			if err := activatePackage(lock, a.Package); err != nil {
+				return err
+			}
+		case ApplyEnable:
+			if _, err := lock.ensureStored(a.Package); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", a.Package, err)
+			}
+			if err := activatePackage(lock, a.Package); err != nil {
+				return err
+			}
+		case ApplyDisable:
+			if err := os.Remove(filepath.Join(root, ActiveDir, a.Package)); err != nil {
+				return fmt.Errorf("failed to disable %s: %w", a.Package, err)
+			}
+		}
+	}
+
+	if err := lock.Save(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", LockFile, err)
+	}
+	current, err := LoadOverrides()
+	if err != nil {
+		return err
+	}
+	if want := f.overrides(); !current.sameChoices(want) {
+		if err := want.Save(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", OverridesFile, err)
+		}
+	}
+
+	if err := CompileAliases(); err != nil {
+		fmt.Printf("Warning: Failed to compile aliases: %v\n", err)
+	}
+	if err := syncShims(); err != nil {
+		fmt.Printf("Warning: Failed to link executables: %v\n", err)
+	}
+	if _, err := collectGarbage(); err != nil {
+		fmt.Printf("Warning: Failed to clean up old versions: %v\n", err)
+	}
+	return bumpStateGeneration()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
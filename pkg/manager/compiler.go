@@ -4,60 +4,96 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
-
-	// Import parser
-	"github.com/sarkartanmay393/ah/pkg/parser"
+	"slices"
 )
 
 // CompileAliases merges all active alias files into a single sourceable file
+// per supported shell, using the registered Emitters.
 func CompileAliases() error {
 	root, err := GetRootDir()
 	if err != nil {
 		return err
 	}
 
+	pkgs, err := collectActivePackages(root)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range Emitters() {
+		if err := writeCompiledFile(root, e.FileName(), e.Emit(pkgs)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collectActivePackages parses every active package at the revision
+// pinned in ah.lock, printing warnings for problems found along the way.
+// Packages enabled before ah.lock or the store existed are pinned to the
+// current registry revision and moved into the store.
+func collectActivePackages(root string) ([]CompiledPackage, error) {
 	activeDir := filepath.Join(root, ActiveDir)
 	entries, err := os.ReadDir(activeDir)
 	if err != nil {
-		// No active dir? Just empty the file
-		return writeCompiledFile(root, "")
+		// No active dir? Nothing to compile
+		return nil, nil
 	}
 
-	var sb strings.Builder
-	sb.WriteString("# Auto-generated alias dump by ah\n")
-	sb.WriteString("# Do not edit this file directly.\n\n")
+	lock, err := LoadLockfile()
+	if err != nil {
+		return nil, err
+	}
+	lockChanged := false
+	overrides, err := LoadOverrides()
+	if err != nil {
+		return nil, err
+	}
 
+	var pkgs []CompiledPackage
 	for _, entry := range entries {
-		aliasPath := filepath.Join(activeDir, entry.Name(), "alias.sh")
-		if _, err := os.Stat(aliasPath); err == nil {
-
-			// STRICT SANITIZATION:
-			// Parse the file to find *only* alias definitions.
-			// Ignore any other shell code (malware protection).
-			aliases, err := parser.ParseAliases(aliasPath)
-			if err != nil {
+		// STRICT SANITIZATION:
+		// Parse the files to find *only* alias and function definitions.
+		// Ignore any other shell code (malware protection).
+		changed, err := lock.ensurePinned(entry.Name())
+		if err != nil {
+			fmt.Printf("Warning: Failed to pin %s: %v\n", entry.Name(), err)
+		}
+		lockChanged = lockChanged || changed
+		content, err := lock.loadContent(entry.Name())
+		if err != nil {
+			if !os.IsNotExist(err) {
 				// If parse fails, weird, but let's log and skip
 				fmt.Printf("Warning: Failed to parse %s: %v\n", entry.Name(), err)
-				continue
-			}
-
-			if len(aliases) > 0 {
-				sb.WriteString(fmt.Sprintf("# Package: %s\n", entry.Name()))
-				for _, a := range aliases {
-					// Re-quote safely: val -> 'val' (escape single quotes)
-					safeVal := strings.ReplaceAll(a.Command, "'", "'\\''")
-					sb.WriteString(fmt.Sprintf("alias %s='%s'\n", a.Name, safeVal))
-				}
-				sb.WriteString("\n")
 			}
+			continue
 		}
+		for _, d := range content.Warnings() {
+			fmt.Printf("Warning: %s\n", d)
+		}
+		pkgs = append(pkgs, CompiledPackage{Name: entry.Name(), Content: overrides.apply(entry.Name(), content)})
+	}
+
+	// Packages enabled without a conflict check may define the same
+	// names; only the definition of the package with precedence is kept.
+	pkgs, shadows := overrides.shadow(pkgs)
+	if len(shadows) > 0 {
+		fmt.Printf("Warning: %d definitions are shadowed by other packages (see 'ah list --shadowed')\n", len(shadows))
 	}
+	pkgs = slices.DeleteFunc(pkgs, func(p CompiledPackage) bool {
+		c := p.Content
+		return len(c.Aliases) == 0 && len(c.Functions) == 0 && len(c.Env) == 0
+	})
 
-	return writeCompiledFile(root, sb.String())
+	if lockChanged {
+		if err := lock.Save(); err != nil {
+			fmt.Printf("Warning: Failed to write %s: %v\n", LockFile, err)
+		}
+	}
+	return pkgs, nil
 }
 
-func writeCompiledFile(root, content string) error {
-	dumpPath := filepath.Join(root, "aliases.compiled.sh")
+func writeCompiledFile(root, name, content string) error {
+	dumpPath := filepath.Join(root, name)
 	return os.WriteFile(dumpPath, []byte(content), 0644)
 }
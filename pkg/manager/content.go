@@ -0,0 +1,151 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sarkartanmay393/ah/pkg/parser"
+)
+
+// PackageContent is everything a package contributes to the user's shell.
+type PackageContent struct {
+	Aliases   []parser.AliasDef
+	Functions []parser.FunctionDef
+	// Env holds the variables declared in the package's ah.yaml.
+	Env []EnvVar
+	// Shims are the names of the executables in the package's bin/ directory.
+	Shims []string
+	// Diagnostics collects the problems found in all of the package's files.
+	Diagnostics []parser.Diagnostic
+}
+
+// LoadPackageContent parses the alias.sh and functions.sh files of a
+// package and collects its bin/ executables and the env variables from its
+// ah.yaml. Any of these may be missing; os.ErrNotExist is returned only if
+// the package defines nothing at all.
+func LoadPackageContent(packageDir string) (*PackageContent, error) {
+	return loadContent(dirFiles(packageDir), packageDir)
+}
+
+// loadContent implements LoadPackageContent for any package source. dir is
+// only used to name files in diagnostics.
+func loadContent(files packageFiles, dir string) (*PackageContent, error) {
+	content := &PackageContent{}
+	found := false
+
+	data, err := files.ReadFile("alias.sh")
+	if err == nil {
+		found = true
+		res, _ := parser.Parse(bytes.NewReader(data), filepath.Join(dir, "alias.sh"))
+		content.Aliases = res.Aliases
+		content.Diagnostics = append(content.Diagnostics, res.Diagnostics...)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	data, err = files.ReadFile("functions.sh")
+	if err == nil {
+		found = true
+		res, _ := parser.ParseFunctions(bytes.NewReader(data), filepath.Join(dir, "functions.sh"))
+		content.Functions = res.Functions
+		content.Diagnostics = append(content.Diagnostics, res.Diagnostics...)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	shims, diags, err := listShims(files, dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(shims) > 0 {
+		found = true
+		content.Shims = shims
+	}
+	content.Diagnostics = append(content.Diagnostics, diags...)
+
+	if meta, err := loadMetadata(files); err == nil {
+		if len(meta.Env) > 0 {
+			found = true
+			content.Env = meta.Env
+		}
+		// A meta-package only pulls in other packages.
+		found = found || len(meta.Dependencies) > 0
+	}
+
+	if !found {
+		return nil, os.ErrNotExist
+	}
+	return content, nil
+}
+
+// Names returns every command name the package defines: aliases, then
+// functions, then shims.
+func (c *PackageContent) Names() []string {
+	names := make([]string, 0, len(c.Aliases)+len(c.Functions)+len(c.Shims))
+	for _, a := range c.Aliases {
+		names = append(names, a.Name)
+	}
+	for _, f := range c.Functions {
+		names = append(names, f.Name)
+	}
+	names = append(names, c.Shims...)
+	return names
+}
+
+// Describe returns a one-line description of what name expands to, or
+// false if the package does not define it. Env variables are looked up
+// as "$NAME".
+func (c *PackageContent) Describe(name string) (string, bool) {
+	if varName, ok := strings.CutPrefix(name, "$"); ok {
+		for _, v := range c.Env {
+			if v.Name == varName {
+				return fmt.Sprintf("export %s=%s", v.Name, shellQuote(v.Value)), true
+			}
+		}
+		return "", false
+	}
+	for _, a := range c.Aliases {
+		if a.Name == name {
+			return a.Command, true
+		}
+	}
+	for _, f := range c.Functions {
+		if f.Name == name {
+			return "function { " + f.Body + " }", true
+		}
+	}
+	for _, shim := range c.Shims {
+		if shim == name {
+			return "executable bin/" + shim, true
+		}
+	}
+	return "", false
+}
+
+// Warnings returns the diagnostics that should be shown to the user.
+func (c *PackageContent) Warnings() []parser.Diagnostic {
+	var out []parser.Diagnostic
+	for _, d := range c.Diagnostics {
+		if d.Severity >= parser.SeverityWarning {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// envConflicts returns the variables (as "$NAME") that both packages set
+// to different values.
+func envConflicts(a, b *PackageContent) []string {
+	var out []string
+	for _, va := range a.Env {
+		for _, vb := range b.Env {
+			if va.Name == vb.Name && va.Value != vb.Value {
+				out = append(out, "$"+va.Name)
+			}
+		}
+	}
+	return out
+}
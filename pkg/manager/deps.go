@@ -0,0 +1,333 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sarkartanmay393/ah/pkg/semver"
+)
+
+// DependencyStep is one package that resolving dependencies installs or
+// enables.
+type DependencyStep struct {
+	Name    string
+	Version string
+	// Install is set if the package is pinned at a new revision. Otherwise
+	// it is already installed at a satisfying version and only enabled.
+	Install bool
+	// RequiredBy is the package that pulled it in.
+	RequiredBy string
+	Content    *PackageContent
+
+	reg    *Registry
+	files  packageFiles
+	commit string
+}
+
+func (s DependencyStep) String() string {
+	if s.Install {
+		return fmt.Sprintf("+ install %s %s (needed by %s)", s.Name, s.Version, s.RequiredBy)
+	}
+	return fmt.Sprintf("+ enable %s %s (needed by %s)", s.Name, s.Version, s.RequiredBy)
+}
+
+// validateDependencies checks the dependency names and constraints of the
+// package named self.
+func validateDependencies(self string, deps map[string]string) error {
+	for name, constraint := range deps {
+		regName, bare := splitPackageName(name)
+		if !packageNamePattern.MatchString(bare) || (regName != "" && !packageNamePattern.MatchString(regName)) {
+			return fmt.Errorf("invalid dependency name %q", name)
+		}
+		if bare == self {
+			return fmt.Errorf("package depends on itself")
+		}
+		if _, err := semver.ParseConstraint(constraint); err != nil {
+			return fmt.Errorf("dependency %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// satisfies reports whether a package version meets a constraint. Any
+// version, even one that is not semver, meets an empty constraint.
+func satisfies(c *semver.Constraint, version string) bool {
+	if c.String() == "*" {
+		return true
+	}
+	v, err := semver.Parse(version)
+	return err == nil && c.Check(v)
+}
+
+type depResolver struct {
+	lock   *Lockfile
+	active map[string]bool
+	// chosen maps packages to the version the resolution uses.
+	chosen   map[string]string
+	visiting map[string]bool
+	steps    []DependencyStep
+}
+
+// resolveDependencies returns, in install order (dependencies first), the
+// steps that install and enable the transitive dependencies of a package
+// at versions satisfying every constraint. Enabled packages that already
+// satisfy them need no step. Assumes LOCK IS HELD.
+func resolveDependencies(lock *Lockfile, meta *PackageMetadata) ([]DependencyStep, error) {
+	active, err := ListPackages()
+	if err != nil {
+		return nil, err
+	}
+	r := &depResolver{
+		lock:     lock,
+		active:   make(map[string]bool),
+		chosen:   map[string]string{meta.Name: meta.Version},
+		visiting: map[string]bool{meta.Name: true},
+	}
+	for _, p := range active {
+		r.active[p] = true
+	}
+	if err := r.visitDependencies(meta); err != nil {
+		return nil, err
+	}
+	return r.steps, nil
+}
+
+func (r *depResolver) visitDependencies(meta *PackageMetadata) error {
+	for _, name := range sortedKeys(meta.Dependencies) {
+		if err := r.visit(name, meta.Dependencies[name], meta.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *depResolver) visit(name, constraint, requiredBy string) error {
+	c, err := semver.ParseConstraint(constraint)
+	if err != nil {
+		return err
+	}
+	_, bare := splitPackageName(name)
+	if r.visiting[bare] {
+		return fmt.Errorf("dependency cycle: %s depends on %s, which depends on it", requiredBy, bare)
+	}
+	if v, ok := r.chosen[bare]; ok {
+		if !satisfies(c, v) {
+			return fmt.Errorf("%s requires %s %s, but %s %s is needed elsewhere", requiredBy, bare, c, bare, v)
+		}
+		return nil
+	}
+	r.visiting[bare] = true
+	defer delete(r.visiting, bare)
+
+	step, meta, err := r.choose(name, c, requiredBy)
+	if err != nil {
+		return err
+	}
+	r.chosen[bare] = meta.Version
+	if err := r.visitDependencies(meta); err != nil {
+		return err
+	}
+	if step != nil {
+		r.steps = append(r.steps, *step)
+	}
+	return nil
+}
+
+// choose picks the revision of a dependency: the installed one if it
+// satisfies the constraint, otherwise the highest satisfying one in the
+// registry. The step is nil if the package is already enabled at a
+// satisfying version.
+func (r *depResolver) choose(name string, c *semver.Constraint, requiredBy string) (*DependencyStep, *PackageMetadata, error) {
+	regName, bare := splitPackageName(name)
+	root, err := GetRootDir()
+	if err != nil {
+		return nil, nil, err
+	}
+	dir := filepath.Join(root, ActiveDir, bare)
+
+	if entry, ok := r.lock.Packages[bare]; ok && (regName == "" || regName == entry.registry()) {
+		files := r.lock.pinnedFiles(bare)
+		meta, err := loadMetadata(files)
+		if err == nil && satisfies(c, meta.Version) {
+			if r.active[bare] {
+				return nil, meta, nil
+			}
+			content, err := loadContent(files, dir)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, nil, err
+			}
+			return &DependencyStep{Name: bare, Version: meta.Version, RequiredBy: requiredBy, Content: content, files: files}, meta, nil
+		}
+	}
+
+	reg, _, err := r.lock.findPackage(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s depends on %s: %w", requiredBy, name, err)
+	}
+	files, commit, err := reg.selectVersion(bare, c)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s requires %s %s: %w", requiredBy, bare, c, err)
+	}
+	meta, err := loadMetadata(files)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid package %s (needed by %s): %w", bare, requiredBy, err)
+	}
+	content, err := loadContent(files, dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("invalid package: %s defines no aliases, functions, executables, env variables or dependencies", bare)
+		}
+		return nil, nil, err
+	}
+	return &DependencyStep{
+		Name: bare, Version: meta.Version, Install: true, RequiredBy: requiredBy, Content: content,
+		reg: reg, files: files, commit: commit,
+	}, meta, nil
+}
+
+// applyDependencies pins and links the packages of the steps, in order.
+// The caller saves the lockfile and recompiles. Assumes LOCK IS HELD.
+func (l *Lockfile) applyDependencies(steps []DependencyStep) error {
+	for _, s := range steps {
+		if s.Install {
+			if err := l.pinRevision(s.reg, s.Name, s.files, s.commit); err != nil {
+				return fmt.Errorf("failed to pin %s: %w", s.Name, err)
+			}
+		} else if _, err := l.ensureStored(s.Name); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", s.Name, err)
+		}
+		if err := activatePackage(l, s.Name); err != nil {
+			return err
+		}
+		fmt.Printf("Enabled dependency: %s %s\n", s.Name, s.Version)
+	}
+	return nil
+}
+
+// planConflicts checks packages about to be enabled together against the
+// enabled packages and against each other, under the given overrides.
+// Enabled packages in contents are being replaced and not checked against.
+func planConflicts(overrides *Overrides, contents map[string]*PackageContent) (map[string]string, error) {
+	names := sortedKeys(contents)
+	overrides = overrides.activating(names...)
+	conflicts := make(map[string]string)
+	definedBy := make(map[string]string)
+	for _, pkg := range names {
+		found, err := checkContentConflicts(overrides, pkg, contents[pkg], names...)
+		if err != nil {
+			return nil, err
+		}
+		for name, owner := range found {
+			conflicts[name] = owner
+		}
+		if contents[pkg] == nil {
+			continue
+		}
+		for _, name := range overrides.apply(pkg, contents[pkg]).Names() {
+			if other, ok := definedBy[name]; ok && other != pkg {
+				conflicts[name] = other
+			}
+			definedBy[name] = pkg
+		}
+	}
+	if len(conflicts) > 0 {
+		return conflicts, nil
+	}
+	return nil, nil
+}
+
+// dependents returns the enabled packages (other than the package itself)
+// that depend on a package, according to their pinned ah.yaml.
+func dependents(lock *Lockfile, packageName string) ([]string, error) {
+	active, err := ListPackages()
+	if err != nil {
+		return nil, err
+	}
+	var users []string
+	for _, pkg := range active {
+		if pkg == packageName {
+			continue
+		}
+		meta, err := loadMetadata(lock.pinnedFiles(pkg))
+		if err != nil {
+			continue
+		}
+		for dep := range meta.Dependencies {
+			if _, bare := splitPackageName(dep); bare == packageName {
+				users = append(users, pkg)
+				break
+			}
+		}
+	}
+	sort.Strings(users)
+	return users, nil
+}
+
+// checkNoDependents returns an error if enabled packages depend on a
+// package that is about to be disabled or removed.
+func checkNoDependents(lock *Lockfile, packageName, action string) error {
+	users, err := dependents(lock, packageName)
+	if err != nil {
+		return err
+	}
+	if len(users) > 0 {
+		return fmt.Errorf("cannot %s %s: needed by %s (%s those first)", action, packageName, strings.Join(users, ", "), action)
+	}
+	return nil
+}
+
+// planDependencies resolves the dependencies of a package about to be
+// enabled with the given content, and returns a *ConflictError if, under
+// the given overrides, the package or its new dependencies clash with
+// enabled packages or with each other. Assumes LOCK IS HELD.
+func (l *Lockfile) planDependencies(overrides *Overrides, meta *PackageMetadata, content *PackageContent) ([]DependencyStep, error) {
+	steps, err := resolveDependencies(l, meta)
+	if err != nil {
+		return nil, err
+	}
+	contents := map[string]*PackageContent{meta.Name: content}
+	for _, s := range steps {
+		contents[s.Name] = s.Content
+	}
+	conflicts, err := planConflicts(overrides, contents)
+	if err != nil {
+		fmt.Printf("Warning: Failed to check conflicts: %v\n", err)
+	}
+	if len(conflicts) > 0 {
+		return nil, &ConflictError{Conflicts: conflicts}
+	}
+	return steps, nil
+}
+
+// enableDependencies installs and enables the dependencies of a pinned
+// package. Assumes LOCK IS HELD.
+func (l *Lockfile) enableDependencies(packageName string) error {
+	files := l.pinnedFiles(packageName)
+	meta, err := loadMetadata(files)
+	if err != nil {
+		return fmt.Errorf("invalid package metadata: %w", err)
+	}
+	if len(meta.Dependencies) == 0 {
+		return nil
+	}
+	root, err := GetRootDir()
+	if err != nil {
+		return err
+	}
+	content, err := loadContent(files, filepath.Join(root, ActiveDir, packageName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	overrides, err := LoadOverrides()
+	if err != nil {
+		return err
+	}
+	steps, err := l.planDependencies(overrides, meta, content)
+	if err != nil {
+		return err
+	}
+	return l.applyDependencies(steps)
+}
@@ -0,0 +1,69 @@
+package manager
+
+import (
+	"fmt"
+	"strings"
+)
+
+// fishEmitter renders packages for fish.
+//
+// Aliases become abbreviations rather than fish "alias" functions: fish's
+// alias builtin evaluates the command text when it is defined, which would
+// let a crafted alias run code as soon as the file is sourced. An abbr is
+// stored as a plain string and only expanded on the command line.
+type fishEmitter struct{}
+
+func (fishEmitter) Shell() string    { return "fish" }
+func (fishEmitter) FileName() string { return CompiledFishFile }
+
+func (fishEmitter) Emit(pkgs []CompiledPackage) string {
+	var sb strings.Builder
+	sb.WriteString(compiledHeader("#"))
+
+	for _, pkg := range pkgs {
+		sb.WriteString(fmt.Sprintf("# Package: %s\n", pkg.Name))
+		for _, v := range pkg.Content.Env {
+			if v.IfUnset {
+				sb.WriteString(fmt.Sprintf("set -q %s; or set -gx %s %s\n", v.Name, v.Name, fishQuote(v.Value)))
+			} else {
+				sb.WriteString(fmt.Sprintf("set -gx %s %s\n", v.Name, fishQuote(v.Value)))
+			}
+		}
+		for _, a := range pkg.Content.Aliases {
+			if reason := fishIncompatible(a.Command); reason != "" {
+				sb.WriteString(fmt.Sprintf("# skipped %s: %s\n", a.Name, reason))
+				continue
+			}
+			sb.WriteString(fmt.Sprintf("abbr --add --global -- %s %s\n", a.Name, fishQuote(a.Command)))
+		}
+		for _, f := range pkg.Content.Functions {
+			sb.WriteString(fmt.Sprintf("# skipped function %s: functions.sh is POSIX shell only\n", f.Name))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// fishIncompatible returns why a POSIX alias command cannot work in fish,
+// or "" if it can be used as is.
+func fishIncompatible(command string) string {
+	switch {
+	case strings.Contains(command, "`"):
+		return "uses backquote command substitution"
+	case strings.Contains(command, "${"):
+		return "uses ${...} parameter expansion"
+	case strings.Contains(command, "$(("):
+		return "uses $((...)) arithmetic"
+	case strings.Contains(command, "[["):
+		return "uses [[ ... ]] tests"
+	}
+	return ""
+}
+
+// fishQuote single-quotes s for fish, where backslash escapes "\" and "'"
+// inside single quotes.
+func fishQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	return "'" + s + "'"
+}
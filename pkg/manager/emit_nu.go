@@ -0,0 +1,87 @@
+package manager
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// nuEmitter renders packages for nushell, to be loaded with
+// "source ~/.ah/aliases.compiled.nu" from config.nu.
+//
+// Nushell parses alias bodies as nushell code, so only aliases that are a
+// single simple command are emitted, with every word rendered as a string
+// literal. The command runs as an external ("^git") so nushell builtins
+// with the same name but different flags (ls, rm, ...) are not picked up.
+type nuEmitter struct{}
+
+func (nuEmitter) Shell() string    { return "nu" }
+func (nuEmitter) FileName() string { return "aliases.compiled.nu" }
+
+func (nuEmitter) Emit(pkgs []CompiledPackage) string {
+	var sb strings.Builder
+	sb.WriteString(compiledHeader("#"))
+
+	for _, pkg := range pkgs {
+		sb.WriteString(fmt.Sprintf("# Package: %s\n", pkg.Name))
+		for _, v := range pkg.Content.Env {
+			if v.IfUnset {
+				sb.WriteString(fmt.Sprintf("if %s not-in $env { $env.%s = %s }\n", nuString(v.Name), v.Name, nuString(v.Value)))
+			} else {
+				sb.WriteString(fmt.Sprintf("$env.%s = %s\n", v.Name, nuString(v.Value)))
+			}
+		}
+		for _, a := range pkg.Content.Aliases {
+			if !nuNamePattern.MatchString(a.Name) {
+				sb.WriteString(fmt.Sprintf("# skipped %s: not a valid nushell alias name\n", a.Name))
+				continue
+			}
+			words, reason := simpleCommandWords(a.Command)
+			if reason != "" {
+				sb.WriteString(fmt.Sprintf("# skipped %s: %s\n", a.Name, reason))
+				continue
+			}
+
+			var cmd string
+			if words[0] == "cd" && len(words) <= 2 {
+				// There is no external cd; nushell's builtin behaves the same.
+				cmd = "cd"
+			} else {
+				cmd = "^" + nuArg(words[0])
+			}
+			for _, w := range words[1:] {
+				cmd += " " + nuArg(w)
+			}
+			sb.WriteString(fmt.Sprintf("alias %s = %s\n", a.Name, cmd))
+		}
+		for _, f := range pkg.Content.Functions {
+			sb.WriteString(fmt.Sprintf("# skipped function %s: functions.sh is POSIX shell only\n", f.Name))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+var (
+	nuNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.][A-Za-z0-9_.-]*$`)
+	nuBarePattern = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=-]+$`)
+)
+
+// nuArg renders a command argument: bare if it only contains safe
+// characters, otherwise as a string literal.
+func nuArg(s string) string {
+	if nuBarePattern.MatchString(s) && !strings.HasPrefix(s, "-") {
+		return s
+	}
+	return nuString(s)
+}
+
+// nuString renders s as a double-quoted nushell string with backslash
+// escapes. Unlike bare words, it is never parsed as a command.
+func nuString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	s = strings.ReplaceAll(s, "\t", `\t`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,49 @@
+package manager
+
+import (
+	"fmt"
+	"strings"
+)
+
+// posixEmitter renders packages for bash and zsh.
+type posixEmitter struct{}
+
+func (posixEmitter) Shell() string    { return "posix" }
+func (posixEmitter) FileName() string { return CompiledFile }
+
+func (posixEmitter) Emit(pkgs []CompiledPackage) string {
+	var sb strings.Builder
+	sb.WriteString(compiledHeader("#"))
+
+	for _, pkg := range pkgs {
+		sb.WriteString(fmt.Sprintf("# Package: %s\n", pkg.Name))
+		for _, v := range pkg.Content.Env {
+			if v.IfUnset {
+				sb.WriteString(fmt.Sprintf("if [ -z \"${%s+x}\" ]; then export %s=%s; fi\n", v.Name, v.Name, shellQuote(v.Value)))
+			} else {
+				sb.WriteString(fmt.Sprintf("export %s=%s\n", v.Name, shellQuote(v.Value)))
+			}
+		}
+		for _, a := range pkg.Content.Aliases {
+			// "--" keeps names like "-x" from being read as options
+			if strings.HasPrefix(a.Name, "-") {
+				sb.WriteString(fmt.Sprintf("alias -- %s=%s\n", a.Name, shellQuote(a.Command)))
+			} else {
+				sb.WriteString(fmt.Sprintf("alias %s=%s\n", a.Name, shellQuote(a.Command)))
+			}
+		}
+		for _, f := range pkg.Content.Functions {
+			// The "function" keyword stops an existing alias with the same
+			// name from being expanded in the definition.
+			sb.WriteString(fmt.Sprintf("function %s {\n%s\n}\n", f.Name, f.Body))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// shellQuote single-quotes s for POSIX shells. Embedded single quotes
+// close the string, are escaped with a backslash and reopen it.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "'\\''") + "'"
+}
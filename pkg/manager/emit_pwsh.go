@@ -0,0 +1,73 @@
+package manager
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// pwshEmitter renders packages for PowerShell, to be dot-sourced from
+// $PROFILE (". ~/.ah/aliases.compiled.ps1").
+//
+// Aliases whose command is a single word become Set-Alias entries. Aliases
+// with arguments need a function wrapper, since PowerShell aliases cannot
+// carry arguments. Any built-in alias of the same name (gc, gp, ...) is
+// removed first, because aliases take precedence over functions.
+type pwshEmitter struct{}
+
+func (pwshEmitter) Shell() string    { return "pwsh" }
+func (pwshEmitter) FileName() string { return "aliases.compiled.ps1" }
+
+func (pwshEmitter) Emit(pkgs []CompiledPackage) string {
+	var sb strings.Builder
+	sb.WriteString(compiledHeader("#"))
+
+	for _, pkg := range pkgs {
+		sb.WriteString(fmt.Sprintf("# Package: %s\n", pkg.Name))
+		for _, v := range pkg.Content.Env {
+			if v.IfUnset {
+				sb.WriteString(fmt.Sprintf("if (-not (Test-Path Env:%s)) { $env:%s = %s }\n", v.Name, v.Name, pwshQuote(v.Value)))
+			} else {
+				sb.WriteString(fmt.Sprintf("$env:%s = %s\n", v.Name, pwshQuote(v.Value)))
+			}
+		}
+		for _, a := range pkg.Content.Aliases {
+			if !pwshNamePattern.MatchString(a.Name) {
+				sb.WriteString(fmt.Sprintf("# skipped %s: not a valid PowerShell name\n", a.Name))
+				continue
+			}
+			words, reason := simpleCommandWords(a.Command)
+			if reason != "" {
+				sb.WriteString(fmt.Sprintf("# skipped %s: %s\n", a.Name, reason))
+				continue
+			}
+
+			if len(words) == 1 {
+				sb.WriteString(fmt.Sprintf("Set-Alias -Name %s -Value %s -Scope Global -Force\n", pwshQuote(a.Name), pwshQuote(words[0])))
+				continue
+			}
+
+			args := make([]string, len(words))
+			for i, w := range words {
+				args[i] = pwshQuote(w)
+			}
+			sb.WriteString(fmt.Sprintf("Remove-Item -Path %s -Force -ErrorAction SilentlyContinue\n", pwshQuote("Alias:"+a.Name)))
+			sb.WriteString(fmt.Sprintf("function global:%s { & %s @args }\n", a.Name, strings.Join(args, " ")))
+		}
+		for _, f := range pkg.Content.Functions {
+			sb.WriteString(fmt.Sprintf("# skipped function %s: functions.sh is POSIX shell only\n", f.Name))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// pwshNamePattern matches the alias names that can be written unquoted
+// after "function global:" without a PowerShell parse error.
+var pwshNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.][A-Za-z0-9_.-]*$`)
+
+// pwshQuote single-quotes s for PowerShell, where a quote is escaped by
+// doubling it.
+func pwshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,86 @@
+package manager
+
+import (
+	"strings"
+
+	"github.com/sarkartanmay393/ah/pkg/parser"
+)
+
+// CompiledPackage is an active package's content, ready to be rendered.
+type CompiledPackage struct {
+	Name    string
+	Content *PackageContent
+}
+
+// Emitter renders the active packages into a file one shell can source.
+type Emitter interface {
+	// Shell names the target shell (e.g. "fish").
+	Shell() string
+	// FileName is the compiled file written under the ah root.
+	FileName() string
+	// Emit renders the packages. It must never produce code that runs
+	// anything when the file is sourced, other than defining the
+	// packages' aliases, functions and variables.
+	Emit(pkgs []CompiledPackage) string
+}
+
+var emitters = []Emitter{
+	posixEmitter{},
+	fishEmitter{},
+	nuEmitter{},
+	pwshEmitter{},
+}
+
+// Emitters returns the registered emitters in compile order.
+func Emitters() []Emitter {
+	return emitters
+}
+
+// RegisterEmitter adds an emitter that CompileAliases will run. An emitter
+// for an already registered shell replaces it.
+func RegisterEmitter(e Emitter) {
+	for i, existing := range emitters {
+		if existing.Shell() == e.Shell() {
+			emitters[i] = e
+			return
+		}
+	}
+	emitters = append(emitters, e)
+}
+
+// compiledHeader starts every compiled file. comment is the shell's line
+// comment prefix.
+func compiledHeader(comment string) string {
+	return comment + " Auto-generated alias dump by ah\n" +
+		comment + " Do not edit this file directly.\n\n"
+}
+
+// simpleCommandWords splits a POSIX alias command into its words if it is
+// a single simple command without expansions, operators or redirections,
+// which is what shells with a different syntax can safely reproduce.
+// It returns nil and a reason otherwise.
+func simpleCommandWords(command string) ([]string, string) {
+	cmds, err := parser.Tokenize(command)
+	if err != nil {
+		return nil, err.Error()
+	}
+	if len(cmds) != 1 || cmds[0].Depth != 0 {
+		return nil, "not a single simple command"
+	}
+
+	var words, raws []string
+	for _, w := range cmds[0].Words {
+		if strings.ContainsAny(w.Value, "$`") {
+			return nil, "uses shell expansions"
+		}
+		words = append(words, w.Value)
+		raws = append(raws, w.Raw)
+	}
+
+	// Operators and redirections are not returned as words; if any were
+	// dropped, the raw words no longer cover the command.
+	if strings.Join(strings.Fields(strings.Join(raws, " ")), " ") != strings.Join(strings.Fields(command), " ") {
+		return nil, "uses pipes, redirections or command lists"
+	}
+	return words, ""
+}
@@ -0,0 +1,97 @@
+package manager
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sarkartanmay393/ah/pkg/parser"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata/")
+
+// quotingFixture exercises the quoting edge cases every emitter must handle.
+var quotingFixture = []CompiledPackage{{
+	Name: "edge-cases",
+	Content: &PackageContent{
+		Aliases: []parser.AliasDef{
+			{Name: "gs", Command: "git status"},
+			{Name: "k", Command: "kubectl"},
+			{Name: "q", Command: `echo 'single' "double" back\slash`},
+			{Name: "sp", Command: `printf '%s\n' "a  b"`},
+			{Name: "..", Command: "cd .."},
+			{Name: "-x", Command: "ls -x"},
+			{Name: "g:s,x", Command: "git status -sb"},
+			{Name: "home", Command: "cd $HOME"},
+			{Name: "top", Command: "ps aux | head"},
+			{Name: "root", Command: `cd "$(git rev-parse --show-toplevel)"`},
+			{Name: "uni", Command: "echo héllo → ✓"},
+		},
+		Functions: []parser.FunctionDef{
+			{Name: "mkcd", Body: `mkdir -p "$1" && cd "$1"`},
+		},
+		Env: []EnvVar{
+			{Name: "EDITOR", Value: "vim"},
+			{Name: "GREETING", Value: `it's "quoted" \ here`},
+			{Name: "PAGER", Value: "less -R", IfUnset: true},
+		},
+	},
+}}
+
+func TestEmitters_Golden(t *testing.T) {
+	for _, e := range Emitters() {
+		t.Run(e.Shell(), func(t *testing.T) {
+			got := e.Emit(quotingFixture)
+			golden := filepath.Join("testdata", "emit", e.Shell()+".golden")
+
+			if *updateGolden {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatalf("failed to update golden file: %v", err)
+				}
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("failed to read golden file (run with -update to create it): %v", err)
+			}
+			if got != string(want) {
+				t.Errorf("%s output differs from %s:\n--- got ---\n%s\n--- want ---\n%s", e.Shell(), golden, got, want)
+			}
+		})
+	}
+}
+
+func TestSimpleCommandWords(t *testing.T) {
+	tests := []struct {
+		command string
+		words   []string
+		ok      bool
+	}{
+		{"git status", []string{"git", "status"}, true},
+		{`echo "a  b" 'c'`, []string{"echo", "a  b", "c"}, true},
+		{"ls | head", nil, false},
+		{"make && make install", nil, false},
+		{"cat > out", nil, false},
+		{"echo $HOME", nil, false},
+		{"echo 'unterminated", nil, false},
+	}
+
+	for _, tt := range tests {
+		words, reason := simpleCommandWords(tt.command)
+		if (reason == "") != tt.ok {
+			t.Errorf("simpleCommandWords(%q): ok = %v, want %v (reason %q)", tt.command, reason == "", tt.ok, reason)
+			continue
+		}
+		if len(words) != len(tt.words) {
+			t.Errorf("simpleCommandWords(%q) = %q, want %q", tt.command, words, tt.words)
+			continue
+		}
+		for i := range words {
+			if words[i] != tt.words[i] {
+				t.Errorf("simpleCommandWords(%q) = %q, want %q", tt.command, words, tt.words)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// packageFiles gives read access to the files of one package, either on
+// disk or at a pinned registry revision. Names are slash-separated and
+// relative to the package directory.
+type packageFiles interface {
+	ReadFile(name string) ([]byte, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+}
+
+// walkPackage calls fn for the directories and regular files below dir,
+// in name order, with each directory before its contents. It defines what
+// a package consists of for hashing, storing and publishing alike: .git,
+// symlinks (which could point outside the package) and other special
+// files are skipped.
+func walkPackage(files packageFiles, dir string, fn func(name string, e fs.DirEntry) error) error {
+	entries, err := files.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, e := range entries {
+		if e.Name() == ".git" || !isPackageEntry(e.Type()) {
+			continue
+		}
+		name := path.Join(dir, e.Name())
+		if err := fn(name, e); err != nil {
+			return err
+		}
+		if e.IsDir() {
+			if err := walkPackage(files, name, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isPackageEntry reports whether a file of the given type can be part of
+// a package: only directories and regular files are.
+func isPackageEntry(mode fs.FileMode) bool {
+	return mode.IsDir() || mode.IsRegular()
+}
+
+// isExecutable reports whether a package file has an execute bit set.
+func isExecutable(e fs.DirEntry) bool {
+	info, err := e.Info()
+	return err == nil && info.Mode().Perm()&0111 != 0
+}
+
+// dirFiles reads a package from a directory on disk.
+type dirFiles string
+
+func (d dirFiles) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+func (d dirFiles) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+// gitFiles reads a package from a commit of a git repository without
+// touching the working tree. Missing paths are reported as
+// os.ErrNotExist.
+type gitFiles struct {
+	repo   string
+	commit string
+	// prefix is the package's directory inside the repository.
+	prefix string
+}
+
+func (g gitFiles) object(name string) string {
+	return g.commit + ":" + path.Join(g.prefix, name)
+}
+
+func (g gitFiles) ReadFile(name string) ([]byte, error) {
+	out, err := runGit(g.repo, "cat-file", "blob", g.object(name))
+	if err != nil {
+		return nil, os.ErrNotExist
+	}
+	return out, nil
+}
+
+func (g gitFiles) ReadDir(name string) ([]fs.DirEntry, error) {
+	out, err := runGit(g.repo, "ls-tree", "-z", "--long", g.object(name))
+	if err != nil {
+		return nil, os.ErrNotExist
+	}
+
+	var entries []fs.DirEntry
+	for _, rec := range strings.Split(string(out), "\x00") {
+		// <mode> <type> <object> <size>\t<name>
+		meta, entryName, ok := strings.Cut(rec, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 4 {
+			continue
+		}
+		size, _ := strconv.ParseInt(fields[3], 10, 64)
+		entries = append(entries, fs.FileInfoToDirEntry(gitFileInfo{
+			name: entryName,
+			size: size,
+			mode: gitFileMode(fields[0]),
+		}))
+	}
+	return entries, nil
+}
+
+// gitFileMode converts a git tree entry mode to a file mode.
+func gitFileMode(mode string) fs.FileMode {
+	switch mode {
+	case "040000":
+		return fs.ModeDir | 0755
+	case "100755":
+		return 0755
+	case "100644":
+		return 0644
+	case "120000":
+		return fs.ModeSymlink | 0777
+	default:
+		// Submodules and anything unexpected.
+		return fs.ModeIrregular
+	}
+}
+
+type gitFileInfo struct {
+	name string
+	size int64
+	mode fs.FileMode
+}
+
+func (i gitFileInfo) Name() string       { return i.name }
+func (i gitFileInfo) Size() int64        { return i.size }
+func (i gitFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i gitFileInfo) ModTime() time.Time { return time.Time{} }
+func (i gitFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i gitFileInfo) Sys() any           { return nil }
+
+// runGit runs a git command in repo and returns its standard output.
+func runGit(repo string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", repo}, args...)...)
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
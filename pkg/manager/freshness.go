@@ -0,0 +1,105 @@
+package manager
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultRegistryTTL is how long a fetched registry counts as fresh unless
+// configured otherwise.
+const DefaultRegistryTTL = 10 * time.Minute
+
+// Offline reports whether ah must not touch the network, set by the
+// AH_OFFLINE environment variable (or the --offline flag, which sets it).
+// Installs and searches then use the registries as last fetched.
+func Offline() bool {
+	switch strings.ToLower(os.Getenv("AH_OFFLINE")) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// RegistryTTL returns how long a fetched registry counts as fresh, during
+// which install, search and apply do not fetch it again. It is set by
+// AH_REGISTRY_TTL or `ttl:` in registries.yaml, either as a duration
+// ("30m") or in minutes ("30"); 0 always fetches. `ah update` ignores it.
+func RegistryTTL() time.Duration {
+	value := os.Getenv("AH_REGISTRY_TTL")
+	if value == "" {
+		if cfg, err := loadRegistriesConfig(); err == nil {
+			value = cfg.TTL
+		}
+	}
+	if value == "" {
+		return DefaultRegistryTTL
+	}
+	if minutes, err := strconv.Atoi(value); err == nil {
+		return time.Duration(minutes) * time.Minute
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return d
+	}
+	return DefaultRegistryTTL
+}
+
+// RegistryStatus records the last successful fetch of a registry.
+type RegistryStatus struct {
+	// URL is the registry URL that was fetched.
+	URL       string    `json:"url"`
+	FetchedAt time.Time `json:"fetched_at"`
+	// Commit is the fetched git commit, or the index ETag of HTTP
+	// registries.
+	Commit string `json:"commit,omitempty"`
+}
+
+// statusPath is where the registry's RegistryStatus is kept, next to its
+// directory.
+func (r Registry) statusPath() string {
+	return r.Dir() + ".json"
+}
+
+// Status returns the last successful fetch of the registry, or false if
+// it was never fetched.
+func (r Registry) Status() (RegistryStatus, bool) {
+	var status RegistryStatus
+	data, err := os.ReadFile(r.statusPath())
+	if err != nil || json.Unmarshal(data, &status) != nil {
+		return RegistryStatus{}, false
+	}
+	return status, true
+}
+
+// recordFetch records a successful fetch of the registry.
+func (r Registry) recordFetch() error {
+	status := RegistryStatus{URL: r.URL, FetchedAt: time.Now().UTC()}
+	if r.Type == RegistryHTTP {
+		var state httpState
+		if data, err := os.ReadFile(filepath.Join(r.Dir(), httpStateFile)); err == nil {
+			json.Unmarshal(data, &state)
+		}
+		status.Commit = state.ETag
+	} else if out, err := runGit(r.Dir(), "rev-parse", "HEAD"); err == nil {
+		status.Commit = strings.TrimSpace(string(out))
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.statusPath(), data, 0644)
+}
+
+// fresh reports whether the registry was fetched from its current URL
+// within ttl and its local copy still exists.
+func (r Registry) fresh(ttl time.Duration) bool {
+	status, ok := r.Status()
+	if !ok || status.URL != r.URL || time.Since(status.FetchedAt) >= ttl {
+		return false
+	}
+	_, err := os.Stat(r.Dir())
+	return err == nil
+}
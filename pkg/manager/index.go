@@ -0,0 +1,178 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// IndexFile is the package index a registry publishes next to its
+// packages, so that search and list do not have to read every package.
+const IndexFile = "index.json"
+
+// RegistryIndex is the parsed index.json of a registry.
+type RegistryIndex struct {
+	Packages []IndexEntry `json:"packages"`
+}
+
+// IndexEntry describes one package of a registry.
+type IndexEntry struct {
+	Name        string   `json:"name"`
+	Version     string   `json:"version"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	// Aliases lists every name the package defines: aliases, functions
+	// and executables.
+	Aliases []string `json:"aliases,omitempty"`
+	// Hash is the package's content hash, as recorded in ah.lock.
+	Hash string `json:"hash"`
+	// Tarball is the URL of the package archive, relative to the registry
+	// URL, and SHA256 its checksum. HTTP registries need both.
+	Tarball string `json:"tarball,omitempty"`
+	SHA256  string `json:"sha256,omitempty"`
+}
+
+// BuildIndex reads every package in a registry's package directory and
+// returns its index. Invalid packages are left out and reported as
+// problems (package name -> reason).
+func BuildIndex(contentDir string) (*RegistryIndex, map[string]string, error) {
+	entries, err := os.ReadDir(contentDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	index := &RegistryIndex{Packages: []IndexEntry{}}
+	problems := make(map[string]string)
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		dir := filepath.Join(contentDir, e.Name())
+		entry, err := indexPackage(dir)
+		if err != nil {
+			problems[e.Name()] = err.Error()
+			continue
+		}
+		if entry.Name != e.Name() {
+			problems[e.Name()] = fmt.Sprintf("ah.yaml names it %q", entry.Name)
+			continue
+		}
+		index.Packages = append(index.Packages, *entry)
+	}
+	sort.Slice(index.Packages, func(i, j int) bool { return index.Packages[i].Name < index.Packages[j].Name })
+	return index, problems, nil
+}
+
+// indexPackage builds the index entry of a package directory, describing
+// its highest version if it is kept in versioned subdirectories.
+func indexPackage(dir string) (*IndexEntry, error) {
+	dir = versionedDir(dir)
+	meta, err := LoadMetadata(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("'ah.yaml' missing")
+		}
+		return nil, err
+	}
+	content, err := LoadPackageContent(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("defines no aliases, functions, executables, env variables or dependencies")
+		}
+		return nil, err
+	}
+	hash, err := hashPackage(dirFiles(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	names := content.Names()
+	sort.Strings(names)
+	return &IndexEntry{
+		Name:        meta.Name,
+		Version:     meta.Version,
+		Description: meta.Description,
+		Tags:        meta.Tags,
+		Aliases:     names,
+		Hash:        hash,
+	}, nil
+}
+
+// WriteIndex builds the index of a registry's package directory and writes
+// it to index.json there. With outDir set, it instead writes the files an
+// HTTP registry serves to outDir: index.json and a tarball per package.
+// It returns the problems found (see BuildIndex).
+func WriteIndex(contentDir, outDir string) (*RegistryIndex, map[string]string, error) {
+	index, problems, err := BuildIndex(contentDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if outDir == "" {
+		outDir = contentDir
+	} else {
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			return nil, nil, err
+		}
+		for i, p := range index.Packages {
+			name := p.Name + "-" + p.Version + ".tar.gz"
+			sum, err := writeTarball(versionedDir(filepath.Join(contentDir, p.Name)), filepath.Join(outDir, name))
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to pack %s: %w", p.Name, err)
+			}
+			index.Packages[i].Tarball = name
+			index.Packages[i].SHA256 = sum
+		}
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+	return index, problems, os.WriteFile(filepath.Join(outDir, IndexFile), append(data, '\n'), 0644)
+}
+
+// loadIndex reads an index.json.
+func loadIndex(path string) (*RegistryIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseIndex(data)
+}
+
+// parseIndex parses an index.json. Entries with invalid names are dropped.
+func parseIndex(data []byte) (*RegistryIndex, error) {
+	var index RegistryIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", IndexFile, err)
+	}
+	valid := index.Packages[:0]
+	for _, p := range index.Packages {
+		if packageNamePattern.MatchString(p.Name) {
+			valid = append(valid, p)
+		}
+	}
+	index.Packages = valid
+	return &index, nil
+}
+
+// Index returns the registry's package index: its published index.json,
+// or for registries that do not publish one, an index built from the
+// clone.
+func (r Registry) Index() (*RegistryIndex, error) {
+	index, err := loadIndex(filepath.Join(r.ContentDir(), IndexFile))
+	if err == nil {
+		return index, nil
+	}
+	if !os.IsNotExist(err) {
+		fmt.Printf("Warning: %s of registry %s: %v (reading packages instead)\n", IndexFile, r.Name, err)
+	}
+	if _, err := os.Stat(r.ContentDir()); os.IsNotExist(err) {
+		return &RegistryIndex{}, nil
+	}
+	index, _, err = BuildIndex(r.ContentDir())
+	return index, err
+}
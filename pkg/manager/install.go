@@ -1,6 +1,7 @@
 package manager
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,35 +9,79 @@ import (
 
 	"bufio"
 
-	"github.com/sarkartanmay393/ah/pkg/parser"
+	"github.com/sarkartanmay393/ah/pkg/semver"
 )
 
-// InstallPackage installs a package from the central registry
-func InstallPackage(packageName string) error {
+// InstallPackage installs a package from the registries, or from a local
+// directory, git repository or archive (see ParseSource). A registry
+// package may carry a version constraint ("git-kit@^2.1"); the highest
+// version satisfying it is installed. renames maps aliases or functions of
+// the package to the names to compile them as; the conflict check and the
+// preview take them into account, and they are recorded in the overrides
+// once the package is enabled.
+func InstallPackage(packageName string, renames map[string]string) error {
 	if err := EnsureDirs(); err != nil {
 		return err
 	}
 
+	// Phase 0: Fetch a package given by source (NO LOCK - may be slow)
+	var targetDir, commit string
+	src, fromSource := ParseSource(packageName)
+	if fromSource {
+		var cleanup func()
+		var err error
+		targetDir, commit, cleanup, err = src.fetch()
+		defer cleanup()
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s: %w", src, err)
+		}
+	}
+	if !fromSource && strings.HasPrefix(packageName, "git+") {
+		return fmt.Errorf("invalid git source %q", packageName)
+	}
+	var constraint *semver.Constraint
+	if !fromSource {
+		var err error
+		if packageName, constraint, err = splitConstraint(packageName); err != nil {
+			return err
+		}
+	}
+
 	// Phase 1: Update registry and validate package (with lock)
 	var meta *PackageMetadata
-	var aliases []parser.AliasDef
-	var targetDir string
+	var content *PackageContent
+	var deps []DependencyStep
+	var renamed map[string]string
+	var reg *Registry
+	files := packageFiles(dirFiles(targetDir))
 
 	err := WithLock(func() error {
-		// 1. Update Registry
-		if err := UpdateRegistry(); err != nil {
-			return fmt.Errorf("failed to update registry: %w", err)
-		}
-
-		// 2. Find Package
 		var err error
-		targetDir, err = GetRegistryPackagePath(packageName)
-		if err != nil {
-			return err
+		if !fromSource {
+			// 1. Update Registry
+			if err := UpdateRegistry(); err != nil {
+				return fmt.Errorf("failed to update registry: %w", err)
+			}
+
+			// 2. Find Package (and the version to install)
+			var bare string
+			reg, bare, err = FindPackage(packageName)
+			if err != nil {
+				return err
+			}
+			targetDir = filepath.Join(reg.ContentDir(), bare)
+			if constraint != nil {
+				files, commit, err = reg.selectVersion(bare, constraint)
+				if err != nil {
+					return err
+				}
+			} else {
+				files, commit = reg.headFiles(bare)
+			}
 		}
 
 		// 3. Validate Package Structure & Load Metadata
-		meta, err = LoadMetadata(targetDir)
+		meta, err = loadMetadata(files)
 		if err != nil {
 			if os.IsNotExist(err) {
 				return fmt.Errorf("invalid package: 'ah.yaml' missing in %s", packageName)
@@ -44,23 +89,46 @@ func InstallPackage(packageName string) error {
 			return fmt.Errorf("invalid package metadata: %w", err)
 		}
 
-		aliasPath := filepath.Join(targetDir, "alias.sh")
-		if _, err := os.Stat(aliasPath); os.IsNotExist(err) {
-			return fmt.Errorf("invalid package: 'alias.sh' missing in %s", packageName)
+		// 4. Parse definitions (also used for the preview)
+		content, err = loadContent(files, targetDir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("invalid package: %s defines no aliases, functions, executables, env variables or dependencies", packageName)
+			}
+			return fmt.Errorf("failed to read package: %w", err)
 		}
 
-		// 4. Conflict Check (ATOMIC due to lock)
-		conflicts, err := CheckConflicts(targetDir)
+		// 5. Conflict Check (ATOMIC due to lock). An enabled package of the
+		// same name (possibly from another registry) is being replaced.
+		_, bare := splitPackageName(packageName)
+		if fromSource {
+			if !packageNamePattern.MatchString(meta.Name) {
+				return fmt.Errorf("invalid package: name %q in ah.yaml is not a valid package name", meta.Name)
+			}
+			bare = meta.Name
+		}
+		o, err := LoadOverrides()
 		if err != nil {
-			fmt.Printf("Warning: Failed to check conflicts: %v\n", err)
+			return err
 		}
-		if len(conflicts) > 0 {
-			return &ConflictError{Conflicts: conflicts}
+		if err := o.renameAll(bare, content, renames); err != nil {
+			return err
+		}
+		// Dependencies are checked together with the package.
+		lock, err := LoadLockfile()
+		if err != nil {
+			return err
+		}
+		named := *meta
+		named.Name = bare
+		deps, err = lock.planDependencies(o, &named, content)
+		if err != nil {
+			return err
 		}
 
-		// 5. Parse aliases for preview
-		aliases, _ = parser.ParseAliases(aliasPath)
-
+		// Preview the definitions as they will be compiled
+		renamed = o.Renames[bare]
+		content = o.expose(bare, content)
 		return nil
 	})
 
@@ -75,10 +143,50 @@ func InstallPackage(packageName string) error {
 	if meta.Website != "" {
 		fmt.Printf("🔗 Web:     %s\n", meta.Website)
 	}
-	fmt.Printf("\nContains %d aliases:\n", len(aliases))
-	for _, a := range aliases {
+	fmt.Printf("\nContains %d aliases:\n", len(content.Aliases))
+	for _, a := range content.Aliases {
 		fmt.Printf("  %s = %s\n", a.Name, a.Command)
 	}
+	if len(content.Functions) > 0 {
+		fmt.Printf("\nContains %d functions:\n", len(content.Functions))
+		for _, f := range content.Functions {
+			fmt.Printf("  %s() { %s }\n", f.Name, oneLine(f.Body))
+		}
+	}
+	if len(content.Env) > 0 {
+		fmt.Printf("\nSets %d env variables:\n", len(content.Env))
+		for _, v := range content.Env {
+			if v.IfUnset {
+				fmt.Printf("  %s = %s (if unset)\n", v.Name, v.Value)
+			} else {
+				fmt.Printf("  %s = %s\n", v.Name, v.Value)
+			}
+		}
+	}
+	if len(content.Shims) > 0 {
+		fmt.Printf("\nShips %d executables (linked into ~/.ah/bin):\n", len(content.Shims))
+		for _, name := range content.Shims {
+			fmt.Printf("  %s\n", name)
+		}
+	}
+	if len(renamed) > 0 {
+		fmt.Printf("\nRenamed by you:\n")
+		for _, name := range sortedKeys(renamed) {
+			fmt.Printf("  %s -> %s\n", name, renamed[name])
+		}
+	}
+	if len(deps) > 0 {
+		fmt.Printf("\nNeeds %d packages:\n", len(deps))
+		for _, d := range deps {
+			fmt.Printf("  %s\n", d)
+		}
+	}
+	if diags := content.Warnings(); len(diags) > 0 {
+		fmt.Printf("\n⚠️  %d problems found in package files:\n", len(diags))
+		for _, d := range diags {
+			fmt.Printf("  %s\n", d)
+		}
+	}
 	fmt.Print("\nProceed to enable? [Y/n]: ")
 
 	reader := bufio.NewReader(os.Stdin)
@@ -90,33 +198,282 @@ func InstallPackage(packageName string) error {
 		return nil
 	}
 
-	// Phase 3: Enable package (with lock again)
-	return EnablePackage(packageName)
+	// Phase 3: Enable package (with lock again) at the revision shown
+	return WithLock(func() error {
+		lock, err := LoadLockfile()
+		if err != nil {
+			return err
+		}
+		_, name := splitPackageName(packageName)
+		if fromSource {
+			name = meta.Name
+			err = lock.pinSource(src, name, files, commit)
+		} else if err = lock.pinRevision(reg, name, files, commit); err == nil && constraint != nil {
+			entry := lock.Packages[name]
+			entry.Constraint = constraint.String()
+			lock.Packages[name] = entry
+		}
+		if err != nil {
+			return fmt.Errorf("failed to pin %s: %w", name, err)
+		}
+		if err := lock.enableDependencies(name); err != nil {
+			return err
+		}
+		if len(renames) == 0 {
+			return finishEnable(lock, name)
+		}
+
+		// Record the renames, and drop them again if enabling fails.
+		o, err := LoadOverrides()
+		if err != nil {
+			return err
+		}
+		pinned, err := lock.loadContent(name)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		previous := o.Renames[name]
+		if err := o.renameAll(name, pinned, renames); err != nil {
+			return err
+		}
+		if err := o.Save(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", OverridesFile, err)
+		}
+		if err := finishEnable(lock, name); err != nil {
+			o.Renames[name] = previous
+			if err := o.Save(); err != nil {
+				fmt.Printf("Warning: Failed to write %s: %v\n", OverridesFile, err)
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// splitConstraint splits a registry package name of the form
+// "name@constraint". The constraint is nil if there is none.
+func splitConstraint(packageName string) (string, *semver.Constraint, error) {
+	name, c, ok := strings.Cut(packageName, "@")
+	if !ok {
+		return packageName, nil, nil
+	}
+	constraint, err := semver.ParseConstraint(c)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid version constraint: %w", err)
+	}
+	return name, constraint, nil
+}
+
+// PinPackage pins a registry package (optionally "name@constraint") in
+// ah.lock at the version 'ah install' would pick, without enabling it, so
+// that the conflict UI can enable it at that revision (EnableIfResolved)
+// once nothing conflicts. An enabled package keeps its pin.
+func PinPackage(packageName string) error {
+	name, constraint, err := splitConstraint(packageName)
+	if err != nil {
+		return err
+	}
+	return WithLock(func() error {
+		lock, err := LoadLockfile()
+		if err != nil {
+			return err
+		}
+		reg, bare, err := lock.findPackage(name)
+		if err != nil {
+			return err
+		}
+		root, err := GetRootDir()
+		if err != nil {
+			return err
+		}
+		if _, err := os.Lstat(filepath.Join(root, ActiveDir, bare)); err == nil {
+			return nil
+		}
+
+		var files packageFiles
+		var commit string
+		if constraint != nil {
+			if files, commit, err = reg.selectVersion(bare, constraint); err != nil {
+				return err
+			}
+		} else {
+			files, commit = reg.headFiles(bare)
+		}
+		if err := lock.pinRevision(reg, bare, files, commit); err != nil {
+			return fmt.Errorf("failed to pin %s: %w", bare, err)
+		}
+		if constraint != nil {
+			entry := lock.Packages[bare]
+			entry.Constraint = constraint.String()
+			lock.Packages[bare] = entry
+		}
+		if err := lock.Save(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", LockFile, err)
+		}
+		return nil
+	})
+}
+
+// PendingConflicts returns the conflicts (name -> package) enabling a
+// pinned package would cause, including those of the dependencies it
+// would enable, and the package's content at its pinned revision.
+func PendingConflicts(packageName string) (map[string]string, *PackageContent, error) {
+	var conflicts map[string]string
+	var content *PackageContent
+	err := WithLock(func() error {
+		lock, err := LoadLockfile()
+		if err != nil {
+			return err
+		}
+		conflicts, content, err = lock.pendingConflicts(packageName)
+		return err
+	})
+	return conflicts, content, err
+}
+
+// pendingConflicts implements PendingConflicts. Assumes LOCK IS HELD.
+func (l *Lockfile) pendingConflicts(packageName string) (map[string]string, *PackageContent, error) {
+	_, packageName = splitPackageName(packageName)
+	if _, ok := l.Packages[packageName]; !ok {
+		return nil, nil, fmt.Errorf("package %s is not installed", packageName)
+	}
+	meta, err := loadMetadata(l.pinnedFiles(packageName))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid package metadata: %w", err)
+	}
+	content, err := l.loadContent(packageName)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	o, err := LoadOverrides()
+	if err != nil {
+		return nil, nil, err
+	}
+	named := *meta
+	named.Name = packageName
+	_, err = l.planDependencies(o, &named, content)
+	var conflictErr *ConflictError
+	if errors.As(err, &conflictErr) {
+		return conflictErr.Conflicts, content, nil
+	}
+	return nil, content, err
+}
+
+// EnableIfResolved enables a pinned package, at its pinned revision, if
+// enabling it causes no conflicts (see PendingConflicts). It reports
+// whether the package was enabled; an enabled package is left alone.
+func EnableIfResolved(packageName string) (bool, error) {
+	_, packageName = splitPackageName(packageName)
+	enabled := false
+	err := WithLock(func() error {
+		root, err := GetRootDir()
+		if err != nil {
+			return err
+		}
+		if _, err := os.Lstat(filepath.Join(root, ActiveDir, packageName)); err == nil {
+			return nil
+		}
+		lock, err := LoadLockfile()
+		if err != nil {
+			return err
+		}
+		conflicts, _, err := lock.pendingConflicts(packageName)
+		if err != nil || len(conflicts) > 0 {
+			return err
+		}
+		if err := enablePackageInternal(packageName, false); err != nil {
+			return err
+		}
+		enabled = true
+		return nil
+	})
+	return enabled, err
 }
 
-// EnablePackage links a package from the REGISTRY to active
+// EnablePackage copies a package from the REGISTRY into the store, pins
+// it to the current registry revision and links it into active.
 func EnablePackage(packageName string) error {
 	return WithLock(func() error {
-		return enablePackageInternal(packageName)
+		return enablePackageInternal(packageName, true)
 	})
 }
 
-// enablePackageInternal performs the symlink and compile updates.
+// enablePackageInternal performs the pin, store, symlink and compile
+// updates, and enables the package's dependencies first. With repin false
+// an existing pin in ah.lock is kept, so the package is enabled at the
+// version it was installed at.
 // Assumes LOCK IS HELD.
-func enablePackageInternal(packageName string) error {
-	root, err := GetRootDir()
+func enablePackageInternal(packageName string, repin bool) error {
+	lock, err := LoadLockfile()
 	if err != nil {
 		return err
 	}
+	// The name may be qualified with a registry; active names are not.
+	qualified := packageName
+	_, packageName = splitPackageName(qualified)
+	if _, pinned := lock.Packages[packageName]; repin || !pinned {
+		reg, _, err := lock.findPackage(qualified)
+		if err != nil {
+			return err
+		}
+		if err := lock.pin(reg, packageName); err != nil {
+			return fmt.Errorf("failed to pin %s: %w", packageName, err)
+		}
+	} else if _, err := lock.ensureStored(packageName); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", packageName, err)
+	}
+	if err := lock.enableDependencies(packageName); err != nil {
+		return err
+	}
+	return finishEnable(lock, packageName)
+}
+
+// finishEnable saves a lockfile in which a package was just pinned, links
+// the package into active and rebuilds the compiled definitions and shims.
+// Assumes LOCK IS HELD.
+func finishEnable(lock *Lockfile, packageName string) error {
+	if err := lock.Save(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", LockFile, err)
+	}
+
+	if err := activatePackage(lock, packageName); err != nil {
+		return err
+	}
 
-	// Source is now in REGISTRY (Monorepo structure: registry/pkg)
-	contentDir, err := GetRegistryContentDir()
+	fmt.Printf("Enabled package: %s\n", packageName)
+
+	// Internal update
+	if err := CompileAliases(); err != nil {
+		fmt.Printf("Warning: Failed to compile aliases: %v\n", err)
+	}
+	if err := syncShims(); err != nil {
+		fmt.Printf("Warning: Failed to link executables: %v\n", err)
+	}
+	if _, err := collectGarbage(); err != nil {
+		fmt.Printf("Warning: Failed to clean up old versions: %v\n", err)
+	}
+	return bumpStateGeneration()
+}
+
+// activatePackage links a pinned package into active: its copy in the
+// store, or the registry checkout for packages that have none.
+// Assumes LOCK IS HELD.
+func activatePackage(lock *Lockfile, packageName string) error {
+	root, err := GetRootDir()
 	if err != nil {
 		return err
 	}
-	source := filepath.Join(contentDir, packageName)
 	target := filepath.Join(root, ActiveDir, packageName)
 
+	// Source is the immutable copy in the store (packages/<name>/<version>)
+	source := storePath(lock.Packages[packageName].Store)
+	if lock.Packages[packageName].Store == "" {
+		reg := lock.registryOf(packageName)
+		if reg == nil {
+			return fmt.Errorf("package %s not found in local registry", packageName)
+		}
+		source = filepath.Join(reg.ContentDir(), packageName)
+	}
 	if _, err := os.Stat(source); os.IsNotExist(err) {
 		return fmt.Errorf("package %s not found in local registry", packageName)
 	}
@@ -127,12 +484,15 @@ func enablePackageInternal(packageName string) error {
 	if err := os.Symlink(source, target); err != nil {
 		return fmt.Errorf("failed to symlink: %w", err)
 	}
+	return nil
+}
 
-	fmt.Printf("Enabled package: %s\n", packageName)
-
-	// Internal update
-	if err := CompileAliases(); err != nil {
-		fmt.Printf("Warning: Failed to compile aliases: %v\n", err)
+// oneLine collapses a multi-line function body for display, truncating
+// long bodies.
+func oneLine(body string) string {
+	s := strings.Join(strings.Fields(body), " ")
+	if len(s) > 60 {
+		s = s[:57] + "..."
 	}
-	return updateStateTimestamp()
+	return s
 }
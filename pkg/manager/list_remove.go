@@ -31,8 +31,10 @@ func ListPackages() ([]string, error) {
 	return packages, nil
 }
 
-// RemovePackage removes a package from the active directory.
-// Returns an error if the package is not currently enabled.
+// RemovePackage removes a package from the active directory, together
+// with the user's overrides and conflict resolutions for it, so that a
+// later install starts afresh. Returns an error if the package is not
+// currently enabled.
 func RemovePackage(packageName string) error {
 	return WithLock(func() error {
 		root, err := GetRootDir()
@@ -45,16 +47,53 @@ func RemovePackage(packageName string) error {
 		if _, err := os.Lstat(symlinkPath); os.IsNotExist(err) {
 			return fmt.Errorf("package '%s' is not installed", packageName)
 		}
+		lock, err := LoadLockfile()
+		if err != nil {
+			return err
+		}
+		if err := checkNoDependents(lock, packageName, "remove"); err != nil {
+			return err
+		}
 
 		// 2. Remove Symlink
 		if err := os.Remove(symlinkPath); err != nil {
 			return fmt.Errorf("failed to remove package: %w", err)
 		}
 
-		// 3. Recompile aliases
+		// 3. Drop the pin
+		if _, ok := lock.Packages[packageName]; ok {
+			delete(lock.Packages, packageName)
+			if err := lock.Save(); err != nil {
+				fmt.Printf("Warning: Failed to update %s: %v\n", LockFile, err)
+			}
+		}
+
+		// 4. Forget the user's choices about it
+		if o, err := LoadOverrides(); err != nil {
+			fmt.Printf("Warning: Failed to read %s: %v\n", OverridesFile, err)
+		} else if o.forget(packageName) {
+			if err := o.Save(); err != nil {
+				fmt.Printf("Warning: Failed to update %s: %v\n", OverridesFile, err)
+			}
+		}
+		if r, err := LoadResolutions(); err != nil {
+			fmt.Printf("Warning: Failed to read %s: %v\n", ResolutionsFile, err)
+		} else if r.forget(packageName) {
+			if err := r.Save(); err != nil {
+				fmt.Printf("Warning: Failed to update %s: %v\n", ResolutionsFile, err)
+			}
+		}
+
+		// 5. Recompile aliases and drop the package's stored versions
 		if err := CompileAliases(); err != nil {
 			fmt.Printf("Warning: Failed to compile aliases: %v\n", err)
 		}
-		return updateStateTimestamp()
+		if _, err := collectGarbage(); err != nil {
+			fmt.Printf("Warning: Failed to clean up old versions: %v\n", err)
+		}
+		if err := syncShims(); err != nil {
+			fmt.Printf("Warning: Failed to link executables: %v\n", err)
+		}
+		return bumpStateGeneration()
 	})
 }
@@ -0,0 +1,378 @@
+package manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Lockfile is the parsed ah.lock. It pins every installed package to the
+// registry revision it was installed at, so that pulling the registry does
+// not change the user's shell until they upgrade explicitly.
+type Lockfile struct {
+	Packages map[string]LockEntry `yaml:"packages"`
+}
+
+// LockEntry pins one package.
+type LockEntry struct {
+	// Commit is the registry commit the package was installed at. It is
+	// empty if the registry is not a git checkout, in which case the
+	// package is read from disk.
+	Commit string `yaml:"commit,omitempty"`
+	// Version is the package version from its ah.yaml.
+	Version string `yaml:"version,omitempty"`
+	// Hash is the sha256 of the package's files at that commit.
+	Hash string `yaml:"hash"`
+	// Store is the package's copy under ~/.ah/packages ("name/version").
+	// It is empty for packages that did not come from the registry.
+	Store string `yaml:"store,omitempty"`
+	// Registry is the name of the registry the package was installed
+	// from. Empty means the public registry.
+	Registry string `yaml:"registry,omitempty"`
+	// Source is where a package installed from outside the registries
+	// came from (see ParseSource). Upgrades fetch it again.
+	Source string `yaml:"source,omitempty"`
+	// Constraint is the version constraint the package was installed with
+	// ("ah install git-kit@^2.1"). Upgrades stay within it.
+	Constraint string `yaml:"constraint,omitempty"`
+	// Path is the versioned subdirectory of the package the revision was
+	// read from at Commit ("2.1.0"), if the registry keeps versions in
+	// subdirectories.
+	Path string `yaml:"path,omitempty"`
+}
+
+// registry returns the name of the registry the entry was installed from.
+func (e LockEntry) registry() string {
+	if e.Registry == "" {
+		return DefaultRegistry
+	}
+	return e.Registry
+}
+
+// LoadLockfile reads ~/.ah/ah.lock. A missing file yields an empty lockfile.
+func LoadLockfile() (*Lockfile, error) {
+	root, err := GetRootDir()
+	if err != nil {
+		return nil, err
+	}
+
+	lock := &Lockfile{Packages: make(map[string]LockEntry)}
+	data, err := os.ReadFile(filepath.Join(root, LockFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return lock, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", LockFile, err)
+	}
+	if lock.Packages == nil {
+		lock.Packages = make(map[string]LockEntry)
+	}
+	return lock, nil
+}
+
+// Save writes the lockfile atomically. Assumes LOCK IS HELD.
+func (l *Lockfile) Save() error {
+	root, err := GetRootDir()
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	data = append([]byte("# Auto-generated by ah. Do not edit.\n"), data...)
+
+	lockPath := filepath.Join(root, LockFile)
+	tmp := lockPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, lockPath)
+}
+
+// pin records the current revision of a package in a registry and copies
+// it into the store. Without a registry, whatever is enabled is pinned.
+func (l *Lockfile) pin(reg *Registry, packageName string) error {
+	if reg == nil {
+		root, err := GetRootDir()
+		if err != nil {
+			return err
+		}
+		return l.pinRevision(nil, packageName, dirFiles(filepath.Join(root, ActiveDir, packageName)), "")
+	}
+	files, commit := reg.headFiles(packageName)
+	return l.pinRevision(reg, packageName, files, commit)
+}
+
+// pinRevision records the given revision of a package and copies it into
+// the store if it came from a registry.
+func (l *Lockfile) pinRevision(reg *Registry, packageName string, files packageFiles, commit string) error {
+	entry := LockEntry{Commit: commit}
+	if reg == nil {
+		return l.pinFiles(packageName, files, entry, false)
+	}
+	if reg.Name != DefaultRegistry {
+		entry.Registry = reg.Name
+	}
+	entry.Path = reg.versionPath(packageName, files)
+	return l.pinFiles(packageName, files, entry, true)
+}
+
+// pinFiles completes entry with the hash and version of a package
+// revision and records it, copying the files into the store if store is
+// set.
+func (l *Lockfile) pinFiles(packageName string, files packageFiles, entry LockEntry, store bool) error {
+	hash, err := hashPackage(files)
+	if err != nil {
+		return fmt.Errorf("failed to hash %s: %w", packageName, err)
+	}
+	entry.Hash = hash
+	if meta, err := loadMetadata(files); err == nil {
+		entry.Version = meta.Version
+	}
+	if store {
+		if entry.Store, err = storePackage(files, packageName, hash); err != nil {
+			return err
+		}
+	}
+	l.Packages[packageName] = entry
+	return nil
+}
+
+// ensureStored copies a pinned package into the store if it is not there
+// yet (it was pinned by an older version of ah, or its copy was deleted)
+// and reports whether the entry changed.
+func (l *Lockfile) ensureStored(packageName string) (bool, error) {
+	entry, ok := l.Packages[packageName]
+	if !ok {
+		return false, nil
+	}
+	if entry.Store != "" {
+		if _, err := os.Stat(storePath(entry.Store)); err == nil {
+			return false, nil
+		}
+	} else if reg := l.registryOf(packageName); entry.Source != "" || (entry.Commit == "" && (reg == nil || !reg.Has(packageName))) {
+		return false, nil
+	}
+
+	store, err := storePackage(l.pinnedFiles(packageName), packageName, entry.Hash)
+	if err != nil {
+		return false, err
+	}
+	entry.Store = store
+	l.Packages[packageName] = entry
+	return true, nil
+}
+
+// ensurePinned pins a package enabled by an older version of ah and moves
+// it into the store, pointing its active link at the copy. It reports
+// whether the lockfile changed. Assumes LOCK IS HELD.
+func (l *Lockfile) ensurePinned(packageName string) (bool, error) {
+	changed := false
+	if _, ok := l.Packages[packageName]; !ok {
+		// Not from any registry if no registry has it.
+		reg, _, _ := l.findPackage(packageName)
+		if err := l.pin(reg, packageName); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+	stored, err := l.ensureStored(packageName)
+	if err != nil {
+		return changed, err
+	}
+
+	entry := l.Packages[packageName]
+	if entry.Store == "" {
+		return changed || stored, nil
+	}
+	root, err := GetRootDir()
+	if err != nil {
+		return changed || stored, err
+	}
+	link := filepath.Join(root, ActiveDir, packageName)
+	target := storePath(entry.Store)
+	current, err := os.Readlink(link)
+	if err != nil || current == target {
+		// Not a symlink (a package the user placed there) or up to date.
+		return changed || stored, nil
+	}
+	if err := os.Remove(link); err != nil {
+		return changed || stored, err
+	}
+	return changed || stored, os.Symlink(target, link)
+}
+
+// installedVersion returns the version a package is pinned at, or "".
+func (l *Lockfile) installedVersion(packageName string) string {
+	entry, ok := l.Packages[packageName]
+	if !ok {
+		return ""
+	}
+	if entry.Version != "" {
+		return entry.Version
+	}
+	if meta, err := loadMetadata(l.pinnedFiles(packageName)); err == nil {
+		return meta.Version
+	}
+	return ""
+}
+
+// registryOf returns the configured registry a pinned package was
+// installed from, or nil.
+func (l *Lockfile) registryOf(packageName string) *Registry {
+	entry, ok := l.Packages[packageName]
+	if !ok || entry.Source != "" {
+		return nil
+	}
+	reg, err := findRegistry(entry.registry())
+	if err != nil {
+		return nil
+	}
+	return reg
+}
+
+// pinnedFiles returns the files of an enabled package at its pinned
+// revision: its copy in the store, or for packages not stored yet the
+// pinned registry commit. Packages without either are read from the
+// active directory (see PinWarnings).
+func (l *Lockfile) pinnedFiles(packageName string) packageFiles {
+	files, _ := l.pinnedRevision(packageName)
+	return files
+}
+
+// pinnedRevision implements pinnedFiles. The warning says why a pinned
+// registry commit could not be read, if it could not.
+func (l *Lockfile) pinnedRevision(packageName string) (packageFiles, string) {
+	root, _ := GetRootDir()
+	activePath := dirFiles(filepath.Join(root, ActiveDir, packageName))
+
+	entry, ok := l.Packages[packageName]
+	if !ok {
+		return activePath, ""
+	}
+	if entry.Store != "" {
+		if _, err := os.Stat(storePath(entry.Store)); err == nil {
+			return dirFiles(storePath(entry.Store)), ""
+		}
+	}
+	if entry.Commit == "" || entry.Source != "" {
+		return activePath, ""
+	}
+	reg := l.registryOf(packageName)
+	if reg == nil {
+		return activePath, fmt.Sprintf("%s was installed from registry %s, which is not configured (using current files)", packageName, entry.registry())
+	}
+	if _, err := runGit(reg.Dir(), "cat-file", "-e", entry.Commit+"^{commit}"); err != nil {
+		return activePath, fmt.Sprintf("%s is pinned to %.12s, which is not in the registry (using current files)", packageName, entry.Commit)
+	}
+	files := reg.gitFiles(entry.Commit, packageName)
+	if entry.Path != "" {
+		return subFiles(files, entry.Path), ""
+	}
+	return files, ""
+}
+
+// PinWarnings returns, for the enabled packages whose pinned revision
+// cannot be read, why not; they are read from their current files
+// instead.
+func PinWarnings() ([]string, error) {
+	lock, err := LoadLockfile()
+	if err != nil {
+		return nil, err
+	}
+	pkgs, err := ListPackages()
+	if err != nil {
+		return nil, err
+	}
+	var warnings []string
+	for _, pkg := range pkgs {
+		if _, warning := lock.pinnedRevision(pkg); warning != "" {
+			warnings = append(warnings, warning)
+		}
+	}
+	return warnings, nil
+}
+
+// LoadActiveContent returns the content of an enabled package at the
+// revision pinned in ah.lock.
+func LoadActiveContent(packageName string) (*PackageContent, error) {
+	lock, err := LoadLockfile()
+	if err != nil {
+		return nil, err
+	}
+	return lock.loadContent(packageName)
+}
+
+func (l *Lockfile) loadContent(packageName string) (*PackageContent, error) {
+	root, err := GetRootDir()
+	if err != nil {
+		return nil, err
+	}
+	return loadContent(l.pinnedFiles(packageName), filepath.Join(root, ActiveDir, packageName))
+}
+
+// VerifyLock checks that every enabled package is pinned and that its
+// pinned files still match the recorded hash. It returns a problem per
+// package that fails.
+func VerifyLock() (map[string]string, error) {
+	lock, err := LoadLockfile()
+	if err != nil {
+		return nil, err
+	}
+	pkgs, err := ListPackages()
+	if err != nil {
+		return nil, err
+	}
+
+	problems := make(map[string]string)
+	for _, pkg := range pkgs {
+		entry, ok := lock.Packages[pkg]
+		if !ok {
+			problems[pkg] = "not pinned in " + LockFile
+			continue
+		}
+		hash, err := hashPackage(lock.pinnedFiles(pkg))
+		if err != nil {
+			problems[pkg] = err.Error()
+		} else if hash != entry.Hash {
+			problems[pkg] = "files do not match the pinned hash"
+		}
+	}
+	return problems, nil
+}
+
+// hashPackage returns a sha256 over the names, modes and contents of all
+// files of a package (as walkPackage defines them).
+func hashPackage(files packageFiles) (string, error) {
+	h := sha256.New()
+	err := walkPackage(files, ".", func(name string, e fs.DirEntry) error {
+		if e.IsDir() {
+			return nil
+		}
+		data, err := files.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		mode := fs.FileMode(0644)
+		if isExecutable(e) {
+			mode = 0755
+		}
+		fmt.Fprintf(h, "%s %o %d\n", name, mode, len(data))
+		h.Write(data)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
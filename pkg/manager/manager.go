@@ -7,24 +7,44 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
-	"time"
 
-	"github.com/sarkartanmay393/ah/pkg/parser"
+	"github.com/sarkartanmay393/ah/pkg/shell"
 )
 
 // Directory and file name constants for the ah data directory (~/.ah).
 const (
 	// RootDirName is the name of the ah data directory in the user's home.
 	RootDirName = ".ah"
-	// ActiveDir stores symlinks to enabled packages.
+	// ActiveDir stores symlinks to enabled packages (into StoreDir).
 	ActiveDir = "active"
-	// BinDir stores executable scripts (reserved for future use).
+	// StoreDir holds immutable copies of installed packages, one directory
+	// per version (packages/<name>/<version>).
+	StoreDir = "packages"
+	// BinDir stores links to the executables shipped by enabled packages.
+	// Packages ship them in a directory of the same name.
 	BinDir = "bin"
-	// StateFile tracks the last modification time for live reload.
+	// StateFile holds a generation counter, bumped on every change, that
+	// the shell hooks compare against on each prompt for live reload.
 	StateFile = "state"
 	// EnvFile is the shell script sourced by the user's shell.
 	EnvFile = "env.sh"
+	// CompiledFile holds all active definitions, sourced by env.sh.
+	CompiledFile = "aliases.compiled.sh"
+	// CompiledFishFile holds all active definitions, sourced by env.fish.
+	CompiledFishFile = "aliases.compiled.fish"
+	// LockFile pins each installed package to a registry revision.
+	LockFile = "ah.lock"
+	// OverridesFile holds the user's disabled definitions and conflict
+	// choices, applied on top of package content when compiling.
+	OverridesFile = "overrides.yaml"
+	// ResolutionsFile holds the conflict decisions made in the conflict UI.
+	ResolutionsFile = "resolutions.yaml"
+	// RegistriesFile lists the configured registries in resolution order.
+	RegistriesFile = "registries.yaml"
 	// RegistryRepo is the default Git repository URL for the package registry.
 	RegistryRepo = "https://github.com/sarkartanmay393/ah"
 )
@@ -32,7 +52,8 @@ const (
 // ConflictError is returned when installing a package would create
 // alias name collisions with already-enabled packages.
 type ConflictError struct {
-	// Conflicts maps alias names to the package that already defines them.
+	// Conflicts maps alias names (or "$NAME" for env variables) to the
+	// package that already defines them.
 	Conflicts map[string]string
 }
 
@@ -59,6 +80,7 @@ func EnsureDirs() error {
 	dirs := []string{
 		root,
 		filepath.Join(root, ActiveDir),
+		filepath.Join(root, StoreDir),
 		filepath.Join(root, BinDir),
 	}
 
@@ -67,59 +89,23 @@ func EnsureDirs() error {
 			return err
 		}
 	}
+	migrateLegacyRegistry()
 	return GenerateEnvFile()
 }
 
+// GenerateEnvFile writes the env file of every supported shell (env.sh for
+// bash/zsh, env.fish), which source the compiled definitions and install
+// the live update hook.
 func GenerateEnvFile() error {
 	root, err := GetRootDir()
 	if err != nil {
 		return err
 	}
 
-	envPath := filepath.Join(root, EnvFile)
-	content := fmt.Sprintf(`#!/bin/sh
-# Auto-generated by ah
-AH_ROOT="%s"
-AH_COMPILED="$AH_ROOT/aliases.compiled.sh"
-
-# 1. Source Compiled Aliases
-if [ -f "$AH_COMPILED" ]; then
-  source "$AH_COMPILED"
-fi
-
-# 2. Define Live Update Hook
-ah_check_state() {
-	local state_file="$AH_ROOT/state"
-	if [ -f "$state_file" ]; then
-		# Cross-platform stat (BSD/Mac vs GNU/Linux)
-		local current_mtime=""
-		if stat -f "%%m" "$state_file" >/dev/null 2>&1; then
-			current_mtime=$(stat -f "%%m" "$state_file")
-		else
-			current_mtime=$(stat -c "%%Y" "$state_file" 2>/dev/null)
-		fi
-
-		# If timestamp changed, re-source this file
-		if [ -n "$current_mtime" ] && [ "$current_mtime" != "$AH_LAST_MTIME" ]; then
-			export AH_LAST_MTIME="$current_mtime"
-			source "$AH_ROOT/env.sh"
-		fi
-	fi
-}
-
-# 3. Register Hook
-if [ -n "$ZSH_VERSION" ]; then
-	autoload -Uz add-zsh-hook
-	add-zsh-hook precmd ah_check_state
-elif [ -n "$BASH_VERSION" ]; then
-	if [[ "$PROMPT_COMMAND" != *"ah_check_state"* ]]; then
-		PROMPT_COMMAND="ah_check_state; $PROMPT_COMMAND"
-	fi
-fi
-`, root)
-
-	if err := os.WriteFile(envPath, []byte(content), 0644); err != nil {
-		return err
+	for name, content := range shell.EnvFiles(root) {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			return err
+		}
 	}
 	return TouchState()
 }
@@ -146,7 +132,7 @@ func WithLock(action func() error) error {
 	return action()
 }
 
-// TouchState updates the state file timestamp and re-compiles aliases.
+// TouchState bumps the state generation and re-compiles aliases.
 // It uses WithLock internally.
 func TouchState() error {
 	return WithLock(func() error {
@@ -154,55 +140,120 @@ func TouchState() error {
 		if err := CompileAliases(); err != nil {
 			fmt.Printf("Warning: Failed to compile aliases: %v\n", err)
 		}
-		return updateStateTimestamp()
+		if err := syncShims(); err != nil {
+			fmt.Printf("Warning: Failed to link executables: %v\n", err)
+		}
+		return bumpStateGeneration()
 	})
 }
 
 // Internal helper (assumes lock is held)
-func updateStateTimestamp() error {
+func bumpStateGeneration() error {
 	root, err := GetRootDir()
 	if err != nil {
 		return err
 	}
 	statePath := filepath.Join(root, StateFile)
 
-	// Create if not exists, or update timestamp
-	f, err := os.OpenFile(statePath, os.O_RDONLY|os.O_CREATE, 0644)
-	if err != nil {
+	// Older versions left the file empty and relied on its mtime; that
+	// reads as generation 0.
+	gen := readStateGeneration(statePath)
+
+	// Write atomically so a prompt never reads a half-written counter.
+	tmp := statePath + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatUint(gen+1, 10)+"\n"), 0644); err != nil {
 		return err
 	}
-	f.Close()
+	return os.Rename(tmp, statePath)
+}
 
-	now := time.Now()
-	return os.Chtimes(statePath, now, now)
+// readStateGeneration returns the counter stored in the state file, or 0.
+func readStateGeneration(statePath string) uint64 {
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return 0
+	}
+	gen, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return gen
 }
 
-// CheckConflicts returns a list of conflicts (alias name -> existing source)
+// CheckConflicts returns a list of conflicts (alias or function name ->
+// existing source). Env variables set to different values are reported
+// as "$NAME".
 func CheckConflicts(newPackagePath string) (map[string]string, error) {
-	newAliases, err := parser.ParseAliases(filepath.Join(newPackagePath, "alias.sh"))
+	return checkConflicts(newPackagePath, "")
+}
+
+// checkConflicts implements CheckConflicts, ignoring the active package
+// named skip (the package being upgraded).
+func checkConflicts(newPackagePath, skip string) (map[string]string, error) {
+	newContent, err := LoadPackageContent(newPackagePath)
 	if err != nil {
-		// If alias.sh doesn't exist or weird format, just skip conflict check for now
+		// If the package has no definitions or is unreadable, just skip conflict check for now
 		return nil, nil // non-fatal
 	}
+	pkg := skip
+	if pkg == "" {
+		if meta, err := LoadMetadata(newPackagePath); err == nil {
+			pkg = meta.Name
+		}
+	}
+	overrides, err := LoadOverrides()
+	if err != nil {
+		return nil, err
+	}
+	return checkContentConflicts(overrides, pkg, newContent, skip)
+}
+
+// checkContentConflicts implements checkConflicts for the parsed content
+// of package pkg, ignoring the active packages named in skip. The given
+// overrides (the user's, possibly with pending changes) apply to both
+// sides: disabled definitions and names owned by another package cannot
+// conflict, and renamed ones conflict by their new name. Resolutions
+// count pkg and the skipped packages as enabled, as they are about to be;
+// overrides itself is not changed.
+func checkContentConflicts(overrides *Overrides, pkg string, newContent *PackageContent, skip ...string) (map[string]string, error) {
+	if newContent == nil {
+		return nil, nil
+	}
 
 	conflicts := make(map[string]string)
 
-	// Scan active packages
+	// Scan active packages (at their pinned revisions)
+	lock, err := LoadLockfile()
+	if err != nil {
+		return nil, err
+	}
+	overrides = overrides.activating(append([]string{pkg}, skip...)...)
+	newContent = overrides.apply(pkg, newContent)
+	newNames := newContent.Names()
 	root, _ := GetRootDir()
 	activeDir := filepath.Join(root, ActiveDir)
 	entries, _ := os.ReadDir(activeDir)
 
 	for _, entry := range entries {
-		pkgPath := filepath.Join(activeDir, entry.Name(), "alias.sh")
-		existingAliases, _ := parser.ParseAliases(pkgPath)
+		if slices.Contains(skip, entry.Name()) {
+			continue
+		}
+		existing, err := lock.loadContent(entry.Name())
+		if err != nil {
+			continue
+		}
+		existing = overrides.apply(entry.Name(), existing)
 
-		for _, exist := range existingAliases {
-			for _, newA := range newAliases {
-				if exist.Name == newA.Name {
-					conflicts[exist.Name] = entry.Name()
+		for _, existName := range existing.Names() {
+			for _, newName := range newNames {
+				if existName == newName {
+					conflicts[existName] = entry.Name()
 				}
 			}
 		}
+		for _, varName := range envConflicts(existing, newContent) {
+			conflicts[varName] = entry.Name()
+		}
 	}
 
 	if len(conflicts) > 0 {
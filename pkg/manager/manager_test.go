@@ -1,9 +1,22 @@
 package manager
 
 import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/sarkartanmay393/ah/pkg/parser"
+	"github.com/sarkartanmay393/ah/pkg/semver"
 )
 
 func TestGetRootDir(t *testing.T) {
@@ -138,3 +151,1577 @@ func TestListPackages_NoActiveDir(t *testing.T) {
 		t.Errorf("expected 0 packages for non-existent active dir, got %d", len(packages))
 	}
 }
+
+// setupTestHome points HOME at a temporary directory with an empty
+// ah layout and returns the ah root.
+func setupTestHome(t *testing.T) string {
+	t.Helper()
+	tmpHome := t.TempDir()
+	t.Setenv("HOME", tmpHome)
+
+	root := filepath.Join(tmpHome, RootDirName)
+	if err := os.MkdirAll(filepath.Join(root, ActiveDir), 0755); err != nil {
+		t.Fatalf("failed to create active dir: %v", err)
+	}
+	return root
+}
+
+// writePackage creates a package directory with the given files.
+func writePackage(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("failed to create package dir: %v", err)
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestCompileAliases_AliasesAndFunctions(t *testing.T) {
+	root := setupTestHome(t)
+	writePackage(t, filepath.Join(root, ActiveDir, "kit"), map[string]string{
+		"alias.sh":     "alias q='echo '\\''hi'\\'''\nalias -- -x=ls\n",
+		"functions.sh": "mkcd() {\n  mkdir -p \"$1\" && cd \"$1\"\n}\n",
+	})
+
+	if err := CompileAliases(); err != nil {
+		t.Fatalf("CompileAliases failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "aliases.compiled.sh"))
+	if err != nil {
+		t.Fatalf("failed to read compiled file: %v", err)
+	}
+	compiled := string(data)
+
+	for _, want := range []string{
+		"# Package: kit\n",
+		"alias q='echo '\\''hi'\\'''\n",
+		"alias -- -x='ls'\n",
+		"function mkcd {\nmkdir -p \"$1\" && cd \"$1\"\n}\n",
+	} {
+		if !strings.Contains(compiled, want) {
+			t.Errorf("compiled file missing %q:\n%s", want, compiled)
+		}
+	}
+}
+
+func TestCheckConflicts_IncludesFunctions(t *testing.T) {
+	root := setupTestHome(t)
+	writePackage(t, filepath.Join(root, ActiveDir, "existing"), map[string]string{
+		"alias.sh": "alias mkcd='mkdir'\n",
+	})
+	newPkg := filepath.Join(t.TempDir(), "incoming")
+	writePackage(t, newPkg, map[string]string{
+		"functions.sh": "mkcd() { mkdir -p \"$1\"; }\n",
+	})
+
+	conflicts, err := CheckConflicts(newPkg)
+	if err != nil {
+		t.Fatalf("CheckConflicts failed: %v", err)
+	}
+	if conflicts["mkcd"] != "existing" {
+		t.Errorf("expected mkcd to conflict with 'existing', got %v", conflicts)
+	}
+}
+
+func TestLoadMetadata_Env(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		wantErr bool
+	}{
+		{"valid", "env:\n  - name: KUBE_EDITOR\n    value: vim\n    if_unset: true\n", false},
+		{"invalid name", "env:\n  - name: 1BAD\n    value: x\n", true},
+		{"protected", "env:\n  - name: PATH\n    value: /tmp\n", true},
+		{"ah internal", "env:\n  - name: AH_ROOT\n    value: /tmp\n", true},
+		{"duplicate", "env:\n  - name: A\n    value: x\n  - name: A\n    value: y\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writePackage(t, dir, map[string]string{
+				"ah.yaml": "name: kit\nversion: 1.0.0\n" + tt.env,
+			})
+			meta, err := LoadMetadata(dir)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got metadata %+v", meta)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(meta.Env) != 1 || meta.Env[0].Name != "KUBE_EDITOR" || !meta.Env[0].IfUnset {
+				t.Errorf("unexpected env: %+v", meta.Env)
+			}
+		})
+	}
+}
+
+func TestCompileAliases_Env(t *testing.T) {
+	root := setupTestHome(t)
+	writePackage(t, filepath.Join(root, ActiveDir, "kube"), map[string]string{
+		"ah.yaml": "name: kube\nversion: 1.0.0\nenv:\n  - name: KUBE_EDITOR\n    value: \"it's vim\"\n  - name: KUBECONFIG\n    value: ~/.kube/config\n    if_unset: true\n",
+	})
+
+	if err := CompileAliases(); err != nil {
+		t.Fatalf("CompileAliases failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "aliases.compiled.sh"))
+	if err != nil {
+		t.Fatalf("failed to read compiled file: %v", err)
+	}
+	compiled := string(data)
+
+	for _, want := range []string{
+		"export KUBE_EDITOR='it'\\''s vim'\n",
+		"if [ -z \"${KUBECONFIG+x}\" ]; then export KUBECONFIG='~/.kube/config'; fi\n",
+	} {
+		if !strings.Contains(compiled, want) {
+			t.Errorf("compiled file missing %q:\n%s", want, compiled)
+		}
+	}
+}
+
+func TestCheckConflicts_Env(t *testing.T) {
+	root := setupTestHome(t)
+	writePackage(t, filepath.Join(root, ActiveDir, "existing"), map[string]string{
+		"ah.yaml": "name: existing\nversion: 1.0.0\nenv:\n  - name: EDITOR\n    value: vim\n  - name: PAGER\n    value: less\n",
+	})
+	newPkg := filepath.Join(t.TempDir(), "incoming")
+	writePackage(t, newPkg, map[string]string{
+		"ah.yaml": "name: incoming\nversion: 1.0.0\nenv:\n  - name: EDITOR\n    value: nano\n  - name: PAGER\n    value: less\n",
+	})
+
+	conflicts, err := CheckConflicts(newPkg)
+	if err != nil {
+		t.Fatalf("CheckConflicts failed: %v", err)
+	}
+	if len(conflicts) != 1 || conflicts["$EDITOR"] != "existing" {
+		t.Errorf("expected only $EDITOR to conflict, got %v", conflicts)
+	}
+}
+
+func TestSyncShims(t *testing.T) {
+	root := setupTestHome(t)
+	activeDir := filepath.Join(root, ActiveDir)
+	binDir := filepath.Join(root, BinDir)
+	writePackage(t, filepath.Join(activeDir, "a", BinDir), map[string]string{
+		"hello": "#!/bin/sh\necho hello\n",
+		"both":  "#!/bin/sh\necho a\n",
+	})
+	writePackage(t, filepath.Join(activeDir, "b", BinDir), map[string]string{
+		"both": "#!/bin/sh\necho b\n",
+	})
+	writePackage(t, binDir, map[string]string{"mine": "user file"})
+
+	if err := syncShims(); err != nil {
+		t.Fatalf("syncShims failed: %v", err)
+	}
+
+	target, err := os.Readlink(filepath.Join(binDir, "both"))
+	if err != nil {
+		t.Fatalf("expected 'both' to be linked: %v", err)
+	}
+	if target != filepath.Join(activeDir, "a", BinDir, "both") {
+		t.Errorf("expected 'both' to come from package a, got %s", target)
+	}
+
+	// Disabling a package removes its links but keeps foreign files
+	os.RemoveAll(filepath.Join(activeDir, "a"))
+	if err := syncShims(); err != nil {
+		t.Fatalf("syncShims failed: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(binDir, "hello")); !os.IsNotExist(err) {
+		t.Errorf("expected 'hello' to be removed, got %v", err)
+	}
+	target, _ = os.Readlink(filepath.Join(binDir, "both"))
+	if target != filepath.Join(activeDir, "b", BinDir, "both") {
+		t.Errorf("expected 'both' to come from package b, got %s", target)
+	}
+	if _, err := os.Stat(filepath.Join(binDir, "mine")); err != nil {
+		t.Errorf("expected user file to be kept: %v", err)
+	}
+}
+
+func TestLoadPackageContent_Shims(t *testing.T) {
+	dir := t.TempDir()
+	writePackage(t, filepath.Join(dir, BinDir), map[string]string{
+		"tool":     "#!/bin/sh\n",
+		"bad;name": "#!/bin/sh\n",
+	})
+
+	content, err := LoadPackageContent(dir)
+	if err != nil {
+		t.Fatalf("LoadPackageContent failed: %v", err)
+	}
+	if len(content.Shims) != 1 || content.Shims[0] != "tool" {
+		t.Errorf("expected only 'tool', got %v", content.Shims)
+	}
+	// "tool" is not executable and "bad;name" is invalid
+	if len(content.Warnings()) != 2 {
+		t.Errorf("expected 2 warnings, got %v", content.Warnings())
+	}
+}
+
+func TestRenderFish(t *testing.T) {
+	pkgs := []CompiledPackage{{
+		Name: "kit",
+		Content: &PackageContent{
+			Aliases: []parser.AliasDef{
+				{Name: "q", Command: `echo 'hi' \o/`},
+				{Name: "-x", Command: "ls -x"},
+				{Name: "old", Command: "echo `date`"},
+			},
+			Functions: []parser.FunctionDef{{Name: "mkcd", Body: "mkdir -p \"$1\""}},
+			Env: []EnvVar{
+				{Name: "EDITOR", Value: "vim"},
+				{Name: "PAGER", Value: "less", IfUnset: true},
+			},
+		},
+	}}
+
+	out := fishEmitter{}.Emit(pkgs)
+	for _, want := range []string{
+		"set -gx EDITOR 'vim'\n",
+		"set -q PAGER; or set -gx PAGER 'less'\n",
+		`abbr --add --global -- q 'echo \'hi\' \\o/'` + "\n",
+		"abbr --add --global -- -x 'ls -x'\n",
+		"# skipped old: uses backquote command substitution\n",
+		"# skipped function mkcd: functions.sh is POSIX shell only\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("fish output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestBumpStateGeneration(t *testing.T) {
+	root := setupTestHome(t)
+	statePath := filepath.Join(root, StateFile)
+
+	// Empty state files from older versions count as generation 0.
+	os.WriteFile(statePath, nil, 0644)
+	for want := uint64(1); want <= 2; want++ {
+		if err := bumpStateGeneration(); err != nil {
+			t.Fatalf("bumpStateGeneration failed: %v", err)
+		}
+		if got := readStateGeneration(statePath); got != want {
+			t.Errorf("generation = %d, want %d", got, want)
+		}
+	}
+}
+
+// setupTestRegistry turns the clone of the public registry into a git
+// repository and returns a function that writes a package into it and
+// commits.
+func setupTestRegistry(t *testing.T, root string) func(pkg string, files map[string]string) {
+	t.Helper()
+	return setupTestRepo(t, filepath.Join(root, RegistriesDir, DefaultRegistry))
+}
+
+// setupTestRepo creates a registry git repository at repo.
+func setupTestRepo(t *testing.T, repo string) func(pkg string, files map[string]string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, out)
+		}
+	}
+	os.MkdirAll(repo, 0755)
+	git("init", "-q")
+
+	return func(pkg string, files map[string]string) {
+		t.Helper()
+		writePackage(t, filepath.Join(repo, "registry", pkg), files)
+		git("add", "-A")
+		git("commit", "-q", "-m", "update "+pkg)
+	}
+}
+
+func TestLockfile_PinsRegistryRevision(t *testing.T) {
+	root := setupTestHome(t)
+	commit := setupTestRegistry(t, root)
+	commit("kit", map[string]string{
+		"ah.yaml":  "name: kit\nversion: 1.0.0\n",
+		"alias.sh": "alias k='echo v1'\n",
+	})
+
+	if err := EnablePackage("kit"); err != nil {
+		t.Fatalf("EnablePackage failed: %v", err)
+	}
+	lock, err := LoadLockfile()
+	if err != nil {
+		t.Fatalf("LoadLockfile failed: %v", err)
+	}
+	entry := lock.Packages["kit"]
+	if len(entry.Commit) != 40 || !strings.HasPrefix(entry.Hash, "sha256:") {
+		t.Fatalf("unexpected lock entry: %+v", entry)
+	}
+
+	// A registry update must not change the compiled aliases...
+	commit("kit", map[string]string{"alias.sh": "alias k='echo v2'\n"})
+	if err := CompileAliases(); err != nil {
+		t.Fatalf("CompileAliases failed: %v", err)
+	}
+	compiled, _ := os.ReadFile(filepath.Join(root, CompiledFile))
+	if !strings.Contains(string(compiled), "echo v1") {
+		t.Errorf("expected pinned alias, got:\n%s", compiled)
+	}
+	if problems, err := VerifyLock(); err != nil || len(problems) != 0 {
+		t.Errorf("VerifyLock() = %v, %v", problems, err)
+	}
+
+	// ...until the package is enabled again from the registry.
+	if err := EnablePackage("kit"); err != nil {
+		t.Fatalf("EnablePackage failed: %v", err)
+	}
+	compiled, _ = os.ReadFile(filepath.Join(root, CompiledFile))
+	if !strings.Contains(string(compiled), "echo v2") {
+		t.Errorf("expected upgraded alias, got:\n%s", compiled)
+	}
+
+	if err := RemovePackage("kit"); err != nil {
+		t.Fatalf("RemovePackage failed: %v", err)
+	}
+	lock, _ = LoadLockfile()
+	if _, ok := lock.Packages["kit"]; ok {
+		t.Error("removed package should be unpinned")
+	}
+}
+
+func TestOutdated(t *testing.T) {
+	root := setupTestHome(t)
+	commit := setupTestRegistry(t, root)
+	commit("kit", map[string]string{
+		"ah.yaml":  "name: kit\nversion: 1.0.0\n",
+		"alias.sh": "alias a='echo a'\nalias b='echo b'\n",
+	})
+	if err := EnablePackage("kit"); err != nil {
+		t.Fatalf("EnablePackage failed: %v", err)
+	}
+	if updates, err := Outdated(); err != nil || len(updates) != 0 {
+		t.Fatalf("Outdated() = %v, %v; want nothing", updates, err)
+	}
+
+	commit("kit", map[string]string{
+		"ah.yaml":  "name: kit\nversion: 1.1.0\n",
+		"alias.sh": "alias a='echo A'\nalias c='echo c'\n",
+	})
+	updates, err := Outdated()
+	if err != nil || len(updates) != 1 {
+		t.Fatalf("Outdated() = %v, %v", updates, err)
+	}
+	u := updates[0]
+	if u.InstalledVersion != "1.0.0" || u.AvailableVersion != "1.1.0" {
+		t.Errorf("versions = %s -> %s", u.InstalledVersion, u.AvailableVersion)
+	}
+	var got []string
+	for _, c := range u.Changes {
+		got = append(got, c.String())
+	}
+	want := []string{"~ a: echo a -> echo A", "- b = echo b", "+ c = echo c"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("changes:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// The package does not conflict with its own older revision.
+	conflicts, err := checkConflicts(filepath.Join(root, RegistriesDir, DefaultRegistry, "registry", "kit"), "kit")
+	if err != nil || len(conflicts) != 0 {
+		t.Errorf("checkConflicts() = %v, %v", conflicts, err)
+	}
+}
+
+func TestStore_SurvivesRegistryLoss(t *testing.T) {
+	root := setupTestHome(t)
+	commit := setupTestRegistry(t, root)
+	commit("kit", map[string]string{
+		"ah.yaml":  "name: kit\nversion: 1.0.0\n",
+		"alias.sh": "alias k='echo v1'\n",
+	})
+	if err := EnablePackage("kit"); err != nil {
+		t.Fatalf("EnablePackage failed: %v", err)
+	}
+
+	store := filepath.Join(root, StoreDir, "kit", "1.0.0")
+	if target, _ := os.Readlink(filepath.Join(root, ActiveDir, "kit")); target != store {
+		t.Fatalf("active link points to %q, want %q", target, store)
+	}
+
+	// Upgrading stores the new version and collects the old one.
+	commit("kit", map[string]string{
+		"ah.yaml":  "name: kit\nversion: 1.1.0\n",
+		"alias.sh": "alias k='echo v2'\n",
+	})
+	if err := EnablePackage("kit"); err != nil {
+		t.Fatalf("EnablePackage failed: %v", err)
+	}
+	if _, err := os.Stat(store); !os.IsNotExist(err) {
+		t.Errorf("old version should be garbage collected")
+	}
+
+	// The registry clone can go away without breaking the shell.
+	os.RemoveAll(filepath.Join(root, RegistriesDir))
+	if err := CompileAliases(); err != nil {
+		t.Fatalf("CompileAliases failed: %v", err)
+	}
+	compiled, _ := os.ReadFile(filepath.Join(root, CompiledFile))
+	if !strings.Contains(string(compiled), "echo v2") {
+		t.Errorf("expected stored alias, got:\n%s", compiled)
+	}
+
+	if err := RemovePackage("kit"); err != nil {
+		t.Fatalf("RemovePackage failed: %v", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(root, StoreDir)); len(entries) != 0 {
+		t.Errorf("store not emptied after remove: %v", entries)
+	}
+}
+
+func TestStore_PackageWithSymlink(t *testing.T) {
+	root := setupTestHome(t)
+	commit := setupTestRegistry(t, root)
+	pkgDir := filepath.Join(root, RegistriesDir, DefaultRegistry, "registry", "kit")
+	writePackage(t, pkgDir, map[string]string{"alias.sh": "alias k='echo v1'\n"})
+	if err := os.Symlink("alias.sh", filepath.Join(pkgDir, "link.sh")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	commit("kit", map[string]string{"ah.yaml": "name: kit\nversion: 1.0.0\n"})
+
+	// Symlinks are not part of a package: the stored copy matches the
+	// pinned hash without them.
+	if err := InstallPackage("kit", nil); err != nil {
+		t.Fatalf("InstallPackage failed: %v", err)
+	}
+	store := filepath.Join(root, StoreDir, "kit", "1.0.0")
+	if _, err := os.Lstat(filepath.Join(store, "link.sh")); !os.IsNotExist(err) {
+		t.Errorf("symlink should not be stored, got %v", err)
+	}
+	if problems, err := VerifyLock(); err != nil || len(problems) != 0 {
+		t.Errorf("VerifyLock = %v, %v", problems, err)
+	}
+}
+
+func TestStore_SameVersionDifferentContent(t *testing.T) {
+	root := setupTestHome(t)
+	commit := setupTestRegistry(t, root)
+	commit("kit", map[string]string{"ah.yaml": "name: kit\nversion: 1.0.0\n", "alias.sh": "alias k=a\n"})
+	EnablePackage("kit")
+	commit("kit", map[string]string{"alias.sh": "alias k=b\n"})
+	EnablePackage("kit")
+
+	lock, _ := LoadLockfile()
+	store := lock.Packages["kit"].Store
+	if !strings.HasPrefix(store, "kit/1.0.0+") {
+		t.Errorf("store = %q, want kit/1.0.0+<hash>", store)
+	}
+}
+
+func TestStore_MigratesLegacyLinks(t *testing.T) {
+	root := setupTestHome(t)
+	commit := setupTestRepo(t, filepath.Join(root, legacyRegistryDir))
+	commit("kit", map[string]string{"ah.yaml": "name: kit\nversion: 2.0.0\n", "alias.sh": "alias k=a\n"})
+
+	// Enabled by an older ah: a bare symlink into the single registry clone.
+	link := filepath.Join(root, ActiveDir, "kit")
+	os.Symlink(filepath.Join(root, legacyRegistryDir, "registry", "kit"), link)
+
+	if err := EnsureDirs(); err != nil {
+		t.Fatalf("EnsureDirs failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, RegistriesDir, DefaultRegistry, ".git")); err != nil {
+		t.Fatalf("legacy registry clone not migrated: %v", err)
+	}
+
+	if err := CompileAliases(); err != nil {
+		t.Fatalf("CompileAliases failed: %v", err)
+	}
+	if target, _ := os.Readlink(link); target != filepath.Join(root, StoreDir, "kit", "2.0.0") {
+		t.Errorf("legacy link not moved into the store: %s", target)
+	}
+}
+
+func TestApply(t *testing.T) {
+	root := setupTestHome(t)
+	commit := setupTestRegistry(t, root)
+	commit("kit", map[string]string{"ah.yaml": "name: kit\nversion: 1.0.0\n", "alias.sh": "alias a='echo v1'\nalias b='echo b'\n"})
+	commit("kit", map[string]string{"ah.yaml": "name: kit\nversion: 2.0.0\n", "alias.sh": "alias a='echo v2'\nalias b='echo b'\n"})
+	commit("other", map[string]string{"ah.yaml": "name: other\nversion: 1.0.0\n", "alias.sh": "alias a='echo other'\n"})
+	commit("extra", map[string]string{"ah.yaml": "name: extra\nversion: 1.0.0\n", "alias.sh": "alias x='echo x'\n"})
+	if err := EnablePackage("extra"); err != nil {
+		t.Fatalf("EnablePackage failed: %v", err)
+	}
+
+	f := &Ahfile{
+		Packages: []AhfilePackage{
+			{Name: "kit", Version: "1.0.0", Disabled: []string{"b"}},
+			{Name: "other"},
+		},
+		Conflicts: map[string]string{"a": "kit"},
+	}
+
+	plan, err := Apply(f, true)
+	if err != nil {
+		t.Fatalf("Apply(dry run) failed: %v", err)
+	}
+	var got []string
+	for _, a := range plan {
+		got = append(got, a.String())
+	}
+	want := []string{
+		"+ install kit 1.0.0",
+		"+ install other 1.0.0",
+		"- disable extra",
+		"~ disable kit/b",
+		"~ use a from kit",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("plan:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if pkgs, _ := ListPackages(); len(pkgs) != 1 || pkgs[0] != "extra" {
+		t.Fatalf("dry run changed active packages: %v", pkgs)
+	}
+
+	if _, err := Apply(f, false); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	compiled, _ := os.ReadFile(filepath.Join(root, CompiledFile))
+	for _, s := range []string{"echo v1", "echo b", "echo other", "echo x"} {
+		if has := strings.Contains(string(compiled), s); has != (s == "echo v1") {
+			t.Errorf("compiled file contains %q = %v:\n%s", s, has, compiled)
+		}
+	}
+
+	if plan, err := Apply(f, true); err != nil || len(plan) != 0 {
+		t.Errorf("second apply should be a no-op, got %v, %v", plan, err)
+	}
+
+	f.Conflicts = nil
+	if _, err := Apply(f, true); err == nil || !strings.Contains(err.Error(), "a is defined by kit and other") {
+		t.Errorf("expected unresolved conflict error, got %v", err)
+	}
+}
+
+func TestRegistries_QualifiedNamesAndOrder(t *testing.T) {
+	root := setupTestHome(t)
+	official := setupTestRegistry(t, root)
+	corp := setupTestRepo(t, filepath.Join(root, RegistriesDir, "corp"))
+	official("kit", map[string]string{"ah.yaml": "name: kit\nversion: 1.0.0\n", "alias.sh": "alias k='echo official'\n"})
+	corp("kit", map[string]string{"ah.yaml": "name: kit\nversion: 1.0.0\n", "alias.sh": "alias k='echo corp'\n"})
+	corp("tools", map[string]string{"ah.yaml": "name: tools\nversion: 1.0.0\n", "alias.sh": "alias t='echo t'\n"})
+
+	if err := AddRegistry(Registry{Name: "corp", URL: "https://example.com/corp.git", Subdir: "registry"}, -1); err != nil {
+		t.Fatalf("AddRegistry failed: %v", err)
+	}
+	if err := AddRegistry(Registry{Name: "corp", URL: "https://example.com/other.git"}, -1); err == nil {
+		t.Error("expected duplicate registry to be rejected")
+	}
+
+	pkgs, _ := ListRegistryPackages()
+	if strings.Join(pkgs, ",") != "kit,corp/kit,tools" {
+		t.Errorf("ListRegistryPackages = %v", pkgs)
+	}
+	if reg, _, err := FindPackage("kit"); err != nil || reg.Name != DefaultRegistry {
+		t.Errorf("kit should resolve to %s, got %v, %v", DefaultRegistry, reg, err)
+	}
+	if _, _, err := FindPackage("nope/kit"); err == nil {
+		t.Error("expected unknown registry to fail")
+	}
+
+	if err := EnablePackage("corp/kit"); err != nil {
+		t.Fatalf("EnablePackage failed: %v", err)
+	}
+	lock, _ := LoadLockfile()
+	if lock.Packages["kit"].Registry != "corp" {
+		t.Errorf("lock entry = %+v, want registry corp", lock.Packages["kit"])
+	}
+	compiled, _ := os.ReadFile(filepath.Join(root, CompiledFile))
+	if !strings.Contains(string(compiled), "echo corp") {
+		t.Errorf("compiled file does not use corp/kit:\n%s", compiled)
+	}
+	// Once installed, the bare name sticks to the registry it came from.
+	if reg, _, _ := FindPackage("kit"); reg == nil || reg.Name != "corp" {
+		t.Errorf("installed kit should resolve to corp, got %v", reg)
+	}
+
+	if err := ReorderRegistries([]string{"corp"}); err != nil {
+		t.Fatalf("ReorderRegistries failed: %v", err)
+	}
+	if regs, _ := LoadRegistries(); len(regs) != 2 || regs[0].Name != "corp" {
+		t.Errorf("order = %v, want corp first", regs)
+	}
+}
+
+func TestRegistry_RecloneOnURLChange(t *testing.T) {
+	root := setupTestHome(t)
+	first := filepath.Join(t.TempDir(), "first")
+	second := filepath.Join(t.TempDir(), "second")
+	setupTestRepo(t, first)("kit", map[string]string{"ah.yaml": "name: kit\nversion: 1.0.0\n"})
+	setupTestRepo(t, second)("other", map[string]string{"ah.yaml": "name: other\nversion: 1.0.0\n"})
+
+	t.Setenv("AH_REGISTRY_URL", first)
+	if err := UpdateRegistry(); err != nil {
+		t.Fatalf("UpdateRegistry failed: %v", err)
+	}
+	if _, err := GetRegistryPackagePath("kit"); err != nil {
+		t.Fatalf("kit not cloned: %v", err)
+	}
+
+	// Switching the URL must not keep serving the old clone.
+	t.Setenv("AH_REGISTRY_URL", second)
+	if err := UpdateRegistry(); err != nil {
+		t.Fatalf("UpdateRegistry failed: %v", err)
+	}
+	if _, err := GetRegistryPackagePath("kit"); err == nil {
+		t.Error("kit still served from the old registry")
+	}
+	if _, err := os.Stat(filepath.Join(root, RegistriesDir, DefaultRegistry, "registry", "other")); err != nil {
+		t.Errorf("new registry not cloned: %v", err)
+	}
+}
+
+func TestParseSource(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want *Source
+	}{
+		{"git-tools", nil},
+		{"corp/git-tools", nil},
+		{"/tmp/pkg", &Source{Kind: SourcePath, Location: "/tmp/pkg"}},
+		{"/tmp/pkg.tar.gz", &Source{Kind: SourceTarball, Location: "/tmp/pkg.tar.gz"}},
+		{"git+https://host/repo", &Source{Kind: SourceGit, Location: "https://host/repo"}},
+		{"git+https://host/repo#pkgs/kit@v1.2", &Source{Kind: SourceGit, Location: "https://host/repo", Subdir: "pkgs/kit", Ref: "v1.2"}},
+		{"git+https://host/repo#@main", &Source{Kind: SourceGit, Location: "https://host/repo", Ref: "main"}},
+		// Arguments git would take for options are rejected.
+		{"git+--upload-pack=touch x#@main", nil},
+		{"git+https://host/repo#@--output=x", nil},
+	}
+	for _, tt := range tests {
+		got, ok := ParseSource(tt.arg)
+		if ok != (tt.want != nil) || (ok && *got != *tt.want) {
+			t.Errorf("ParseSource(%q) = %+v, %v; want %+v", tt.arg, got, ok, tt.want)
+			continue
+		}
+		if ok && got.String() != tt.arg {
+			t.Errorf("ParseSource(%q).String() = %q", tt.arg, got.String())
+		}
+	}
+}
+
+func TestInstallFromSource(t *testing.T) {
+	root := setupTestHome(t)
+	dir := filepath.Join(t.TempDir(), "kit")
+	writePackage(t, dir, map[string]string{
+		"ah.yaml":  "name: kit\nversion: 0.1.0\n",
+		"alias.sh": "alias k='echo local'\n",
+	})
+
+	src, _ := ParseSource(dir)
+	lock, _ := LoadLockfile()
+	if err := WithLock(func() error {
+		if err := lock.pinSource(src, "kit", dirFiles(dir), ""); err != nil {
+			return err
+		}
+		return finishEnable(lock, "kit")
+	}); err != nil {
+		t.Fatalf("install from path failed: %v", err)
+	}
+	lock, _ = LoadLockfile()
+	if entry := lock.Packages["kit"]; entry.Source != dir || entry.Store != "kit/0.1.0" {
+		t.Errorf("unexpected lock entry: %+v", entry)
+	}
+
+	// The origin is recorded, so upgrades see changes made to it.
+	writePackage(t, dir, map[string]string{"alias.sh": "alias k='echo changed'\n"})
+	updates, err := Outdated()
+	if err != nil || len(updates) != 1 || updates[0].Changes[0].Kind != Changed {
+		t.Fatalf("Outdated = %+v, %v", updates, err)
+	}
+
+	// Removing the source must not break the installed package.
+	os.RemoveAll(dir)
+	if err := CompileAliases(); err != nil {
+		t.Fatalf("CompileAliases failed: %v", err)
+	}
+	compiled, _ := os.ReadFile(filepath.Join(root, CompiledFile))
+	if !strings.Contains(string(compiled), "echo local") {
+		t.Errorf("compiled file lost the installed package:\n%s", compiled)
+	}
+}
+
+func TestSource_FetchGitAndTarball(t *testing.T) {
+	setupTestHome(t)
+	repo := filepath.Join(t.TempDir(), "repo")
+	commit := setupTestRepo(t, repo)
+	commit("kit", map[string]string{"ah.yaml": "name: kit\nversion: 1.0.0\n", "alias.sh": "alias k=v1\n"})
+	out, _ := exec.Command("git", "-C", repo, "rev-parse", "HEAD").Output()
+	first := strings.TrimSpace(string(out))
+	commit("kit", map[string]string{"ah.yaml": "name: kit\nversion: 2.0.0\n", "alias.sh": "alias k=v2\n"})
+
+	src, _ := ParseSource("git+" + repo + "#registry/kit@" + first)
+	dir, got, cleanup, err := src.fetch()
+	defer cleanup()
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if meta, err := LoadMetadata(dir); err != nil || meta.Version != "1.0.0" || got != first {
+		t.Errorf("fetched %v at %s, %v; want 1.0.0 at %s", meta, got, err, first)
+	}
+
+	// An archive of the package directory, as produced by tar czf.
+	archive := filepath.Join(t.TempDir(), "kit.tar.gz")
+	if out, err := exec.Command("tar", "czf", archive, "-C", filepath.Join(repo, "registry"), "kit").CombinedOutput(); err != nil {
+		t.Skipf("tar not available: %v: %s", err, out)
+	}
+	src, _ = ParseSource(archive)
+	dir, _, cleanup, err = src.fetch()
+	defer cleanup()
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if meta, err := LoadMetadata(dir); err != nil || meta.Version != "2.0.0" {
+		t.Errorf("extracted %v, %v; want version 2.0.0", meta, err)
+	}
+}
+
+func TestRegistryIndex(t *testing.T) {
+	root := setupTestHome(t)
+	commit := setupTestRegistry(t, root)
+	commit("kit", map[string]string{"ah.yaml": "name: kit\nversion: 1.0.0\ndescription: Kit\ntags: [git]\n", "alias.sh": "alias kk='echo k'\n"})
+	commit("broken", map[string]string{"alias.sh": "alias b=b\n"})
+
+	contentDir := filepath.Join(root, RegistriesDir, DefaultRegistry, "registry")
+	index, problems, err := WriteIndex(contentDir, "")
+	if err != nil {
+		t.Fatalf("WriteIndex failed: %v", err)
+	}
+	if len(index.Packages) != 1 || problems["broken"] == "" {
+		t.Fatalf("index = %+v, problems = %v", index.Packages, problems)
+	}
+	entry := index.Packages[0]
+	if entry.Name != "kit" || entry.Version != "1.0.0" || entry.Tags[0] != "git" || entry.Aliases[0] != "kk" || !strings.HasPrefix(entry.Hash, "sha256:") {
+		t.Errorf("unexpected index entry: %+v", entry)
+	}
+
+	// Search and list read the published index, not the packages.
+	commit("later", map[string]string{"ah.yaml": "name: later\nversion: 1.0.0\n", "alias.sh": "alias l=l\n"})
+	if pkgs, _ := ListRegistryPackages(); strings.Join(pkgs, ",") != "kit" {
+		t.Errorf("ListRegistryPackages = %v, want the indexed packages", pkgs)
+	}
+	for _, query := range []string{"kk", "git", "KIT"} {
+		if res, err := SearchPackages(query); err != nil || len(res) != 1 || res[0].Version != "1.0.0" {
+			t.Errorf("SearchPackages(%q) = %+v, %v", query, res, err)
+		}
+	}
+
+	// Without an index the packages are read directly.
+	os.Remove(filepath.Join(contentDir, IndexFile))
+	if pkgs, _ := ListRegistryPackages(); strings.Join(pkgs, ",") != "kit,later" {
+		t.Errorf("ListRegistryPackages without index = %v", pkgs)
+	}
+}
+
+func TestHTTPRegistry(t *testing.T) {
+	root := setupTestHome(t)
+	src := t.TempDir()
+	writePackage(t, filepath.Join(src, "kit"), map[string]string{
+		"ah.yaml":  "name: kit\nversion: 1.0.0\n",
+		"alias.sh": "alias k='echo http'\n",
+	})
+	// Symlinks are left out of both the hash and the tarball.
+	if err := os.Symlink("alias.sh", filepath.Join(src, "kit", "link.sh")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	site := t.TempDir()
+	if _, _, err := WriteIndex(src, site); err != nil {
+		t.Fatalf("WriteIndex failed: %v", err)
+	}
+
+	// A static file server with ETags on index.json.
+	var indexFetches, notModified, tarballFetches int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := os.ReadFile(filepath.Join(site, filepath.Base(r.URL.Path)))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Path == "/"+IndexFile {
+			indexFetches++
+			etag := fmt.Sprintf(`"%x"`, sha256.Sum256(data))
+			if r.Header.Get("If-None-Match") == etag {
+				notModified++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", etag)
+		} else {
+			tarballFetches++
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	if err := SaveRegistries([]Registry{{Name: "web", URL: srv.URL, Type: RegistryHTTP}}); err != nil {
+		t.Fatalf("SaveRegistries failed: %v", err)
+	}
+	if err := UpdateRegistry(); err != nil {
+		t.Fatalf("UpdateRegistry failed: %v", err)
+	}
+	if err := EnablePackage("kit"); err != nil {
+		t.Fatalf("EnablePackage failed: %v", err)
+	}
+	compiled, _ := os.ReadFile(filepath.Join(root, CompiledFile))
+	if !strings.Contains(string(compiled), "echo http") {
+		t.Errorf("compiled file does not contain the HTTP package:\n%s", compiled)
+	}
+
+	// Unchanged index: a conditional request and no downloads.
+	if err := RefreshRegistry(); err != nil {
+		t.Fatalf("UpdateRegistry failed: %v", err)
+	}
+	if indexFetches != 2 || notModified != 1 || tarballFetches != 1 {
+		t.Errorf("index fetches = %d (304: %d), tarball fetches = %d", indexFetches, notModified, tarballFetches)
+	}
+
+	// A tarball that does not match the index is rejected.
+	writePackage(t, filepath.Join(src, "kit"), map[string]string{"alias.sh": "alias k='echo evil'\n"})
+	index, _ := loadIndex(filepath.Join(site, IndexFile))
+	WriteIndex(src, site)
+	tampered, _ := loadIndex(filepath.Join(site, IndexFile))
+	tampered.Packages[0].SHA256 = index.Packages[0].SHA256
+	data, _ := json.Marshal(tampered)
+	os.WriteFile(filepath.Join(site, IndexFile), data, 0644)
+
+	if err := RefreshRegistry(); err != nil {
+		t.Fatalf("UpdateRegistry failed: %v", err)
+	}
+	alias, _ := os.ReadFile(filepath.Join(root, RegistriesDir, "web", "kit", "alias.sh"))
+	if strings.Contains(string(alias), "evil") {
+		t.Error("package with a mismatching sha256 was installed")
+	}
+	// The local index keeps describing the copy we have.
+	localIndex := filepath.Join(root, RegistriesDir, "web", IndexFile)
+	if local, err := loadIndex(localIndex); err != nil || len(local.Packages) != 1 || local.Packages[0].Hash != index.Packages[0].Hash {
+		t.Errorf("local index = %+v, %v; want the previous kit entry", local, err)
+	}
+
+	// A new package with a bad sha256 is not listed at all.
+	writePackage(t, filepath.Join(src, "kit"), map[string]string{"alias.sh": "alias k='echo http'\n"})
+	writePackage(t, filepath.Join(src, "tool"), map[string]string{
+		"ah.yaml":  "name: tool\nversion: 1.0.0\n",
+		"alias.sh": "alias t='echo tool'\n",
+	})
+	WriteIndex(src, site)
+	broken, _ := loadIndex(filepath.Join(site, IndexFile))
+	for i := range broken.Packages {
+		if broken.Packages[i].Name == "tool" {
+			broken.Packages[i].SHA256 = "sha256:" + strings.Repeat("0", 64)
+		}
+	}
+	data, _ = json.Marshal(broken)
+	os.WriteFile(filepath.Join(site, IndexFile), data, 0644)
+
+	if err := RefreshRegistry(); err != nil {
+		t.Fatalf("UpdateRegistry failed: %v", err)
+	}
+	local, err := loadIndex(localIndex)
+	if err != nil || len(local.Packages) != 1 || local.Packages[0].Name != "kit" {
+		t.Errorf("local index = %+v, %v; want kit only", local, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, RegistriesDir, "web", "tool")); !os.IsNotExist(err) {
+		t.Errorf("package with a bad sha256 was kept: %v", err)
+	}
+}
+
+func TestRegistryFreshnessAndOffline(t *testing.T) {
+	setupTestHome(t)
+	upstream := filepath.Join(t.TempDir(), "upstream")
+	commit := setupTestRepo(t, upstream)
+	commit("kit", map[string]string{"ah.yaml": "name: kit\nversion: 1.0.0\n", "alias.sh": "alias k=k\n"})
+	t.Setenv("AH_REGISTRY_URL", upstream)
+
+	if err := UpdateRegistry(); err != nil {
+		t.Fatalf("UpdateRegistry failed: %v", err)
+	}
+	reg := Registry{Name: DefaultRegistry, URL: upstream}
+	status, ok := reg.Status()
+	head, _ := exec.Command("git", "-C", upstream, "rev-parse", "HEAD").Output()
+	if !ok || status.Commit != strings.TrimSpace(string(head)) || time.Since(status.FetchedAt) > time.Minute {
+		t.Fatalf("status = %+v, %v", status, ok)
+	}
+
+	// Within the TTL the registry is not pulled; a refresh always is.
+	commit("later", map[string]string{"ah.yaml": "name: later\nversion: 1.0.0\n", "alias.sh": "alias l=l\n"})
+	UpdateRegistry()
+	if _, err := GetRegistryPackagePath("later"); err == nil {
+		t.Error("fresh registry was pulled again")
+	}
+	t.Setenv("AH_OFFLINE", "1")
+	if err := RefreshRegistry(); err == nil {
+		t.Error("RefreshRegistry should fail offline")
+	}
+	t.Setenv("AH_OFFLINE", "")
+	if err := RefreshRegistry(); err != nil {
+		t.Fatalf("RefreshRegistry failed: %v", err)
+	}
+	if _, err := GetRegistryPackagePath("later"); err != nil {
+		t.Errorf("refresh did not pull: %v", err)
+	}
+
+	// A TTL of 0 always fetches.
+	t.Setenv("AH_REGISTRY_TTL", "0")
+	if RegistryTTL() != 0 || reg.fresh(RegistryTTL()) {
+		t.Error("TTL 0 should never be fresh")
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	root := setupTestHome(t)
+	commit := setupTestRegistry(t, root)
+	commit("base", map[string]string{"ah.yaml": "name: base\nversion: 1.4.0\n", "alias.sh": "alias b='echo base'\n"})
+	commit("mid", map[string]string{"ah.yaml": "name: mid\nversion: 2.0.0\ndependencies:\n  base: ^1.2\n", "alias.sh": "alias m='echo mid'\n"})
+	commit("top", map[string]string{"ah.yaml": "name: top\nversion: 1.0.0\ndependencies:\n  mid: '>=2'\n", "alias.sh": "alias t='echo top'\n"})
+	commit("strict", map[string]string{"ah.yaml": "name: strict\nversion: 1.0.0\ndependencies:\n  base: ^2\n", "alias.sh": "alias s='echo s'\n"})
+
+	if _, err := LoadMetadata(filepath.Join(root, RegistriesDir, DefaultRegistry, "registry", "top")); err != nil {
+		t.Fatalf("LoadMetadata failed: %v", err)
+	}
+	writePackage(t, filepath.Join(root, "bad"), map[string]string{"ah.yaml": "name: bad\nversion: 1.0.0\ndependencies:\n  base: '>>1'\n"})
+	if _, err := LoadMetadata(filepath.Join(root, "bad")); err == nil {
+		t.Error("expected an invalid constraint to be rejected")
+	}
+
+	if err := EnablePackage("top"); err != nil {
+		t.Fatalf("EnablePackage failed: %v", err)
+	}
+	if pkgs, _ := ListPackages(); strings.Join(pkgs, ",") != "base,mid,top" {
+		t.Fatalf("active packages = %v, want base,mid,top", pkgs)
+	}
+	lock, _ := LoadLockfile()
+	if lock.Packages["base"].Version != "1.4.0" {
+		t.Errorf("base not pinned: %+v", lock.Packages["base"])
+	}
+
+	if err := EnablePackage("strict"); err == nil || !strings.Contains(err.Error(), "strict requires base ^2") {
+		t.Errorf("expected unsatisfied constraint error, got %v", err)
+	}
+	if err := DisablePackage("base"); err == nil || !strings.Contains(err.Error(), "needed by mid") {
+		t.Errorf("expected disable to be refused, got %v", err)
+	}
+	if err := RemovePackage("mid"); err == nil || !strings.Contains(err.Error(), "needed by top") {
+		t.Errorf("expected remove to be refused, got %v", err)
+	}
+
+	// Re-enabling restores a disabled dependency.
+	if err := DisablePackage("top"); err != nil {
+		t.Fatalf("DisablePackage failed: %v", err)
+	}
+	if err := DisablePackage("mid"); err != nil {
+		t.Fatalf("DisablePackage failed: %v", err)
+	}
+	if err := EnablePackageFromRepo("top"); err != nil {
+		t.Fatalf("EnablePackageFromRepo failed: %v", err)
+	}
+	if pkgs, _ := ListPackages(); strings.Join(pkgs, ",") != "base,mid,top" {
+		t.Errorf("active packages = %v, want base,mid,top", pkgs)
+	}
+
+	// A meta-package has no definitions of its own.
+	commit("team", map[string]string{"ah.yaml": "name: team\nversion: 1.0.0\ndependencies:\n  top: ''\n"})
+	if err := EnablePackage("team"); err != nil {
+		t.Fatalf("EnablePackage(meta-package) failed: %v", err)
+	}
+
+	f := &Ahfile{Packages: []AhfilePackage{{Name: "top"}, {Name: "mid"}}}
+	if _, err := Apply(f, true); err == nil || !strings.Contains(err.Error(), "mid needs base ^1.2") {
+		t.Errorf("expected unmet dependency error, got %v", err)
+	}
+}
+
+func TestUpgrade_NewDependency(t *testing.T) {
+	root := setupTestHome(t)
+	commit := setupTestRegistry(t, root)
+	commit("kit", map[string]string{"ah.yaml": "name: kit\nversion: 1.0.0\n", "alias.sh": "alias k='echo kit'\n"})
+	commit("other", map[string]string{"ah.yaml": "name: other\nversion: 1.0.0\n", "alias.sh": "alias x='echo other'\n"})
+	for _, pkg := range []string{"kit", "other"} {
+		if err := EnablePackage(pkg); err != nil {
+			t.Fatalf("EnablePackage(%s) failed: %v", pkg, err)
+		}
+	}
+
+	// The new version needs a package that conflicts with an enabled one.
+	commit("extra", map[string]string{"ah.yaml": "name: extra\nversion: 1.0.0\n", "alias.sh": "alias x='echo extra'\n"})
+	commit("kit", map[string]string{"ah.yaml": "name: kit\nversion: 1.1.0\ndependencies:\n  extra: ^1\n", "alias.sh": "alias k='echo kit'\n"})
+	var conflictErr *ConflictError
+	if err := UpgradePackage("kit"); !errors.As(err, &conflictErr) || conflictErr.Conflicts["x"] != "other" {
+		t.Fatalf("expected a conflict on x from the new dependency, got %v", err)
+	}
+
+	commit("extra", map[string]string{"ah.yaml": "name: extra\nversion: 1.0.0\n", "alias.sh": "alias e='echo extra'\n"})
+	if err := UpgradePackage("kit"); err != nil {
+		t.Fatalf("UpgradePackage failed: %v", err)
+	}
+	if pkgs, _ := ListPackages(); strings.Join(pkgs, ",") != "extra,kit,other" {
+		t.Errorf("active packages = %v, want extra,kit,other", pkgs)
+	}
+}
+
+func TestSelectVersion(t *testing.T) {
+	root := setupTestHome(t)
+	commit := setupTestRegistry(t, root)
+	repo := filepath.Join(root, RegistriesDir, DefaultRegistry)
+	commit("kit", map[string]string{"ah.yaml": "name: kit\nversion: 1.0.0\n", "alias.sh": "alias k='echo 1'\n"})
+	commit("kit", map[string]string{"ah.yaml": "name: kit\nversion: 2.1.0\n"})
+	if out, err := exec.Command("git", "-C", repo, "tag", "kit/v2.1.0").CombinedOutput(); err != nil {
+		t.Fatalf("git tag failed: %v: %s", err, out)
+	}
+	commit("kit", map[string]string{"ah.yaml": "name: kit\nversion: 3.0.0-beta.1\n"})
+	commit("multi", map[string]string{
+		"1.0.0/ah.yaml": "name: multi\nversion: 1.0.0\n", "1.0.0/alias.sh": "alias m='echo 1'\n",
+		"1.5.0/ah.yaml": "name: multi\nversion: 1.5.0\n", "1.5.0/alias.sh": "alias m='echo 1.5'\n",
+		"2.0.0-rc.1/ah.yaml": "name: multi\nversion: 2.0.0-rc.1\n", "2.0.0-rc.1/alias.sh": "alias m='echo 2'\n",
+	})
+
+	regs, _ := LoadRegistries()
+	reg := regs[0]
+	tests := []struct{ pkg, constraint, want string }{
+		{"kit", "^2", "2.1.0"},                  // tag
+		{"kit", "~1.0", "1.0.0"},                // history
+		{"kit", ">=3.0.0-beta", "3.0.0-beta.1"}, // head
+		{"multi", "", "1.5.0"},                  // versioned subdirectories
+		{"multi", "<1.5", "1.0.0"},
+	}
+	for _, tt := range tests {
+		c, _ := semver.ParseConstraint(tt.constraint)
+		files, _, err := reg.selectVersion(tt.pkg, c)
+		if err != nil {
+			t.Errorf("selectVersion(%s@%s) failed: %v", tt.pkg, tt.constraint, err)
+			continue
+		}
+		if meta, _ := loadMetadata(files); meta == nil || meta.Version != tt.want {
+			t.Errorf("selectVersion(%s@%s) = %+v, want %s", tt.pkg, tt.constraint, meta, tt.want)
+		}
+	}
+	c, _ := semver.ParseConstraint("^4")
+	if _, _, err := reg.selectVersion("kit", c); err == nil {
+		t.Error("expected no version to satisfy ^4")
+	}
+	if files, _ := reg.headFiles("multi"); files.(gitFiles).prefix != "registry/multi/1.5.0" {
+		t.Errorf("headFiles(multi) = %+v, want the highest release", files)
+	}
+
+	// Versions must be semantic.
+	writePackage(t, filepath.Join(root, "bad"), map[string]string{"ah.yaml": "name: bad\nversion: latest\n", "alias.sh": "alias b=ls\n"})
+	if _, err := LoadMetadata(filepath.Join(root, "bad")); err == nil {
+		t.Error("expected a non-semver version to be rejected")
+	}
+
+	// Upgrades stay within the constraint a package was installed with.
+	if err := EnablePackage("kit"); err != nil {
+		t.Fatalf("EnablePackage failed: %v", err)
+	}
+	lock, _ := LoadLockfile()
+	entry := lock.Packages["kit"]
+	entry.Constraint = "~1.0"
+	lock.Packages["kit"] = entry
+	lock.Save()
+	updates, err := Outdated()
+	if err != nil || len(updates) != 1 || updates[0].AvailableVersion != "1.0.0" {
+		t.Errorf("Outdated() = %+v, %v; want a switch to 1.0.0", updates, err)
+	}
+
+	// An Ahfile finds versions where 'ah install pkg@version' does.
+	f := &Ahfile{Packages: []AhfilePackage{{Name: "kit", Version: "2.1.0"}, {Name: "multi", Version: "1.0.0"}}}
+	plan, err := Apply(f, true)
+	if err != nil {
+		t.Fatalf("Apply(dry run) failed: %v", err)
+	}
+	var got []string
+	for _, a := range plan {
+		got = append(got, a.String())
+	}
+	if want := "~ switch kit 3.0.0-beta.1 -> 2.1.0,+ install multi 1.0.0"; strings.Join(got, ",") != want {
+		t.Errorf("plan = %q, want %q", got, want)
+	}
+}
+
+func TestStore_RestoreVersionedSubdirectory(t *testing.T) {
+	root := setupTestHome(t)
+	commit := setupTestRegistry(t, root)
+	commit("multi", map[string]string{
+		"1.0.0/ah.yaml": "name: multi\nversion: 1.0.0\n", "1.0.0/alias.sh": "alias m='echo 1'\n",
+		"1.5.0/ah.yaml": "name: multi\nversion: 1.5.0\n", "1.5.0/alias.sh": "alias m='echo 1.5'\n",
+	})
+	if err := EnablePackage("multi"); err != nil {
+		t.Fatalf("EnablePackage failed: %v", err)
+	}
+	lock, _ := LoadLockfile()
+	entry := lock.Packages["multi"]
+	if entry.Path != "1.5.0" {
+		t.Fatalf("lock entry %+v does not record the version subdirectory", entry)
+	}
+
+	// The store copy is restored from the pinned subdirectory, not from
+	// the package directory or the registry head.
+	commit("multi", map[string]string{"1.5.0/alias.sh": "alias m='echo changed'\n"})
+	if err := os.RemoveAll(storePath(entry.Store)); err != nil {
+		t.Fatal(err)
+	}
+	if err := CompileAliases(); err != nil {
+		t.Fatalf("CompileAliases failed: %v", err)
+	}
+	compiled, _ := os.ReadFile(filepath.Join(root, CompiledFile))
+	if !strings.Contains(string(compiled), "alias m='echo 1.5'") {
+		t.Errorf("restored content differs from the installed one:\n%s", compiled)
+	}
+	if problems, err := VerifyLock(); err != nil || len(problems) != 0 {
+		t.Errorf("VerifyLock = %v, %v", problems, err)
+	}
+}
+
+func TestPinWarnings(t *testing.T) {
+	root := setupTestHome(t)
+	commit := setupTestRegistry(t, root)
+	commit("kit", map[string]string{"ah.yaml": "name: kit\nversion: 1.0.0\n", "alias.sh": "alias k='echo k'\n"})
+	if err := EnablePackage("kit"); err != nil {
+		t.Fatalf("EnablePackage failed: %v", err)
+	}
+	if warnings, err := PinWarnings(); err != nil || len(warnings) != 0 {
+		t.Fatalf("PinWarnings = %v, %v; want none", warnings, err)
+	}
+
+	// Without its store copy, a package pinned to an unknown commit is
+	// read from its current files and reported.
+	lock, _ := LoadLockfile()
+	entry := lock.Packages["kit"]
+	os.RemoveAll(storePath(entry.Store))
+	entry.Commit = strings.Repeat("0", 40)
+	lock.Packages["kit"] = entry
+	if err := lock.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	warnings, err := PinWarnings()
+	if err != nil || len(warnings) != 1 || !strings.Contains(warnings[0], "not in the registry") {
+		t.Errorf("PinWarnings = %v, %v", warnings, err)
+	}
+}
+
+func TestDisableDefinition(t *testing.T) {
+	root := setupTestHome(t)
+	commit := setupTestRegistry(t, root)
+	commit("kit", map[string]string{"ah.yaml": "name: kit\nversion: 1.0.0\n", "alias.sh": "alias gs='git status'\nalias gc='git commit'\n"})
+	if err := EnablePackage("kit"); err != nil {
+		t.Fatalf("EnablePackage failed: %v", err)
+	}
+
+	if err := DisableDefinition("kit", "gc"); err != nil {
+		t.Fatalf("DisableDefinition failed: %v", err)
+	}
+	compiled, _ := os.ReadFile(filepath.Join(root, CompiledFile))
+	if strings.Contains(string(compiled), "git commit") || !strings.Contains(string(compiled), "git status") {
+		t.Errorf("expected only gc to be left out:\n%s", compiled)
+	}
+	if err := DisableDefinition("kit", "gc"); err == nil {
+		t.Error("expected an error disabling gc twice")
+	}
+	if err := DisableDefinition("kit", "nope"); err == nil {
+		t.Error("expected an error for an undefined alias")
+	}
+	defs, err := PackageDefinitions("kit")
+	if err != nil || len(defs) != 2 || defs[1].Name != "gc" || !defs[1].Disabled || defs[0].Disabled {
+		t.Errorf("PackageDefinitions = %+v, %v", defs, err)
+	}
+
+	// A disabled alias does not conflict.
+	incoming := filepath.Join(t.TempDir(), "incoming")
+	writePackage(t, incoming, map[string]string{"alias.sh": "alias gc='gcloud'\nalias gs='gsutil'\n"})
+	if conflicts, err := CheckConflicts(incoming); err != nil || len(conflicts) != 1 || conflicts["gs"] != "kit" {
+		t.Errorf("CheckConflicts = %v, %v; want only gs", conflicts, err)
+	}
+
+	if err := EnableDefinition("kit", "gc"); err != nil {
+		t.Fatalf("EnableDefinition failed: %v", err)
+	}
+	compiled, _ = os.ReadFile(filepath.Join(root, CompiledFile))
+	if !strings.Contains(string(compiled), "git commit") {
+		t.Errorf("expected gc to be back:\n%s", compiled)
+	}
+	if o, _ := LoadOverrides(); len(o.Disabled) != 0 {
+		t.Errorf("overrides not cleaned up: %+v", o.Disabled)
+	}
+}
+
+func TestRenameDefinition(t *testing.T) {
+	root := setupTestHome(t)
+	commit := setupTestRegistry(t, root)
+	commit("kit", map[string]string{"ah.yaml": "name: kit\nversion: 1.0.0\n", "alias.sh": "alias gc='git commit'\nalias gs='git status'\n"})
+	commit("cloud", map[string]string{"ah.yaml": "name: cloud\nversion: 1.0.0\n", "alias.sh": "alias gc='gcloud'\nalias gx='gcloud x'\n"})
+	if err := EnablePackage("kit"); err != nil {
+		t.Fatalf("EnablePackage failed: %v", err)
+	}
+	cloud := filepath.Join(root, RegistriesDir, DefaultRegistry, "registry", "cloud")
+	if conflicts, _ := CheckConflicts(cloud); conflicts["gc"] != "kit" {
+		t.Fatalf("expected gc to conflict, got %v", conflicts)
+	}
+
+	// The incoming package can be renamed before it is installed.
+	for _, bad := range []string{"gs", "gx", "-x"} {
+		if err := RenameDefinition("cloud", "gc", bad); err == nil {
+			t.Errorf("expected renaming gc to %q to fail", bad)
+		}
+	}
+	if err := RenameDefinition("cloud", "nope", "gcc"); err == nil {
+		t.Error("expected renaming an undefined alias to fail")
+	}
+	if err := RenameDefinition("cloud", "gc", "gcc"); err != nil {
+		t.Fatalf("RenameDefinition failed: %v", err)
+	}
+	if conflicts, err := CheckConflicts(cloud); err != nil || len(conflicts) != 0 {
+		t.Fatalf("CheckConflicts after rename = %v, %v", conflicts, err)
+	}
+	if err := EnablePackage("cloud"); err != nil {
+		t.Fatalf("EnablePackage failed: %v", err)
+	}
+	compiled, _ := os.ReadFile(filepath.Join(root, CompiledFile))
+	for _, want := range []string{"alias gc='git commit'", "alias gcc='gcloud'"} {
+		if !strings.Contains(string(compiled), want) {
+			t.Errorf("compiled file lacks %s:\n%s", want, compiled)
+		}
+	}
+	if defs, _ := PackageDefinitions("cloud"); defs[0].RenamedTo != "gcc" {
+		t.Errorf("PackageDefinitions = %+v", defs)
+	}
+
+	// Renamed names conflict by their new name.
+	incoming := filepath.Join(t.TempDir(), "other")
+	writePackage(t, incoming, map[string]string{"alias.sh": "alias gcc='cc'\n"})
+	if conflicts, _ := CheckConflicts(incoming); conflicts["gcc"] != "cloud" {
+		t.Errorf("expected gcc to conflict with cloud, got %v", conflicts)
+	}
+
+	// An Ahfile keeps renames, and drops them when it has none.
+	f := &Ahfile{Packages: []AhfilePackage{{Name: "kit"}, {Name: "cloud", Renames: map[string]string{"gc": "gcc"}}}}
+	if plan, err := Apply(f, true); err != nil || len(plan) != 0 {
+		t.Errorf("Apply(dry run) = %v, %v; want no changes", plan, err)
+	}
+	f.Packages[1].Renames = nil
+	if _, err := Apply(f, true); err == nil || !strings.Contains(err.Error(), "gc is defined by cloud and kit") {
+		t.Errorf("expected a conflict without the rename, got %v", err)
+	}
+
+	if err := RenameDefinition("cloud", "gc", ""); err != nil {
+		t.Fatalf("undoing the rename failed: %v", err)
+	}
+	if o, _ := LoadOverrides(); len(o.Renames) != 0 {
+		t.Errorf("renames not cleaned up: %v", o.Renames)
+	}
+}
+
+func TestInstallRenames(t *testing.T) {
+	root := setupTestHome(t)
+	commit := setupTestRegistry(t, root)
+	commit("kit", map[string]string{"ah.yaml": "name: kit\nversion: 1.0.0\n", "alias.sh": "alias gc='git commit'\n"})
+	commit("cloud", map[string]string{"ah.yaml": "name: cloud\nversion: 1.0.0\n", "alias.sh": "alias gc='gcloud'\nalias gx='gcloud x'\n"})
+	if err := EnablePackage("kit"); err != nil {
+		t.Fatalf("EnablePackage failed: %v", err)
+	}
+
+	// A failed install leaves no renames behind.
+	var conflictErr *ConflictError
+	if err := InstallPackage("cloud", map[string]string{"gx": "gy"}); !errors.As(err, &conflictErr) {
+		t.Fatalf("expected a conflict on gc, got %v", err)
+	}
+	if o, _ := LoadOverrides(); len(o.Renames) != 0 {
+		t.Errorf("renames recorded for a failed install: %v", o.Renames)
+	}
+
+	if err := InstallPackage("cloud", map[string]string{"gc": "gcc"}); err != nil {
+		t.Fatalf("InstallPackage failed: %v", err)
+	}
+	if o, _ := LoadOverrides(); o.Renames["cloud"]["gc"] != "gcc" {
+		t.Errorf("renames = %v, want cloud/gc -> gcc", o.Renames)
+	}
+	compiled, _ := os.ReadFile(filepath.Join(root, CompiledFile))
+	if !strings.Contains(string(compiled), "alias gcc='gcloud'") {
+		t.Errorf("compiled file lacks the renamed alias:\n%s", compiled)
+	}
+}
+
+func TestResolveConflict(t *testing.T) {
+	root := setupTestHome(t)
+	commit := setupTestRegistry(t, root)
+	commit("kit", map[string]string{"ah.yaml": "name: kit\nversion: 1.0.0\n", "alias.sh": "alias gc='git commit'\n"})
+	commit("cloud", map[string]string{"ah.yaml": "name: cloud\nversion: 1.0.0\n", "alias.sh": "alias gc='gcloud'\n"})
+	if err := EnablePackage("kit"); err != nil {
+		t.Fatalf("EnablePackage failed: %v", err)
+	}
+	cloud := filepath.Join(root, RegistriesDir, DefaultRegistry, "registry", "cloud")
+
+	// Deciding for the incoming package resolves the conflict up front.
+	if err := ResolveConflict("gc", "cloud"); err != nil {
+		t.Fatalf("ResolveConflict failed: %v", err)
+	}
+	if conflicts, err := CheckConflicts(cloud); err != nil || len(conflicts) != 0 {
+		t.Fatalf("CheckConflicts after resolving = %v, %v", conflicts, err)
+	}
+	// Checking does not count the incoming package as enabled in the
+	// overrides the caller passed in.
+	o, _ := LoadOverrides()
+	content, _ := LoadPackageContent(cloud)
+	if _, err := checkContentConflicts(o, "cloud", content); err != nil || o.active["cloud"] {
+		t.Errorf("checkContentConflicts = %v; cloud active: %v", err, o.active["cloud"])
+	}
+	if _, err := planConflicts(o, map[string]*PackageContent{"cloud": content}); err != nil || o.active["cloud"] {
+		t.Errorf("planConflicts = %v; cloud active: %v", err, o.active["cloud"])
+	}
+	if err := EnablePackage("cloud"); err != nil {
+		t.Fatalf("EnablePackage failed: %v", err)
+	}
+	expectOnly := func(want, not string) {
+		t.Helper()
+		compiled, _ := os.ReadFile(filepath.Join(root, CompiledFile))
+		if !strings.Contains(string(compiled), want) || strings.Contains(string(compiled), not) {
+			t.Errorf("compiled file should have %s and not %s:\n%s", want, not, compiled)
+		}
+	}
+	expectOnly("alias gc='gcloud'", "git commit")
+
+	// The decision survives upgrades and recompiles, and can be changed.
+	commit("kit", map[string]string{"ah.yaml": "name: kit\nversion: 1.1.0\n", "alias.sh": "alias gc='git commit -v'\n"})
+	if err := UpgradePackage("kit"); err != nil {
+		t.Fatalf("UpgradePackage failed: %v", err)
+	}
+	if err := TouchState(); err != nil {
+		t.Fatalf("TouchState failed: %v", err)
+	}
+	expectOnly("alias gc='gcloud'", "git commit")
+	if err := ResolveConflict("gc", "kit"); err != nil {
+		t.Fatalf("ResolveConflict failed: %v", err)
+	}
+	expectOnly("alias gc='git commit -v'", "gcloud")
+
+	// Apply honours and keeps it.
+	f := &Ahfile{Packages: []AhfilePackage{{Name: "kit"}, {Name: "cloud"}}}
+	if _, err := Apply(f, false); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	expectOnly("alias gc='git commit -v'", "gcloud")
+
+	// It only applies while the chosen package is enabled.
+	if err := DisablePackage("kit"); err != nil {
+		t.Fatalf("DisablePackage failed: %v", err)
+	}
+	expectOnly("alias gc='gcloud'", "git commit")
+	if r, _ := LoadResolutions(); r.Owners["gc"] != "kit" {
+		t.Errorf("resolutions = %v", r.Owners)
+	}
+}
+
+func TestEnableIfResolved(t *testing.T) {
+	root := setupTestHome(t)
+	commit := setupTestRegistry(t, root)
+	repo := filepath.Join(root, RegistriesDir, DefaultRegistry)
+	commit("kit", map[string]string{"ah.yaml": "name: kit\nversion: 1.0.0\n", "alias.sh": "alias gc='git commit'\n"})
+	commit("cloud", map[string]string{"ah.yaml": "name: cloud\nversion: 1.0.0\n", "alias.sh": "alias gc='gcloud'\n"})
+	if out, err := exec.Command("git", "-C", repo, "tag", "cloud/v1.0.0").CombinedOutput(); err != nil {
+		t.Fatalf("git tag failed: %v: %s", err, out)
+	}
+	commit("cloud", map[string]string{"ah.yaml": "name: cloud\nversion: 2.0.0\n", "alias.sh": "alias gc='gcloud v2'\n"})
+	if err := EnablePackage("kit"); err != nil {
+		t.Fatalf("EnablePackage failed: %v", err)
+	}
+
+	// The conflict UI pins the version 'ah install' would pick.
+	if err := PinPackage("cloud@^1"); err != nil {
+		t.Fatalf("PinPackage failed: %v", err)
+	}
+	conflicts, content, err := PendingConflicts("cloud")
+	if err != nil || conflicts["gc"] != "kit" {
+		t.Fatalf("PendingConflicts = %v, %v; want gc from kit", conflicts, err)
+	}
+	if desc, _ := content.Describe("gc"); desc != "gcloud" {
+		t.Errorf("pending gc = %q, want the pinned revision's", desc)
+	}
+	if enabled, err := EnableIfResolved("cloud"); err != nil || enabled {
+		t.Fatalf("EnableIfResolved with conflicts = %v, %v", enabled, err)
+	}
+
+	// Once resolved, it is enabled at that revision and keeps its constraint.
+	if err := ResolveConflict("gc", "kit"); err != nil {
+		t.Fatalf("ResolveConflict failed: %v", err)
+	}
+	if enabled, err := EnableIfResolved("cloud"); err != nil || !enabled {
+		t.Fatalf("EnableIfResolved = %v, %v; want enabled", enabled, err)
+	}
+	lock, _ := LoadLockfile()
+	if entry := lock.Packages["cloud"]; entry.Version != "1.0.0" || entry.Constraint != "^1" {
+		t.Errorf("cloud pinned as %+v, want 1.0.0 within ^1", entry)
+	}
+}
+
+func TestPriority(t *testing.T) {
+	root := setupTestHome(t)
+	writePackage(t, filepath.Join(root, ActiveDir, "a"), map[string]string{
+		"ah.yaml":  "name: a\nversion: 1.0.0\nenv:\n  - name: X\n    value: \"1\"\n",
+		"alias.sh": "alias gc='from-a'\n",
+	})
+	writePackage(t, filepath.Join(root, ActiveDir, "b"), map[string]string{
+		"ah.yaml":  "name: b\nversion: 1.0.0\nenv:\n  - name: X\n    value: \"1\"\n",
+		"alias.sh": "alias gc='from-b'\nalias gb='only-b'\n",
+	})
+	expect := func(winner, loser string) {
+		t.Helper()
+		compiled, _ := os.ReadFile(filepath.Join(root, CompiledFile))
+		if !strings.Contains(string(compiled), "alias gc='from-"+winner+"'") || strings.Contains(string(compiled), "from-"+loser) {
+			t.Errorf("expected only %s's gc:\n%s", winner, compiled)
+		}
+		if !strings.Contains(string(compiled), "alias gb='only-b'") || strings.Count(string(compiled), "export X=") != 1 {
+			t.Errorf("expected gb and a single X:\n%s", compiled)
+		}
+		shadows, err := ShadowedDefinitions()
+		if err != nil {
+			t.Fatalf("ShadowedDefinitions failed: %v", err)
+		}
+		// Env variables set to the same value are not reported.
+		if want := []Shadow{{Name: "gc", Package: loser, By: winner}}; !slices.Equal(shadows, want) {
+			t.Errorf("ShadowedDefinitions = %+v, want %+v", shadows, want)
+		}
+	}
+
+	// Ties go to the name that sorts first.
+	if err := CompileAliases(); err != nil {
+		t.Fatalf("CompileAliases failed: %v", err)
+	}
+	expect("a", "b")
+
+	if err := SetPriority("b", 5); err != nil {
+		t.Fatalf("SetPriority failed: %v", err)
+	}
+	expect("b", "a")
+	if err := SetPriority("nope", 1); err == nil {
+		t.Error("expected SetPriority of an unknown package to fail")
+	}
+
+	// Conflict choices take precedence.
+	o, _ := LoadOverrides()
+	o.Owners["gc"] = "a"
+	if err := o.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if err := CompileAliases(); err != nil {
+		t.Fatalf("CompileAliases failed: %v", err)
+	}
+	compiled, _ := os.ReadFile(filepath.Join(root, CompiledFile))
+	if !strings.Contains(string(compiled), "from-a") || strings.Contains(string(compiled), "from-b") {
+		t.Errorf("expected the conflict choice to win:\n%s", compiled)
+	}
+
+	if err := SetPriority("b", 0); err != nil {
+		t.Fatalf("SetPriority failed: %v", err)
+	}
+	if p, _ := Priorities(); len(p) != 0 {
+		t.Errorf("priority 0 should be dropped, got %v", p)
+	}
+}
+
+func TestPriority_Shims(t *testing.T) {
+	root := setupTestHome(t)
+	commit := setupTestRegistry(t, root)
+	commit("a", map[string]string{"ah.yaml": "name: a\nversion: 1.0.0\n", "alias.sh": "alias run='from-a'\n", "bin/tool": "#!/bin/sh\necho a\n"})
+	commit("b", map[string]string{"ah.yaml": "name: b\nversion: 1.0.0\n", "bin/run": "#!/bin/sh\necho b\n", "bin/tool": "#!/bin/sh\necho b\n"})
+	for _, pkg := range []string{"a", "b"} {
+		if err := EnablePackage(pkg); err != nil {
+			t.Fatalf("EnablePackage(%s) failed: %v", pkg, err)
+		}
+	}
+	binDir := filepath.Join(root, BinDir)
+	expectLink := func(name, pkg string) {
+		t.Helper()
+		target, err := os.Readlink(filepath.Join(binDir, name))
+		if pkg == "" {
+			if err == nil {
+				t.Errorf("expected no link for %s, got %s", name, target)
+			}
+			return
+		}
+		if want := filepath.Join(root, ActiveDir, pkg, BinDir, name); target != want {
+			t.Errorf("%s links to %q (%v), want %s", name, target, err, want)
+		}
+	}
+	expectLink("tool", "a")
+	expectLink("run", "") // a's alias takes precedence
+
+	if err := SetPriority("b", 5); err != nil {
+		t.Fatalf("SetPriority failed: %v", err)
+	}
+	expectLink("tool", "b")
+	expectLink("run", "b")
+
+	// An alias of a package with precedence hides an executable...
+	if err := SetPriority("a", 10); err != nil {
+		t.Fatalf("SetPriority failed: %v", err)
+	}
+	expectLink("tool", "a")
+	expectLink("run", "")
+
+	// ...unless it is compiled under another name.
+	if err := RenameDefinition("a", "run", "run-a"); err != nil {
+		t.Fatalf("RenameDefinition failed: %v", err)
+	}
+	expectLink("run", "b")
+	if shadows, _ := ShadowedDefinitions(); !slices.Equal(shadows, []Shadow{{Name: "tool", Package: "b", By: "a"}}) {
+		t.Errorf("ShadowedDefinitions = %+v", shadows)
+	}
+}
+
+func TestRemovePackage_ForgetsOverrides(t *testing.T) {
+	root := setupTestHome(t)
+	commit := setupTestRegistry(t, root)
+	commit("kit", map[string]string{"ah.yaml": "name: kit\nversion: 1.0.0\n", "alias.sh": "alias gc='git commit'\nalias kk='echo k'\n"})
+	commit("cloud", map[string]string{"ah.yaml": "name: cloud\nversion: 1.0.0\n", "alias.sh": "alias gc='gcloud'\nalias gx='gcloud x'\nalias gz='gcloud z'\n"})
+	for _, pkg := range []string{"kit", "cloud"} {
+		if err := EnablePackage(pkg); err != nil {
+			t.Fatalf("EnablePackage(%s) failed: %v", pkg, err)
+		}
+	}
+	steps := []error{
+		ResolveConflict("gc", "cloud"),
+		SetPriority("cloud", 10),
+		RenameDefinition("cloud", "gx", "gy"),
+		DisableDefinition("cloud", "gz"),
+		DisableDefinition("kit", "kk"),
+	}
+	for i, err := range steps {
+		if err != nil {
+			t.Fatalf("step %d failed: %v", i, err)
+		}
+	}
+	o, _ := LoadOverrides()
+	o.Owners["gy"] = "cloud"
+	if err := o.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	if err := RemovePackage("cloud"); err != nil {
+		t.Fatalf("RemovePackage failed: %v", err)
+	}
+	o, _ = LoadOverrides()
+	if len(o.Owners) != 0 || len(o.Renames) != 0 || len(o.Priorities) != 0 || !slices.Equal(o.Disabled["kit"], []string{"kk"}) || len(o.Disabled) != 1 {
+		t.Errorf("overrides after removing cloud = %+v, want only kit's", o)
+	}
+	if r, _ := LoadResolutions(); len(r.Owners) != 0 {
+		t.Errorf("resolutions after removing cloud = %v", r.Owners)
+	}
+}
@@ -4,16 +4,44 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 
+	"github.com/sarkartanmay393/ah/pkg/semver"
 	"gopkg.in/yaml.v3"
 )
 
 type PackageMetadata struct {
-	Name        string `yaml:"name"`
-	Description string `yaml:"description"`
-	Version     string `yaml:"version"`
-	Author      string `yaml:"author"`
-	Website     string `yaml:"website"`
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Version     string   `yaml:"version"`
+	Author      string   `yaml:"author"`
+	Website     string   `yaml:"website"`
+	Tags        []string `yaml:"tags,omitempty"`
+	// Dependencies maps packages this one needs (optionally qualified with
+	// a registry) to a version constraint ("^1.2", "" for any version).
+	Dependencies map[string]string `yaml:"dependencies,omitempty"`
+	Env          []EnvVar          `yaml:"env,omitempty"`
+}
+
+// EnvVar is an environment variable exported by a package.
+// Values are literal: they are quoted when compiled and never expanded.
+type EnvVar struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+	// IfUnset only sets the variable when the user has not set it already.
+	IfUnset bool `yaml:"if_unset,omitempty"`
+}
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// protectedEnv lists variables packages may not set, because changing them
+// would break the shell or let a package run arbitrary code.
+var protectedEnv = map[string]bool{
+	"PATH": true, "HOME": true, "SHELL": true, "USER": true, "IFS": true,
+	"PWD": true, "OLDPWD": true, "ENV": true, "BASH_ENV": true, "CDPATH": true,
+	"PROMPT_COMMAND": true, "PS1": true, "PS2": true, "PS4": true,
+	"ZDOTDIR": true, "LD_PRELOAD": true, "LD_LIBRARY_PATH": true,
 }
 
 func LoadMetadata(packageDir string) (*PackageMetadata, error) {
@@ -27,14 +55,28 @@ func LoadMetadata(packageDir string) (*PackageMetadata, error) {
 		}
 		return nil, err
 	}
-	if info.Size() > 10*1024 { // 10KB Limit
+	if info.Size() > maxMetadataSize {
 		return nil, fmt.Errorf("ah.yaml is too large (max 10KB)")
 	}
 
-	data, err := os.ReadFile(path)
+	return loadMetadata(dirFiles(packageDir))
+}
+
+// maxMetadataSize is the largest ah.yaml accepted.
+const maxMetadataSize = 10 * 1024
+
+// loadMetadata reads and validates ah.yaml from any package source.
+func loadMetadata(files packageFiles) (*PackageMetadata, error) {
+	data, err := files.ReadFile("ah.yaml")
 	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, os.ErrNotExist
+		}
 		return nil, err
 	}
+	if len(data) > maxMetadataSize {
+		return nil, fmt.Errorf("ah.yaml is too large (max 10KB)")
+	}
 
 	var meta PackageMetadata
 	if err := yaml.Unmarshal(data, &meta); err != nil {
@@ -44,6 +86,37 @@ func LoadMetadata(packageDir string) (*PackageMetadata, error) {
 	if meta.Name == "" || meta.Version == "" {
 		return nil, fmt.Errorf("ah.yaml must contain 'name' and 'version'")
 	}
+	if _, err := semver.Parse(meta.Version); err != nil {
+		return nil, fmt.Errorf("ah.yaml: %w (use semantic versioning, e.g. 1.0.0)", err)
+	}
+
+	if err := validateEnv(meta.Env); err != nil {
+		return nil, err
+	}
+	if err := validateDependencies(meta.Name, meta.Dependencies); err != nil {
+		return nil, err
+	}
 
 	return &meta, nil
 }
+
+func validateEnv(vars []EnvVar) error {
+	seen := make(map[string]bool)
+	for _, v := range vars {
+		if !envNamePattern.MatchString(v.Name) {
+			return fmt.Errorf("invalid env variable name %q", v.Name)
+		}
+		if protectedEnv[v.Name] || strings.HasPrefix(v.Name, "AH_") ||
+			strings.HasPrefix(v.Name, "DYLD_") {
+			return fmt.Errorf("packages may not set %s", v.Name)
+		}
+		if strings.ContainsRune(v.Value, 0) {
+			return fmt.Errorf("env variable %s contains a NUL byte", v.Name)
+		}
+		if seen[v.Name] {
+			return fmt.Errorf("env variable %s is defined twice", v.Name)
+		}
+		seen[v.Name] = true
+	}
+	return nil
+}
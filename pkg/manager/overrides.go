@@ -0,0 +1,501 @@
+package manager
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/sarkartanmay393/ah/pkg/parser"
+	"gopkg.in/yaml.v3"
+)
+
+// Overrides are the user's changes on top of the content of their
+// packages, stored in ~/.ah/overrides.yaml. They are applied when
+// compiling, so packages themselves are never modified.
+type Overrides struct {
+	// Disabled lists, per package, the definitions that are not compiled.
+	Disabled map[string][]string `yaml:"disabled,omitempty"`
+	// Owners maps a name defined by several packages (or "$NAME" for an
+	// env variable) to the package whose definition is used. Names are
+	// the ones compiled, after renames.
+	Owners map[string]string `yaml:"owners,omitempty"`
+	// Renames maps, per package, the name of an alias or function to the
+	// name it is compiled as.
+	Renames map[string]map[string]string `yaml:"renames,omitempty"`
+	// Priorities sets, per package, the precedence of its definitions
+	// when other enabled packages define the same names (higher wins,
+	// default 0). Owners and resolutions are applied first.
+	Priorities map[string]int `yaml:"priorities,omitempty"`
+
+	// resolved are the Resolutions. They apply when the owner is in
+	// active: the enabled packages, or those about to be.
+	resolved map[string]string
+	active   map[string]bool
+}
+
+// LoadOverrides reads ~/.ah/overrides.yaml, together with the conflict
+// Resolutions. A missing file yields empty overrides.
+func LoadOverrides() (*Overrides, error) {
+	root, err := GetRootDir()
+	if err != nil {
+		return nil, err
+	}
+
+	o := &Overrides{}
+	data, err := os.ReadFile(filepath.Join(root, OverridesFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, o); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", OverridesFile, err)
+	}
+
+	r, err := LoadResolutions()
+	if err != nil {
+		return nil, err
+	}
+	o.resolved = r.Owners
+	o.active = make(map[string]bool)
+	active, err := ListPackages()
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range active {
+		o.active[pkg] = true
+	}
+	return o.normalize(), nil
+}
+
+// Save writes the overrides atomically. Assumes LOCK IS HELD.
+func (o *Overrides) Save() error {
+	root, err := GetRootDir()
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(o.normalize())
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(root, OverridesFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// normalize allocates nil maps, drops default priorities and sorts and
+// de-duplicates the disabled lists, dropping empty ones, so that equal
+// overrides marshal equally.
+func (o *Overrides) normalize() *Overrides {
+	if o.Disabled == nil {
+		o.Disabled = make(map[string][]string)
+	}
+	if o.Owners == nil {
+		o.Owners = make(map[string]string)
+	}
+	if o.Renames == nil {
+		o.Renames = make(map[string]map[string]string)
+	}
+	if o.Priorities == nil {
+		o.Priorities = make(map[string]int)
+	}
+	for pkg, priority := range o.Priorities {
+		if priority == 0 {
+			delete(o.Priorities, pkg)
+		}
+	}
+	for pkg, renames := range o.Renames {
+		if len(renames) == 0 {
+			delete(o.Renames, pkg)
+		}
+	}
+	for pkg, names := range o.Disabled {
+		if len(names) == 0 {
+			delete(o.Disabled, pkg)
+			continue
+		}
+		sort.Strings(names)
+		out := names[:1]
+		for _, n := range names[1:] {
+			if n != out[len(out)-1] {
+				out = append(out, n)
+			}
+		}
+		o.Disabled[pkg] = out
+	}
+	return o
+}
+
+// IsDisabled reports whether the user disabled a package's definition.
+func (o *Overrides) IsDisabled(pkg, name string) bool {
+	for _, n := range o.Disabled[pkg] {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// exposedName returns the name pkg's definition of name is compiled as.
+func (o *Overrides) exposedName(pkg, name string) string {
+	if renamed, ok := o.Renames[pkg][name]; ok {
+		return renamed
+	}
+	return name
+}
+
+// loses reports whether another package owns a compiled name, by a
+// conflict choice or by a resolution in favour of an active package.
+func (o *Overrides) loses(pkg, name string) bool {
+	if owner, ok := o.Owners[name]; ok {
+		return owner != pkg
+	}
+	owner, ok := o.resolved[name]
+	return ok && owner != pkg && o.active[owner]
+}
+
+// activating returns a copy of o in which resolutions also count pkgs as
+// enabled, leaving o unchanged.
+func (o *Overrides) activating(pkgs ...string) *Overrides {
+	c := *o
+	c.active = maps.Clone(o.active)
+	if c.active == nil {
+		c.active = make(map[string]bool)
+	}
+	for _, pkg := range pkgs {
+		c.active[pkg] = true
+	}
+	return &c
+}
+
+// sameChoices reports whether two overrides store the same choices
+// (resolutions are not stored with them).
+func (o *Overrides) sameChoices(other *Overrides) bool {
+	return reflect.DeepEqual(o.Disabled, other.Disabled) &&
+		reflect.DeepEqual(o.Owners, other.Owners) &&
+		reflect.DeepEqual(o.Renames, other.Renames) &&
+		reflect.DeepEqual(o.Priorities, other.Priorities)
+}
+
+// forget drops every choice about a package: its disabled definitions,
+// renames and priority, and the names it owns. It reports whether there
+// were any.
+func (o *Overrides) forget(pkg string) bool {
+	_, disabled := o.Disabled[pkg]
+	_, renamed := o.Renames[pkg]
+	_, prioritized := o.Priorities[pkg]
+	changed := disabled || renamed || prioritized
+	delete(o.Disabled, pkg)
+	delete(o.Renames, pkg)
+	delete(o.Priorities, pkg)
+	for name, owner := range o.Owners {
+		if owner == pkg {
+			delete(o.Owners, name)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// expose returns a copy of content as the user configured it: without
+// disabled definitions, and with aliases and functions renamed.
+func (o *Overrides) expose(pkg string, content *PackageContent) *PackageContent {
+	out := *content
+	out.Aliases = nil
+	for _, a := range content.Aliases {
+		if !o.IsDisabled(pkg, a.Name) {
+			a.Name = o.exposedName(pkg, a.Name)
+			out.Aliases = append(out.Aliases, a)
+		}
+	}
+	out.Functions = nil
+	for _, f := range content.Functions {
+		if !o.IsDisabled(pkg, f.Name) {
+			f.Name = o.exposedName(pkg, f.Name)
+			out.Functions = append(out.Functions, f)
+		}
+	}
+	out.Shims = nil
+	for _, s := range content.Shims {
+		if !o.IsDisabled(pkg, s) {
+			out.Shims = append(out.Shims, s)
+		}
+	}
+	out.Env = nil
+	for _, v := range content.Env {
+		if !o.IsDisabled(pkg, "$"+v.Name) {
+			out.Env = append(out.Env, v)
+		}
+	}
+	return &out
+}
+
+// apply returns the content of pkg that is compiled: expose without the
+// definitions another package owns.
+func (o *Overrides) apply(pkg string, content *PackageContent) *PackageContent {
+	out := o.expose(pkg, content)
+	out.Aliases = slices.DeleteFunc(out.Aliases, func(a parser.AliasDef) bool { return o.loses(pkg, a.Name) })
+	out.Functions = slices.DeleteFunc(out.Functions, func(f parser.FunctionDef) bool { return o.loses(pkg, f.Name) })
+	out.Shims = slices.DeleteFunc(out.Shims, func(s string) bool { return o.loses(pkg, s) })
+	out.Env = slices.DeleteFunc(out.Env, func(v EnvVar) bool { return o.loses(pkg, "$"+v.Name) })
+	return out
+}
+
+// Definition is one thing a package defines, with its state in the
+// overrides.
+type Definition struct {
+	// Name is the alias, function or executable name, or "$NAME" for an
+	// env variable.
+	Name string
+	// Kind is "alias", "function", "executable" or "env".
+	Kind string
+	// Value describes what the name expands to.
+	Value    string
+	Disabled bool
+	// RenamedTo is the name it is compiled as, if the user renamed it.
+	RenamedTo string
+}
+
+// PackageDefinitions returns the definitions of an installed package at its
+// pinned revision, in the order Names lists them, then env variables.
+func PackageDefinitions(packageName string) ([]Definition, error) {
+	content, err := LoadActiveContent(packageName)
+	if err != nil {
+		return nil, err
+	}
+	o, err := LoadOverrides()
+	if err != nil {
+		return nil, err
+	}
+
+	var defs []Definition
+	add := func(name, kind string) {
+		value, _ := content.Describe(name)
+		defs = append(defs, Definition{Name: name, Kind: kind, Value: value, Disabled: o.IsDisabled(packageName, name), RenamedTo: o.Renames[packageName][name]})
+	}
+	for _, a := range content.Aliases {
+		add(a.Name, "alias")
+	}
+	for _, f := range content.Functions {
+		add(f.Name, "function")
+	}
+	for _, s := range content.Shims {
+		add(s, "executable")
+	}
+	for _, v := range content.Env {
+		add("$"+v.Name, "env")
+	}
+	return defs, nil
+}
+
+// DisableDefinition keeps one definition of an installed package (an
+// alias, function, executable or "$NAME" env variable) out of the compiled
+// files, without disabling the rest of the package.
+func DisableDefinition(packageName, name string) error {
+	return setDefinitionDisabled(packageName, name, true)
+}
+
+// EnableDefinition undoes DisableDefinition.
+func EnableDefinition(packageName, name string) error {
+	return setDefinitionDisabled(packageName, name, false)
+}
+
+func setDefinitionDisabled(packageName, name string, disabled bool) error {
+	return WithLock(func() error {
+		lock, err := LoadLockfile()
+		if err != nil {
+			return err
+		}
+		if _, ok := lock.Packages[packageName]; !ok {
+			return fmt.Errorf("package %s is not installed", packageName)
+		}
+		o, err := LoadOverrides()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case disabled && o.IsDisabled(packageName, name):
+			return fmt.Errorf("%s/%s is already disabled", packageName, name)
+		case !disabled && !o.IsDisabled(packageName, name):
+			return fmt.Errorf("%s/%s is not disabled", packageName, name)
+		case disabled:
+			content, err := lock.loadContent(packageName)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", packageName, err)
+			}
+			if _, ok := content.Describe(name); !ok {
+				return fmt.Errorf("package %s does not define %s", packageName, name)
+			}
+			o.Disabled[packageName] = append(o.Disabled[packageName], name)
+		default:
+			o.Disabled[packageName] = slices.DeleteFunc(o.Disabled[packageName], func(n string) bool { return n == name })
+		}
+		if err := o.Save(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", OverridesFile, err)
+		}
+
+		if err := CompileAliases(); err != nil {
+			fmt.Printf("Warning: Failed to compile aliases: %v\n", err)
+		}
+		if err := syncShims(); err != nil {
+			fmt.Printf("Warning: Failed to link executables: %v\n", err)
+		}
+		return bumpStateGeneration()
+	})
+}
+
+// validDefinitionName reports whether name can be used for both an alias
+// and a function.
+func validDefinitionName(name string) bool {
+	return parser.IsValidName(name) && !strings.HasPrefix(name, "-")
+}
+
+// RenameDefinition compiles an alias or function of a package under
+// another name, for example to resolve a conflict. The package does not
+// have to be installed yet; the rename applies once it is. An empty
+// newName (or the original name) undoes the rename. The new name may not
+// clash with the package's other definitions or with an enabled package.
+func RenameDefinition(packageName, name, newName string) error {
+	return WithLock(func() error {
+		lock, err := LoadLockfile()
+		if err != nil {
+			return err
+		}
+		content, err := lock.packageContent(packageName)
+		if err != nil {
+			return err
+		}
+		// The name may be qualified with a registry; overrides are not.
+		_, packageName = splitPackageName(packageName)
+		o, err := LoadOverrides()
+		if err != nil {
+			return err
+		}
+
+		if err := o.rename(packageName, content, name, newName); err != nil {
+			return err
+		}
+		if newName != "" && newName != name {
+			if owner, err := lock.definedBy(o, newName, packageName); err != nil {
+				return err
+			} else if owner != "" {
+				return fmt.Errorf("%s is already defined by %s", newName, owner)
+			}
+		}
+		if err := o.Save(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", OverridesFile, err)
+		}
+
+		root, err := GetRootDir()
+		if err != nil {
+			return err
+		}
+		if _, err := os.Lstat(filepath.Join(root, ActiveDir, packageName)); err != nil {
+			return nil
+		}
+		if err := CompileAliases(); err != nil {
+			fmt.Printf("Warning: Failed to compile aliases: %v\n", err)
+		}
+		if err := syncShims(); err != nil {
+			fmt.Printf("Warning: Failed to link executables: %v\n", err)
+		}
+		return bumpStateGeneration()
+	})
+}
+
+// rename records that a package's alias or function name is compiled as
+// newName, or with an empty newName that it no longer is. It checks that
+// the package defines name and does not define newName otherwise.
+func (o *Overrides) rename(pkg string, content *PackageContent, name, newName string) error {
+	renames := maps.Clone(o.Renames[pkg])
+	if renames == nil {
+		renames = make(map[string]string)
+	}
+	if newName == "" || newName == name {
+		if _, ok := renames[name]; !ok {
+			return fmt.Errorf("%s/%s is not renamed", pkg, name)
+		}
+		delete(renames, name)
+		o.Renames[pkg] = renames
+		return nil
+	}
+
+	if !slices.ContainsFunc(content.Aliases, func(a parser.AliasDef) bool { return a.Name == name }) &&
+		!slices.ContainsFunc(content.Functions, func(f parser.FunctionDef) bool { return f.Name == name }) {
+		return fmt.Errorf("package %s defines no alias or function %s", pkg, name)
+	}
+	if !validDefinitionName(newName) {
+		return fmt.Errorf("invalid name %q", newName)
+	}
+	renames[name] = newName
+	o.Renames[pkg] = renames
+
+	defs := 0
+	for _, n := range o.expose(pkg, content).Names() {
+		if n == newName {
+			defs++
+		}
+	}
+	if defs > 1 {
+		return fmt.Errorf("package %s already defines %s", pkg, newName)
+	}
+	return nil
+}
+
+// renameAll applies rename to each of renames (name -> new name), in
+// name order.
+func (o *Overrides) renameAll(pkg string, content *PackageContent, renames map[string]string) error {
+	for _, name := range sortedKeys(renames) {
+		if err := o.rename(pkg, content, name, renames[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// packageContent reads an installed package at its pinned revision, or
+// else the registry's copy. The name may be qualified with a registry.
+// Assumes LOCK IS HELD.
+func (l *Lockfile) packageContent(packageName string) (*PackageContent, error) {
+	if regName, bare := splitPackageName(packageName); regName == "" || regName == l.Packages[bare].registry() {
+		if _, ok := l.Packages[bare]; ok {
+			return l.loadContent(bare)
+		}
+	}
+	reg, bare, err := l.findPackage(packageName)
+	if err != nil {
+		return nil, err
+	}
+	files, _ := reg.headFiles(bare)
+	return loadContent(files, filepath.Join(reg.ContentDir(), bare))
+}
+
+// definedBy returns the enabled package, other than skip, that compiles
+// name under the overrides o, or "" if none does.
+func (l *Lockfile) definedBy(o *Overrides, name, skip string) (string, error) {
+	pkgs, err := ListPackages()
+	if err != nil {
+		return "", err
+	}
+	for _, pkg := range pkgs {
+		if pkg == skip {
+			continue
+		}
+		content, err := l.loadContent(pkg)
+		if err != nil {
+			continue
+		}
+		if slices.Contains(o.apply(pkg, content).Names(), name) {
+			return pkg, nil
+		}
+	}
+	return "", nil
+}
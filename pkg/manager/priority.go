@@ -0,0 +1,165 @@
+package manager
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/sarkartanmay393/ah/pkg/parser"
+)
+
+// Shadow is a definition that is not compiled because another enabled
+// package defines the same name and takes precedence.
+type Shadow struct {
+	// Name is the compiled name, or "$NAME" for an env variable.
+	Name string
+	// Package is the package whose definition is hidden.
+	Package string
+	// By is the package whose definition is used.
+	By string
+}
+
+// precedes reports whether package a's definitions win over b's: the
+// higher priority wins, then the name that sorts first.
+func (o *Overrides) precedes(a, b string) bool {
+	if o.Priorities[a] != o.Priorities[b] {
+		return o.Priorities[a] > o.Priorities[b]
+	}
+	return a < b
+}
+
+// byPrecedence sorts package names, winners first.
+func (o *Overrides) byPrecedence(pkgs []string) {
+	sort.Slice(pkgs, func(i, j int) bool { return o.precedes(pkgs[i], pkgs[j]) })
+}
+
+// shadow removes from each package (content as returned by apply) the
+// definitions of names a package with precedence also defines, so that
+// every name is compiled once. Env variables set to the same value are
+// not reported. It returns the packages in their original order and the
+// hidden definitions sorted by name.
+func (o *Overrides) shadow(pkgs []CompiledPackage) ([]CompiledPackage, []Shadow) {
+	names := make([]string, 0, len(pkgs))
+	defs := make(map[string]map[string]string)
+	for _, p := range pkgs {
+		names = append(names, p.Name)
+		defs[p.Name] = p.Content.definitions()
+	}
+	o.byPrecedence(names)
+	winner := make(map[string]string)
+	for _, pkg := range names {
+		for name := range defs[pkg] {
+			if _, ok := winner[name]; !ok {
+				winner[name] = pkg
+			}
+		}
+	}
+
+	var shadows []Shadow
+	out := make([]CompiledPackage, 0, len(pkgs))
+	for _, p := range pkgs {
+		for name, desc := range defs[p.Name] {
+			by := winner[name]
+			if by != p.Name && (!strings.HasPrefix(name, "$") || desc != defs[by][name]) {
+				shadows = append(shadows, Shadow{Name: name, Package: p.Name, By: by})
+			}
+		}
+		hidden := func(name string) bool { return winner[name] != p.Name }
+		content := *p.Content
+		content.Aliases = slices.DeleteFunc(slices.Clone(content.Aliases), func(a parser.AliasDef) bool { return hidden(a.Name) })
+		content.Functions = slices.DeleteFunc(slices.Clone(content.Functions), func(f parser.FunctionDef) bool { return hidden(f.Name) })
+		content.Shims = slices.DeleteFunc(slices.Clone(content.Shims), hidden)
+		content.Env = slices.DeleteFunc(slices.Clone(content.Env), func(v EnvVar) bool { return hidden("$" + v.Name) })
+		out = append(out, CompiledPackage{Name: p.Name, Content: &content})
+	}
+	sort.Slice(shadows, func(i, j int) bool {
+		if shadows[i].Name != shadows[j].Name {
+			return shadows[i].Name < shadows[j].Name
+		}
+		return shadows[i].Package < shadows[j].Package
+	})
+	return out, shadows
+}
+
+// SetPriority sets the precedence of a package's definitions over those
+// of other enabled packages defining the same names; higher wins, 0 is
+// the default. Conflict choices and resolutions still take precedence.
+func SetPriority(packageName string, priority int) error {
+	_, packageName = splitPackageName(packageName)
+	return WithLock(func() error {
+		lock, err := LoadLockfile()
+		if err != nil {
+			return err
+		}
+		active, err := ListPackages()
+		if err != nil {
+			return err
+		}
+		if _, ok := lock.Packages[packageName]; !ok && !slices.Contains(active, packageName) {
+			return fmt.Errorf("package %s is not installed", packageName)
+		}
+
+		o, err := LoadOverrides()
+		if err != nil {
+			return err
+		}
+		o.Priorities[packageName] = priority
+		if err := o.Save(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", OverridesFile, err)
+		}
+
+		if err := CompileAliases(); err != nil {
+			fmt.Printf("Warning: Failed to compile aliases: %v\n", err)
+		}
+		if err := syncShims(); err != nil {
+			fmt.Printf("Warning: Failed to link executables: %v\n", err)
+		}
+		return bumpStateGeneration()
+	})
+}
+
+// Priorities returns the packages with a priority other than 0.
+func Priorities() (map[string]int, error) {
+	o, err := LoadOverrides()
+	if err != nil {
+		return nil, err
+	}
+	return o.Priorities, nil
+}
+
+// ShadowedDefinitions returns the definitions of enabled packages that are
+// not compiled because another package takes precedence, sorted by name.
+func ShadowedDefinitions() ([]Shadow, error) {
+	lock, err := LoadLockfile()
+	if err != nil {
+		return nil, err
+	}
+	o, err := LoadOverrides()
+	if err != nil {
+		return nil, err
+	}
+	_, shadows, err := lock.compiledPackages(o)
+	return shadows, err
+}
+
+// compiledPackages returns what is compiled of each enabled package under
+// the overrides o (apply, then shadow), with the hidden definitions.
+// Packages that fail to load are skipped.
+func (l *Lockfile) compiledPackages(o *Overrides) ([]CompiledPackage, []Shadow, error) {
+	active, err := ListPackages()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var pkgs []CompiledPackage
+	for _, pkg := range active {
+		content, err := l.loadContent(pkg)
+		if err != nil {
+			continue
+		}
+		pkgs = append(pkgs, CompiledPackage{Name: pkg, Content: o.apply(pkg, content)})
+	}
+	pkgs, shadows := o.shadow(pkgs)
+	return pkgs, shadows, nil
+}
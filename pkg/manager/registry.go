@@ -5,37 +5,301 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
-// RegistryDir is the subdirectory name where the package registry is cloned.
-const RegistryDir = "registry"
+// RegistriesDir is the subdirectory holding one clone per registry.
+const RegistriesDir = "registries"
 
-// UpdateRegistry ensures the package registry is cloned and up to date.
-// It uses AH_REGISTRY_URL environment variable if set, otherwise defaults
-// to the official repository. Operations timeout after 30 seconds.
-func UpdateRegistry() error {
-	repoURL := os.Getenv("AH_REGISTRY_URL")
-	if repoURL == "" {
-		repoURL = RegistryRepo
+// legacyRegistryDir is where versions before multi-registry support
+// cloned the only registry.
+const legacyRegistryDir = "registry"
+
+// DefaultRegistry is the name of the public registry.
+const DefaultRegistry = "official"
+
+// Registry transports.
+const (
+	// RegistryGit registries are git repositories, cloned and pulled.
+	RegistryGit = "git"
+	// RegistryHTTP registries serve an index.json and package tarballs
+	// over HTTP(S), for machines without git.
+	RegistryHTTP = "http"
+)
+
+// Registry is a git repository of packages.
+type Registry struct {
+	// Name identifies the registry in qualified package names
+	// ("corp/git-tools") and names its clone directory.
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	// Type is the transport: RegistryGit (the default) or RegistryHTTP.
+	Type string `yaml:"type,omitempty"`
+	// Subdir is the directory inside the repository holding the packages.
+	// It defaults to "registry", the layout of the public registry; use "."
+	// for packages at the top level. HTTP registries ignore it.
+	Subdir string `yaml:"subdir,omitempty"`
+}
+
+type registriesConfig struct {
+	// TTL is how long fetched registries count as fresh (see
+	// RegistryTTL), as a duration ("15m").
+	TTL        string     `yaml:"ttl,omitempty"`
+	Registries []Registry `yaml:"registries"`
+}
+
+// loadRegistriesConfig reads registries.yaml as written, without
+// defaults. Without the file only the public registry is configured.
+func loadRegistriesConfig() (*registriesConfig, error) {
+	root, err := GetRootDir()
+	if err != nil {
+		return nil, err
 	}
 
+	cfg := &registriesConfig{Registries: []Registry{{Name: DefaultRegistry, URL: RegistryRepo}}}
+	data, err := os.ReadFile(filepath.Join(root, RegistriesFile))
+	if err == nil {
+		cfg = &registriesConfig{}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", RegistriesFile, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// save writes registries.yaml.
+func (c *registriesConfig) save() error {
 	root, err := GetRootDir()
 	if err != nil {
 		return err
 	}
-	registryPath := filepath.Join(root, RegistryDir)
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(root, RegistriesFile), data, 0644)
+}
+
+// LoadRegistries returns the configured registries in resolution order.
+// Without a registries.yaml only the public registry is configured. The
+// AH_REGISTRY_URL environment variable overrides the public registry's URL.
+func LoadRegistries() ([]Registry, error) {
+	cfg, err := loadRegistriesConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range cfg.Registries {
+		r := &cfg.Registries[i]
+		if r.Type == "" {
+			r.Type = RegistryGit
+		}
+		if r.Type == RegistryHTTP {
+			r.Subdir = "."
+		} else if r.Subdir == "" {
+			r.Subdir = "registry"
+		}
+		if url := os.Getenv("AH_REGISTRY_URL"); url != "" && r.Name == DefaultRegistry {
+			r.URL = url
+		}
+	}
+	return cfg.Registries, nil
+}
+
+// SaveRegistries replaces the configured registries.
+func SaveRegistries(regs []Registry) error {
+	cfg, err := loadRegistriesConfig()
+	if err != nil {
+		return err
+	}
+	cfg.Registries = regs
+	return cfg.save()
+}
+
+// AddRegistry adds a registry at the given position in the resolution
+// order (0 is first; out of range appends).
+func AddRegistry(reg Registry, position int) error {
+	if !packageNamePattern.MatchString(reg.Name) {
+		return fmt.Errorf("invalid registry name %q", reg.Name)
+	}
+	if reg.URL == "" {
+		return fmt.Errorf("registry %s needs a URL", reg.Name)
+	}
+	if reg.Type != "" && reg.Type != RegistryGit && reg.Type != RegistryHTTP {
+		return fmt.Errorf("unknown registry type %q (want %s or %s)", reg.Type, RegistryGit, RegistryHTTP)
+	}
+	if reg.Subdir != "" && (path.IsAbs(reg.Subdir) || strings.HasPrefix(path.Clean(reg.Subdir), "..")) {
+		return fmt.Errorf("subdir must be inside the repository")
+	}
+
+	return WithLock(func() error {
+		cfg, err := loadRegistriesConfig()
+		if err != nil {
+			return err
+		}
+		regs := cfg.Registries
+		for _, r := range regs {
+			if r.Name == reg.Name {
+				return fmt.Errorf("registry %s already exists", reg.Name)
+			}
+		}
+		if position < 0 || position > len(regs) {
+			position = len(regs)
+		}
+		cfg.Registries = append(regs[:position], append([]Registry{reg}, regs[position:]...)...)
+		return cfg.save()
+	})
+}
+
+// RemoveRegistry removes a registry and its clone. Installed packages keep
+// working from the store but can no longer be upgraded.
+func RemoveRegistry(name string) error {
+	return WithLock(func() error {
+		cfg, err := loadRegistriesConfig()
+		if err != nil {
+			return err
+		}
+		for i, r := range cfg.Registries {
+			if r.Name != name {
+				continue
+			}
+			cfg.Registries = append(cfg.Registries[:i], cfg.Registries[i+1:]...)
+			if err := cfg.save(); err != nil {
+				return err
+			}
+			os.Remove(r.statusPath())
+			return os.RemoveAll(r.Dir())
+		}
+		return fmt.Errorf("registry %s not found", name)
+	})
+}
+
+// ReorderRegistries moves the named registries to the front of the
+// resolution order, in the given order.
+func ReorderRegistries(names []string) error {
+	return WithLock(func() error {
+		cfg, err := loadRegistriesConfig()
+		if err != nil {
+			return err
+		}
+		regs := cfg.Registries
+		var ordered []Registry
+		used := make(map[string]bool)
+		for _, name := range names {
+			found := false
+			for _, r := range regs {
+				if r.Name == name && !used[name] {
+					ordered = append(ordered, r)
+					used[name] = true
+					found = true
+				}
+			}
+			if !found {
+				return fmt.Errorf("registry %s not found", name)
+			}
+		}
+		for _, r := range regs {
+			if !used[r.Name] {
+				ordered = append(ordered, r)
+			}
+		}
+		cfg.Registries = ordered
+		return cfg.save()
+	})
+}
+
+// Dir returns the directory the registry is cloned to.
+func (r Registry) Dir() string {
+	root, _ := GetRootDir()
+	return filepath.Join(root, RegistriesDir, r.Name)
+}
+
+// ContentDir returns the directory holding the registry's packages.
+func (r Registry) ContentDir() string {
+	return filepath.Join(r.Dir(), filepath.FromSlash(r.Subdir))
+}
+
+// Has reports whether the registry's clone contains a package.
+func (r Registry) Has(packageName string) bool {
+	info, err := os.Stat(filepath.Join(r.ContentDir(), packageName))
+	return err == nil && info.IsDir()
+}
+
+// gitFiles reads a package of the registry at the given commit.
+func (r Registry) gitFiles(commit, packageName string) gitFiles {
+	return gitFiles{repo: r.Dir(), commit: commit, prefix: path.Join(r.Subdir, packageName)}
+}
+
+// headFiles returns the files of a package at the registry's current
+// commit: its highest version if it is kept in versioned subdirectories.
+// If the registry is not a git checkout (or the package is not
+// committed), the files on disk are used and the commit is empty.
+func (r Registry) headFiles(packageName string) (packageFiles, string) {
+	files, commit := r.currentFiles(packageName)
+	return versionedFiles(files), commit
+}
+
+// currentFiles is headFiles without resolving versioned subdirectories.
+func (r Registry) currentFiles(packageName string) (packageFiles, string) {
+	if out, err := runGit(r.Dir(), "rev-parse", "HEAD"); err == nil {
+		files := r.gitFiles(strings.TrimSpace(string(out)), packageName)
+		if _, err := files.ReadDir("."); err == nil {
+			return files, files.commit
+		}
+	}
+	return dirFiles(filepath.Join(r.ContentDir(), packageName)), ""
+}
+
+// revisions returns the commits that changed a package, newest first,
+// with its files at each of them.
+func (r Registry) revisions(packageName string) ([]gitFiles, error) {
+	out, err := runGit(r.Dir(), "log", "--format=%H", "--", path.Join(r.Subdir, packageName))
+	if err != nil {
+		return nil, err
+	}
+	var revs []gitFiles
+	for _, commit := range strings.Fields(string(out)) {
+		revs = append(revs, r.gitFiles(commit, packageName))
+	}
+	return revs, nil
+}
+
+// Update clones the registry or pulls the latest changes. A clone whose
+// origin no longer matches the configured URL is replaced. Operations
+// timeout after 30 seconds.
+func (r Registry) Update() error {
+	if r.Type == RegistryHTTP {
+		return r.updateHTTP()
+	}
+	registryPath := r.Dir()
 
 	// Create a context with a 30-second timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	if _, err := os.Stat(registryPath); err == nil {
+		if origin, err := runGit(registryPath, "remote", "get-url", "origin"); err == nil && strings.TrimSpace(string(origin)) != r.URL {
+			fmt.Printf("Registry %s moved to %s, re-cloning...\n", r.Name, r.URL)
+			if err := os.RemoveAll(registryPath); err != nil {
+				return err
+			}
+		}
+	}
+
 	if _, err := os.Stat(registryPath); os.IsNotExist(err) {
 		// Clone
-		fmt.Printf("Cloning registry from %s...\n", repoURL)
-		cmd := exec.CommandContext(ctx, "git", "clone", repoURL, registryPath)
+		fmt.Printf("Cloning registry %s from %s...\n", r.Name, r.URL)
+		if err := os.MkdirAll(filepath.Dir(registryPath), 0755); err != nil {
+			return err
+		}
+		cmd := exec.CommandContext(ctx, "git", "clone", r.URL, registryPath)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 
@@ -48,11 +312,11 @@ func UpdateRegistry() error {
 			}
 			return fmt.Errorf("git clone failed: %w", err)
 		}
-		return nil
+		return r.recordFetch()
 	}
 
 	// Pull
-	fmt.Println("Updating registry...")
+	fmt.Printf("Updating registry %s...\n", r.Name)
 	cmd := exec.CommandContext(ctx, "git", "-C", registryPath, "pull")
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -68,53 +332,167 @@ func UpdateRegistry() error {
 		}
 		return nil // Soft fail: proceed with existing data
 	}
+	return r.recordFetch()
+}
+
+// UpdateRegistry ensures every configured registry is cloned and up to
+// date. Registries fetched within the freshness TTL are not pulled again,
+// and in offline mode nothing is fetched. Registries that cannot be cloned
+// are reported together; failing pulls only print a warning.
+func UpdateRegistry() error {
+	return updateRegistries(false)
+}
+
+// RefreshRegistry updates every configured registry regardless of the
+// freshness TTL. It fails in offline mode.
+func RefreshRegistry() error {
+	if Offline() {
+		return fmt.Errorf("offline mode: not updating registries (unset AH_OFFLINE or drop --offline)")
+	}
+	return updateRegistries(true)
+}
+
+func updateRegistries(force bool) error {
+	migrateLegacyRegistry()
+
+	regs, err := LoadRegistries()
+	if err != nil {
+		return err
+	}
+	ttl := RegistryTTL()
+	var failed []string
+	for _, r := range regs {
+		if Offline() {
+			if _, err := os.Stat(r.Dir()); os.IsNotExist(err) {
+				fmt.Printf("Warning: Registry %s was never downloaded (offline mode)\n", r.Name)
+			}
+			continue
+		}
+		if !force && r.fresh(ttl) {
+			continue
+		}
+		if err := r.Update(); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", r.Name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
 	return nil
 }
 
-// GetRegistryContentDir returns the path where the actual packages are located (~/.ah/registry/registry)
-func GetRegistryContentDir() (string, error) {
+// migrateLegacyRegistry moves the clone made by versions that supported a
+// single registry (~/.ah/registry) to the public registry's directory.
+func migrateLegacyRegistry() {
 	root, err := GetRootDir()
 	if err != nil {
-		return "", err
+		return
+	}
+	legacy := filepath.Join(root, legacyRegistryDir)
+	if _, err := os.Stat(filepath.Join(legacy, ".git")); err != nil {
+		return
+	}
+	target := Registry{Name: DefaultRegistry}.Dir()
+	if _, err := os.Stat(target); err == nil {
+		return
 	}
-	return filepath.Join(root, RegistryDir, "registry"), nil
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return
+	}
+	os.Rename(legacy, target)
 }
 
-// GetRegistryPackagePath returns the absolute path to a package in the local registry
-func GetRegistryPackagePath(packageName string) (string, error) {
-	contentDir, err := GetRegistryContentDir()
+// splitPackageName splits a qualified package name ("corp/git-tools")
+// into registry and package name. The registry is empty for bare names.
+func splitPackageName(name string) (string, string) {
+	if reg, pkg, ok := strings.Cut(name, "/"); ok {
+		return reg, pkg
+	}
+	return "", name
+}
+
+// FindPackage resolves a package name, optionally qualified with a
+// registry ("corp/git-tools"), to the registry providing it and the bare
+// package name. Bare names are looked up in the registry the package was
+// installed from, then in the configured registry order.
+func FindPackage(name string) (*Registry, string, error) {
+	lock, err := LoadLockfile()
 	if err != nil {
-		return "", err
+		return nil, "", err
 	}
+	return lock.findPackage(name)
+}
 
-	pkgPath := filepath.Join(contentDir, packageName)
+func (l *Lockfile) findPackage(name string) (*Registry, string, error) {
+	regName, pkg := splitPackageName(name)
+	if !packageNamePattern.MatchString(pkg) {
+		return nil, "", fmt.Errorf("invalid package name %q", name)
+	}
 
-	if _, err := os.Stat(pkgPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("package '%s' not found in registry", packageName)
+	if regName != "" {
+		reg, err := findRegistry(regName)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w (see 'ah registry list')", err)
+		}
+		if !reg.Has(pkg) {
+			return nil, "", fmt.Errorf("package '%s' not found in registry %s", pkg, regName)
+		}
+		return reg, pkg, nil
+	}
+
+	if reg := l.registryOf(pkg); reg != nil && reg.Has(pkg) {
+		return reg, pkg, nil
 	}
-	return pkgPath, nil
+	regs, err := LoadRegistries()
+	if err != nil {
+		return nil, "", err
+	}
+	for i := range regs {
+		if regs[i].Has(pkg) {
+			return &regs[i], pkg, nil
+		}
+	}
+	return nil, "", fmt.Errorf("package '%s' not found in registry", pkg)
 }
 
-// ListRegistryPackages returns a list of all packages available in the local registry
-func ListRegistryPackages() ([]string, error) {
-	contentDir, err := GetRegistryContentDir()
+// findRegistry returns the configured registry with the given name.
+func findRegistry(name string) (*Registry, error) {
+	regs, err := LoadRegistries()
 	if err != nil {
 		return nil, err
 	}
+	for i := range regs {
+		if regs[i].Name == name {
+			return &regs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("registry %s is not configured", name)
+}
 
-	entries, err := os.ReadDir(contentDir)
+// GetRegistryPackagePath returns the absolute path to a package in the
+// local clone of the registry that provides it (its highest version if it
+// is kept in versioned subdirectories). The name may be qualified with a
+// registry ("corp/git-tools").
+func GetRegistryPackagePath(packageName string) (string, error) {
+	reg, pkg, err := FindPackage(packageName)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return []string{}, nil
-		}
-		return nil, err
+		return "", err
 	}
+	return versionedDir(filepath.Join(reg.ContentDir(), pkg)), nil
+}
 
-	var packages []string
-	for _, entry := range entries {
-		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
-			packages = append(packages, entry.Name())
-		}
+// ListRegistryPackages returns all packages available in the local
+// registries, as the name to install them by: bare if the package
+// resolves to this registry, qualified ("corp/git-tools") if a registry
+// earlier in the order shadows it.
+func ListRegistryPackages() ([]string, error) {
+	pkgs, err := AvailablePackages()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(pkgs))
+	for _, p := range pkgs {
+		names = append(names, p.Name)
 	}
-	return packages, nil
+	return names, nil
 }
@@ -0,0 +1,103 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Resolutions are the conflict decisions the user made interactively:
+// for a name several packages define, the package whose definition is
+// used. They are kept in ~/.ah/resolutions.yaml, apart from the
+// overrides, so that 'ah apply' (which replaces the overrides) keeps them.
+// Conflict choices in the overrides take precedence.
+type Resolutions struct {
+	Owners map[string]string `yaml:"owners,omitempty"`
+}
+
+// LoadResolutions reads ~/.ah/resolutions.yaml. A missing file yields no
+// decisions.
+func LoadResolutions() (*Resolutions, error) {
+	root, err := GetRootDir()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Resolutions{Owners: make(map[string]string)}
+	data, err := os.ReadFile(filepath.Join(root, ResolutionsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return r, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ResolutionsFile, err)
+	}
+	if r.Owners == nil {
+		r.Owners = make(map[string]string)
+	}
+	return r, nil
+}
+
+// Save writes the resolutions atomically. Assumes LOCK IS HELD.
+func (r *Resolutions) Save() error {
+	root, err := GetRootDir()
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(r)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(root, ResolutionsFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// forget drops the decisions in favour of a package and reports whether
+// there were any.
+func (r *Resolutions) forget(pkg string) bool {
+	changed := false
+	for name, owner := range r.Owners {
+		if owner == pkg {
+			delete(r.Owners, name)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// ResolveConflict records that the definition of name (an alias, function
+// or executable, or "$NAME" for an env variable) from packageName is used
+// wherever other packages define it too, and recompiles. The decision
+// applies while packageName is enabled; packageName may also be a package
+// about to be installed.
+func ResolveConflict(name, packageName string) error {
+	// The name may be qualified with a registry; active names are not.
+	_, packageName = splitPackageName(packageName)
+	return WithLock(func() error {
+		r, err := LoadResolutions()
+		if err != nil {
+			return err
+		}
+		r.Owners[name] = packageName
+		if err := r.Save(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", ResolutionsFile, err)
+		}
+
+		if err := CompileAliases(); err != nil {
+			fmt.Printf("Warning: Failed to compile aliases: %v\n", err)
+		}
+		if err := syncShims(); err != nil {
+			fmt.Printf("Warning: Failed to link executables: %v\n", err)
+		}
+		return bumpStateGeneration()
+	})
+}
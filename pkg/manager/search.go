@@ -1,13 +1,15 @@
 package manager
 
 import (
-	"os"
-	"path/filepath"
 	"strings"
 )
 
 type ValidPackage struct {
+	// Name is the name to install the package by, qualified with its
+	// registry if an earlier registry has a package of the same name.
 	Name        string
+	Registry    string
+	Version     string
 	Description string
 }
 
@@ -26,44 +28,61 @@ func SearchPackages(query string) ([]ValidPackage, error) {
 			return err
 		}
 
-		// ~/.ah/registry/registry
-		baseDir, err := GetRegistryContentDir()
-		if err != nil {
-			return err
+		queryLower := strings.ToLower(query)
+		matching := func(s string) bool {
+			return strings.Contains(strings.ToLower(s), queryLower)
 		}
 
-		entries, err := os.ReadDir(baseDir)
-		if err != nil {
-			if os.IsNotExist(err) {
-				return nil
+		return eachAvailablePackage(func(p ValidPackage, entry IndexEntry) {
+			match := matching(entry.Name) || matching(entry.Description)
+			for _, s := range entry.Tags {
+				match = match || matching(s)
 			}
-			return err
-		}
-
-		queryLower := strings.ToLower(query)
-
-		for _, e := range entries {
-			if !e.IsDir() {
-				continue
+			for _, s := range entry.Aliases {
+				match = match || matching(s)
 			}
-
-			// Load Metadata
-			pkgPath := filepath.Join(baseDir, e.Name())
-			meta, err := LoadMetadata(pkgPath)
-			if err != nil {
-				// Skip invalid packages (missing ah.yaml or too large)
-				continue
+			if match {
+				matches = append(matches, p)
 			}
+		})
+	})
 
-			nameMatch := strings.Contains(strings.ToLower(e.Name()), queryLower)
-			descMatch := strings.Contains(strings.ToLower(meta.Description), queryLower)
+	return matches, err
+}
 
-			if nameMatch || descMatch {
-				matches = append(matches, ValidPackage{Name: e.Name(), Description: meta.Description})
-			}
-		}
-		return nil
+// AvailablePackages returns the packages of all registries, read from
+// their indexes, in registry order.
+func AvailablePackages() ([]ValidPackage, error) {
+	var pkgs []ValidPackage
+	err := eachAvailablePackage(func(p ValidPackage, _ IndexEntry) {
+		pkgs = append(pkgs, p)
 	})
+	return pkgs, err
+}
 
-	return matches, err
+// eachAvailablePackage calls fn for every package of every registry in
+// resolution order. A package shadowed by an earlier registry is named
+// by its qualified name.
+func eachAvailablePackage(fn func(ValidPackage, IndexEntry)) error {
+	regs, err := LoadRegistries()
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, reg := range regs {
+		index, err := reg.Index()
+		if err != nil {
+			return err
+		}
+		for _, entry := range index.Packages {
+			name := entry.Name
+			if seen[name] {
+				name = reg.Name + "/" + entry.Name
+			}
+			seen[entry.Name] = true
+			fn(ValidPackage{Name: name, Registry: reg.Name, Version: entry.Version, Description: entry.Description}, entry)
+		}
+	}
+	return nil
 }
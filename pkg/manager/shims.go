@@ -0,0 +1,119 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sarkartanmay393/ah/pkg/parser"
+)
+
+// listShims returns the executables a package ships in its bin/ directory.
+// Only regular files with valid command names are accepted; anything else
+// is reported as a diagnostic.
+func listShims(files packageFiles, packageDir string) ([]string, []parser.Diagnostic, error) {
+	binDir := filepath.Join(packageDir, BinDir)
+	entries, err := files.ReadDir(BinDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	var shims []string
+	var diags []parser.Diagnostic
+	warn := func(name string, sev parser.Severity, msg string) {
+		diags = append(diags, parser.Diagnostic{
+			File:     filepath.Join(binDir, name),
+			Severity: sev,
+			Message:  msg,
+		})
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		if !e.Type().IsRegular() {
+			// Symlinks could point outside the package.
+			warn(name, parser.SeverityError, "only regular files are allowed in bin/")
+			continue
+		}
+		if !parser.IsValidName(name) || strings.HasPrefix(name, "-") {
+			warn(name, parser.SeverityError, fmt.Sprintf("invalid executable name %q", name))
+			continue
+		}
+		if info, err := e.Info(); err == nil && info.Mode().Perm()&0111 == 0 {
+			warn(name, parser.SeverityWarning, "file is not executable")
+		}
+		shims = append(shims, name)
+	}
+	return shims, diags, nil
+}
+
+// syncShims rebuilds the links in ~/.ah/bin so that it contains exactly the
+// executables of the active packages. Files in bin/ that ah did not create
+// are left alone. An executable is linked only if its package's definition
+// of the name is compiled (see shadow), so conflict choices, renames and
+// priorities decide between packages shipping or defining the same name.
+// Assumes LOCK IS HELD.
+func syncShims() error {
+	root, err := GetRootDir()
+	if err != nil {
+		return err
+	}
+	binDir := filepath.Join(root, BinDir)
+	activeDir := filepath.Join(root, ActiveDir)
+
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		return err
+	}
+
+	// 1. Remove links we created earlier (they all point into active/)
+	entries, err := os.ReadDir(binDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		linkPath := filepath.Join(binDir, e.Name())
+		target, err := os.Readlink(linkPath)
+		if err != nil {
+			continue // not a symlink
+		}
+		if strings.HasPrefix(target, activeDir+string(filepath.Separator)) {
+			os.Remove(linkPath)
+		}
+	}
+
+	// 2. Link executables of active packages
+	lock, err := LoadLockfile()
+	if err != nil {
+		return err
+	}
+	overrides, err := LoadOverrides()
+	if err != nil {
+		return err
+	}
+	pkgs, _, err := lock.compiledPackages(overrides)
+	if err != nil {
+		return err
+	}
+
+	for _, pkg := range pkgs {
+		for _, name := range pkg.Content.Shims {
+			linkPath := filepath.Join(binDir, name)
+			if _, err := os.Lstat(linkPath); err == nil {
+				fmt.Printf("Warning: %s exists and was not created by ah (skipped)\n", linkPath)
+				continue
+			}
+			target := filepath.Join(activeDir, pkg.Name, BinDir, name)
+			if err := os.Symlink(target, linkPath); err != nil {
+				return fmt.Errorf("failed to link %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
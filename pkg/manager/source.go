@@ -0,0 +1,234 @@
+package manager
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SourceKind is the kind of a Source.
+type SourceKind int
+
+// Kinds of package sources.
+const (
+	SourcePath SourceKind = iota
+	SourceGit
+	SourceTarball
+)
+
+// Source is a package installed from outside the registries: a local
+// directory, a git repository or a .tar.gz archive. Package authors use it
+// to try a package before publishing it.
+type Source struct {
+	Kind SourceKind
+	// Location is the absolute path of the directory or archive, or the
+	// URL of the git repository.
+	Location string
+	// Subdir and Ref select the package directory and the revision of a
+	// git repository. Both are optional.
+	Subdir string
+	Ref    string
+}
+
+// maxTarballSize is the most an archive may extract to.
+const maxTarballSize = 50 * 1024 * 1024
+
+// ParseSource parses an install argument that names a source rather than a
+// registry package:
+//
+//	./my-pkg, /abs/path, ~/pkg          a local directory
+//	git+https://host/repo#subdir@ref     a git repository (#subdir and @ref optional)
+//	pkg.tar.gz, pkg.tgz                  an archive
+//
+// It reports false for registry package names, and for git repositories
+// whose URL or ref starts with "-", which git would take for an option.
+func ParseSource(arg string) (*Source, bool) {
+	if rest, ok := strings.CutPrefix(arg, "git+"); ok {
+		src := &Source{Kind: SourceGit, Location: rest}
+		if url, frag, ok := strings.Cut(rest, "#"); ok {
+			src.Location = url
+			src.Subdir, src.Ref, _ = strings.Cut(frag, "@")
+		}
+		if strings.HasPrefix(src.Location, "-") || strings.HasPrefix(src.Ref, "-") {
+			return nil, false
+		}
+		return src, true
+	}
+
+	isPath := arg == "." || arg == ".." || strings.HasPrefix(arg, "./") || strings.HasPrefix(arg, "../") ||
+		strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, "~/")
+	isTarball := strings.HasSuffix(arg, ".tar.gz") || strings.HasSuffix(arg, ".tgz")
+	if !isPath && !isTarball {
+		return nil, false
+	}
+
+	location := arg
+	if rest, ok := strings.CutPrefix(arg, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			location = filepath.Join(home, rest)
+		}
+	}
+	if abs, err := filepath.Abs(location); err == nil {
+		location = abs
+	}
+	if isTarball {
+		return &Source{Kind: SourceTarball, Location: location}, true
+	}
+	return &Source{Kind: SourcePath, Location: location}, true
+}
+
+// String returns the source in the form ParseSource accepts. It is what
+// ah.lock records as the package's origin.
+func (s *Source) String() string {
+	if s.Kind != SourceGit {
+		return s.Location
+	}
+	spec := "git+" + s.Location
+	if s.Subdir != "" || s.Ref != "" {
+		spec += "#" + s.Subdir
+	}
+	if s.Ref != "" {
+		spec += "@" + s.Ref
+	}
+	return spec
+}
+
+// fetch makes the package available as a directory on disk and returns it
+// with the git commit it came from, if any. cleanup removes anything
+// fetch created and must be called when done.
+func (s *Source) fetch() (dir, commit string, cleanup func(), err error) {
+	cleanup = func() {}
+	if s.Kind == SourcePath {
+		info, err := os.Stat(s.Location)
+		if err != nil {
+			return "", "", cleanup, err
+		}
+		if !info.IsDir() {
+			return "", "", cleanup, fmt.Errorf("%s is not a directory", s.Location)
+		}
+		return s.Location, "", cleanup, nil
+	}
+
+	tmp, err := os.MkdirTemp("", "ah-source-")
+	if err != nil {
+		return "", "", cleanup, err
+	}
+	cleanup = func() { os.RemoveAll(tmp) }
+
+	if s.Kind == SourceTarball {
+		dir, err = extractTarball(s.Location, tmp)
+		if err != nil {
+			return "", "", cleanup, fmt.Errorf("failed to extract %s: %w", filepath.Base(s.Location), err)
+		}
+		return dir, "", cleanup, nil
+	}
+
+	if Offline() {
+		return "", "", cleanup, fmt.Errorf("offline mode: cannot clone %s", s.Location)
+	}
+	fmt.Printf("Cloning %s...\n", s.Location)
+	repo := filepath.Join(tmp, "repo")
+	if _, err := runGit(tmp, "clone", "--quiet", "--", s.Location, repo); err != nil {
+		return "", "", cleanup, err
+	}
+	if s.Ref != "" {
+		if _, err := runGit(repo, "checkout", "--quiet", s.Ref, "--"); err != nil {
+			return "", "", cleanup, fmt.Errorf("ref %s not found: %w", s.Ref, err)
+		}
+	}
+	out, err := runGit(repo, "rev-parse", "HEAD")
+	if err != nil {
+		return "", "", cleanup, err
+	}
+	sub := path.Clean(s.Subdir)
+	if path.IsAbs(sub) || sub == ".." || strings.HasPrefix(sub, "../") {
+		return "", "", cleanup, fmt.Errorf("subdir %q is outside the repository", s.Subdir)
+	}
+	return filepath.Join(repo, filepath.FromSlash(sub)), strings.TrimSpace(string(out)), cleanup, nil
+}
+
+// extractTarball extracts the directories and regular files of a .tar.gz
+// archive into dest, the files walkPackage would visit. If the archive
+// holds a single top-level directory (as archives of a package directory
+// usually do), that directory is returned, otherwise dest.
+func extractTarball(archive, dest string) (string, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return "", err
+	}
+	defer gz.Close()
+
+	var total int64
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return "", fmt.Errorf("archive entry %q is outside the package", hdr.Name)
+		}
+		target := filepath.Join(dest, filepath.FromSlash(name))
+
+		if !isPackageEntry(hdr.FileInfo().Mode()) {
+			// Symlinks and special files are not part of packages.
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return "", err
+			}
+		case tar.TypeReg:
+			total += hdr.Size
+			if total > maxTarballSize {
+				return "", fmt.Errorf("archive is too large (max 50MB)")
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return "", err
+			}
+			mode := os.FileMode(0644)
+			if hdr.FileInfo().Mode().Perm()&0111 != 0 {
+				mode = 0755
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+			if err != nil {
+				return "", err
+			}
+			_, err = io.Copy(out, io.LimitReader(tr, hdr.Size))
+			out.Close()
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	entries, err := os.ReadDir(dest)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		return filepath.Join(dest, entries[0].Name()), nil
+	}
+	return dest, nil
+}
+
+// pinSource records a package installed from a source and copies it into
+// the store.
+func (l *Lockfile) pinSource(src *Source, packageName string, files packageFiles, commit string) error {
+	return l.pinFiles(packageName, files, LockEntry{Commit: commit, Source: src.String()}, true)
+}
@@ -0,0 +1,164 @@
+package manager
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// storeNamePattern restricts the versions used as store directory names.
+var storeNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+
+// storePath returns the absolute path of a store entry ("name/version").
+func storePath(rel string) string {
+	root, _ := GetRootDir()
+	return filepath.Join(root, StoreDir, filepath.FromSlash(rel))
+}
+
+// storePackage copies a package revision into the store as
+// packages/<name>/<version> and returns "name/version". Store entries are
+// immutable: if the version directory already holds different files (the
+// package changed without a version bump), the copy is stored as
+// "<version>+<hash prefix>" instead. The copy is verified against hash.
+// Assumes LOCK IS HELD.
+func storePackage(files packageFiles, packageName, hash string) (string, error) {
+	version := "0.0.0"
+	if meta, err := loadMetadata(files); err == nil {
+		version = meta.Version
+	}
+	if !storeNamePattern.MatchString(version) {
+		return "", fmt.Errorf("invalid version %q for %s", version, packageName)
+	}
+
+	candidates := []string{version, version + "+" + strings.TrimPrefix(hash, "sha256:")[:12]}
+	for _, v := range candidates {
+		rel := path.Join(packageName, v)
+		dest := storePath(rel)
+		if _, err := os.Stat(dest); err == nil {
+			if existing, err := hashPackage(dirFiles(dest)); err == nil && existing == hash {
+				return rel, nil
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return "", err
+		}
+		tmp, err := os.MkdirTemp(filepath.Dir(dest), ".tmp-")
+		if err != nil {
+			return "", err
+		}
+		if err := os.Chmod(tmp, 0755); err != nil {
+			os.RemoveAll(tmp)
+			return "", err
+		}
+		if err := copyPackage(files, ".", tmp); err != nil {
+			os.RemoveAll(tmp)
+			return "", fmt.Errorf("failed to copy %s: %w", packageName, err)
+		}
+		if copied, err := hashPackage(dirFiles(tmp)); err != nil || copied != hash {
+			os.RemoveAll(tmp)
+			return "", fmt.Errorf("%s changed since it was pinned; run 'ah upgrade %s'", packageName, packageName)
+		}
+		if err := os.Rename(tmp, dest); err != nil {
+			os.RemoveAll(tmp)
+			return "", err
+		}
+		return rel, nil
+	}
+	return "", fmt.Errorf("store for %s %s is corrupted; run 'ah gc'", packageName, version)
+}
+
+// copyPackage copies the files of a package below dir (as walkPackage
+// defines them) into dest. Files are made read-only.
+func copyPackage(files packageFiles, dir, dest string) error {
+	return walkPackage(files, dir, func(name string, e fs.DirEntry) error {
+		target := filepath.Join(dest, filepath.FromSlash(name))
+		if e.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		data, err := files.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		mode := os.FileMode(0444)
+		if isExecutable(e) {
+			mode = 0555
+		}
+		return os.WriteFile(target, data, mode)
+	})
+}
+
+// GarbageCollect removes the store entries no longer referenced by
+// ah.lock and returns them ("name/version").
+func GarbageCollect() ([]string, error) {
+	var removed []string
+	err := WithLock(func() error {
+		var err error
+		removed, err = collectGarbage()
+		return err
+	})
+	return removed, err
+}
+
+// collectGarbage implements GarbageCollect. Assumes LOCK IS HELD.
+func collectGarbage() ([]string, error) {
+	lock, err := LoadLockfile()
+	if err != nil {
+		return nil, err
+	}
+	referenced := make(map[string]bool)
+	for _, entry := range lock.Packages {
+		if entry.Store != "" {
+			referenced[entry.Store] = true
+		}
+	}
+
+	root, err := GetRootDir()
+	if err != nil {
+		return nil, err
+	}
+	storeDir := filepath.Join(root, StoreDir)
+	pkgs, err := os.ReadDir(storeDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var removed []string
+	for _, pkg := range pkgs {
+		if !pkg.IsDir() {
+			continue
+		}
+		versions, err := os.ReadDir(filepath.Join(storeDir, pkg.Name()))
+		if err != nil {
+			return removed, err
+		}
+		left := len(versions)
+		for _, v := range versions {
+			rel := path.Join(pkg.Name(), v.Name())
+			if referenced[rel] {
+				continue
+			}
+			if err := os.RemoveAll(storePath(rel)); err != nil {
+				return removed, err
+			}
+			left--
+			if !strings.HasPrefix(v.Name(), ".tmp-") {
+				removed = append(removed, rel)
+			}
+		}
+		if left == 0 {
+			os.Remove(filepath.Join(storeDir, pkg.Name()))
+		}
+	}
+	sort.Strings(removed)
+	return removed, nil
+}
@@ -21,6 +21,14 @@ func DisablePackage(packageName string) error {
 			return fmt.Errorf("package %s is not enabled", packageName)
 		}
 
+		lock, err := LoadLockfile()
+		if err != nil {
+			return err
+		}
+		if err := checkNoDependents(lock, packageName, "disable"); err != nil {
+			return err
+		}
+
 		if err := os.Remove(symlinkPath); err != nil {
 			return fmt.Errorf("failed to disable package: %w", err)
 		}
@@ -30,7 +38,10 @@ func DisablePackage(packageName string) error {
 		if err := CompileAliases(); err != nil {
 			fmt.Printf("Warning: Failed to compile aliases: %v\n", err)
 		}
-		return updateStateTimestamp()
+		if err := syncShims(); err != nil {
+			fmt.Printf("Warning: Failed to link executables: %v\n", err)
+		}
+		return bumpStateGeneration()
 	})
 }
 
@@ -43,21 +54,26 @@ func EnablePackageFromRepo(packageName string) error {
 	}
 
 	// Check if already enabled
+	qualified := packageName
+	_, packageName = splitPackageName(qualified)
 	symlinkPath := filepath.Join(root, ActiveDir, packageName)
 	if _, err := os.Lstat(symlinkPath); err == nil {
 		return fmt.Errorf("package '%s' is already enabled", packageName)
 	}
 
-	// Verify package exists in registry
-	contentDir, err := GetRegistryContentDir()
+	// Verify package is installed (pinned) or at least in the registry
+	lock, err := LoadLockfile()
 	if err != nil {
 		return err
 	}
-	repoPath := filepath.Join(contentDir, packageName)
-	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
-		return fmt.Errorf("package %s is not installed (use 'ah install')", packageName)
+	if _, pinned := lock.Packages[packageName]; !pinned {
+		if _, _, err := lock.findPackage(qualified); err != nil {
+			return fmt.Errorf("package %s is not installed (use 'ah install')", packageName)
+		}
 	}
 
-	// Use the existing EnablePackage function from install.go
-	return EnablePackage(packageName)
+	// Re-enable at the revision pinned when it was installed
+	return WithLock(func() error {
+		return enablePackageInternal(qualified, false)
+	})
 }
@@ -0,0 +1,287 @@
+package manager
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// httpStateFile records the URL and index ETag of an HTTP registry in its
+// directory.
+const httpStateFile = ".ah-http.json"
+
+// maxIndexSize is the largest index.json downloaded.
+const maxIndexSize = 10 * 1024 * 1024
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+type httpState struct {
+	URL  string `json:"url"`
+	ETag string `json:"etag,omitempty"`
+}
+
+// updateHTTP syncs an HTTP registry: it downloads index.json (skipped via
+// ETag if unchanged) and the tarball of every package whose local copy
+// does not match the index. Tarballs are verified against their sha256
+// and the package content against its hash before they replace the local
+// copy. Without a local copy failures are errors; otherwise they are
+// reported and the cached data is used. A package that fails to download
+// is left out of the local index.json unless an older copy is kept.
+func (r Registry) updateHTTP() error {
+	dir := r.Dir()
+	var state httpState
+	if data, err := os.ReadFile(filepath.Join(dir, httpStateFile)); err == nil {
+		json.Unmarshal(data, &state)
+	}
+	if _, err := os.Stat(dir); err == nil && state.URL != r.URL {
+		fmt.Printf("Registry %s moved to %s, downloading again...\n", r.Name, r.URL)
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		state = httpState{}
+	}
+	if err := os.MkdirAll(r.ContentDir(), 0755); err != nil {
+		return err
+	}
+
+	indexPath := filepath.Join(r.ContentDir(), IndexFile)
+	_, err := os.Stat(indexPath)
+	cached := err == nil
+	soft := func(err error) error {
+		if !cached {
+			return err
+		}
+		fmt.Printf("Warning: Failed to update registry %s (using cached data): %v\n", r.Name, err)
+		return nil
+	}
+
+	fmt.Printf("Updating registry %s...\n", r.Name)
+	indexURL, err := r.resolveURL(IndexFile)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodGet, indexURL, nil)
+	if err != nil {
+		return err
+	}
+	if cached && state.ETag != "" {
+		req.Header.Set("If-None-Match", state.ETag)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return soft(err)
+	}
+	defer resp.Body.Close()
+
+	var data []byte
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if data, err = os.ReadFile(indexPath); err != nil {
+			return err
+		}
+	case http.StatusOK:
+		if data, err = io.ReadAll(io.LimitReader(resp.Body, maxIndexSize)); err != nil {
+			return soft(err)
+		}
+		state.ETag = resp.Header.Get("ETag")
+	default:
+		return soft(fmt.Errorf("GET %s: %s", indexURL, resp.Status))
+	}
+	index, err := parseIndex(data)
+	if err != nil {
+		return soft(err)
+	}
+
+	// Packages first, so the index never lists a package we do not have:
+	// one that fails to download keeps its previous entry, if it had one.
+	previous := make(map[string]IndexEntry)
+	if old, err := loadIndex(indexPath); err == nil {
+		for _, entry := range old.Packages {
+			previous[entry.Name] = entry
+		}
+	}
+	failed := false
+	listed := make(map[string]bool)
+	var have []IndexEntry
+	for _, entry := range index.Packages {
+		if err := r.syncPackage(entry); err != nil {
+			fmt.Printf("Warning: Failed to download %s from registry %s: %v\n", entry.Name, r.Name, err)
+			failed = true
+			var ok bool
+			if entry, ok = previous[entry.Name]; !ok {
+				continue
+			}
+		}
+		listed[entry.Name] = true
+		have = append(have, entry)
+	}
+	if failed {
+		// Write what we have, and fetch the index again next time.
+		index.Packages = have
+		if data, err = json.MarshalIndent(index, "", "  "); err != nil {
+			return err
+		}
+		data = append(data, '\n')
+		state.ETag = ""
+	}
+	entries, err := os.ReadDir(r.ContentDir())
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") && !listed[e.Name()] {
+			os.RemoveAll(filepath.Join(r.ContentDir(), e.Name()))
+		}
+	}
+
+	if err := os.WriteFile(indexPath, data, 0644); err != nil {
+		return err
+	}
+	state.URL = r.URL
+	stateData, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, httpStateFile), stateData, 0644); err != nil {
+		return err
+	}
+	if failed {
+		// Not recorded as fresh, so the next update retries.
+		return nil
+	}
+	return r.recordFetch()
+}
+
+// syncPackage downloads a package of an HTTP registry unless the local
+// copy already matches its index entry.
+func (r Registry) syncPackage(entry IndexEntry) error {
+	target := filepath.Join(r.ContentDir(), entry.Name)
+	if hash, err := hashPackage(dirFiles(target)); err == nil && hash == entry.Hash {
+		return nil
+	}
+	if entry.Tarball == "" || entry.SHA256 == "" {
+		return fmt.Errorf("index lists no verifiable tarball")
+	}
+	tarballURL, err := r.resolveURL(entry.Tarball)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp(r.Dir(), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	archive := filepath.Join(tmp, "package.tar.gz")
+	if err := download(tarballURL, archive, entry.SHA256); err != nil {
+		return err
+	}
+	dir, err := extractTarball(archive, filepath.Join(tmp, "x"))
+	if err != nil {
+		return err
+	}
+	if hash, err := hashPackage(dirFiles(dir)); err != nil || hash != entry.Hash {
+		return fmt.Errorf("content does not match the index hash")
+	}
+
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	return os.Rename(dir, target)
+}
+
+// download fetches a URL into a file and checks its sha256.
+func download(rawURL, dest, wantSHA256 string) error {
+	resp, err := httpClient.Get(rawURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", rawURL, resp.Status)
+	}
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(resp.Body, maxTarballSize)); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != strings.TrimPrefix(wantSHA256, "sha256:") {
+		return fmt.Errorf("sha256 mismatch for %s (got %s)", rawURL, got)
+	}
+	return nil
+}
+
+// resolveURL resolves a reference relative to the registry URL.
+func (r Registry) resolveURL(ref string) (string, error) {
+	base, err := url.Parse(strings.TrimSuffix(r.URL, "/") + "/")
+	if err != nil {
+		return "", fmt.Errorf("invalid registry URL %q: %w", r.URL, err)
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// writeTarball archives a package directory as <name>/... into dest and
+// returns the archive's sha256.
+func writeTarball(dir, dest string) (string, error) {
+	f, err := os.Create(dest)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(f, h))
+	tw := tar.NewWriter(gz)
+
+	files := dirFiles(dir)
+	err = walkPackage(files, ".", func(name string, e fs.DirEntry) error {
+		archived := path.Join(filepath.Base(dir), name)
+		if e.IsDir() {
+			return tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: archived + "/", Mode: 0755})
+		}
+		data, err := files.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		mode := int64(0644)
+		if isExecutable(e) {
+			mode = 0755
+		}
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: archived, Mode: mode, Size: int64(len(data))}); err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,381 @@
+package manager
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sarkartanmay393/ah/pkg/semver"
+)
+
+// ChangeKind says how a definition differs between two package revisions.
+type ChangeKind int
+
+// Kinds of definition changes.
+const (
+	Added ChangeKind = iota
+	Removed
+	Changed
+)
+
+// DefinitionChange is one alias, function, executable or env variable
+// ("$NAME") that differs between the installed and the registry revision.
+type DefinitionChange struct {
+	Name string
+	Kind ChangeKind
+	Old  string
+	New  string
+}
+
+func (c DefinitionChange) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("+ %s = %s", c.Name, oneLine(c.New))
+	case Removed:
+		return fmt.Sprintf("- %s = %s", c.Name, oneLine(c.Old))
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", c.Name, oneLine(c.Old), oneLine(c.New))
+	}
+}
+
+// PackageUpdate describes an enabled package whose registry copy differs
+// from the revision pinned in ah.lock.
+type PackageUpdate struct {
+	Name             string
+	InstalledVersion string
+	AvailableVersion string
+	Changes          []DefinitionChange
+
+	// hash of the registry copy, to detect registry changes between the
+	// preview and the upgrade.
+	hash string
+	// meta and content are the new revision's, for the dependency and
+	// conflict checks.
+	meta    *PackageMetadata
+	content *PackageContent
+}
+
+// Outdated returns the enabled packages whose registry copy differs from
+// the installed revision. It does not update the registry; run
+// UpdateRegistry first to see the latest changes.
+func Outdated() ([]PackageUpdate, error) {
+	pkgs, err := ListPackages()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(pkgs)
+
+	// Fetch packages installed from a source (NO LOCK - may be slow)
+	sources, cleanup, err := fetchSources(pkgs)
+	defer cleanup()
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []PackageUpdate
+	err = WithLock(func() error {
+		lock, err := LoadLockfile()
+		if err != nil {
+			return err
+		}
+		for _, pkg := range pkgs {
+			u, err := lock.checkUpdate(pkg, sources)
+			if err != nil {
+				fmt.Printf("Warning: Failed to check %s: %v\n", pkg, err)
+				continue
+			}
+			if u != nil {
+				updates = append(updates, *u)
+			}
+		}
+		return nil
+	})
+	return updates, err
+}
+
+// checkUpdate compares a package's pinned revision with the registry
+// head, or the fetched copy of its source. It returns nil if they are
+// identical. Assumes LOCK IS HELD.
+func (l *Lockfile) checkUpdate(packageName string, sources map[string]fetchedSource) (*PackageUpdate, error) {
+	entry, ok := l.Packages[packageName]
+	if !ok {
+		return nil, fmt.Errorf("%s is not pinned in %s", packageName, LockFile)
+	}
+	headFiles, _, err := l.upstream(packageName, sources)
+	if err != nil || headFiles == nil {
+		return nil, err
+	}
+	hash, err := hashPackage(headFiles)
+	if err != nil {
+		return nil, err
+	}
+	if hash == entry.Hash {
+		return nil, nil
+	}
+
+	root, err := GetRootDir()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(root, ActiveDir, packageName)
+	u := &PackageUpdate{Name: packageName, hash: hash}
+
+	if meta, err := loadMetadata(l.pinnedFiles(packageName)); err == nil {
+		u.InstalledVersion = meta.Version
+	}
+	if meta, err := loadMetadata(headFiles); err == nil {
+		u.AvailableVersion = meta.Version
+		u.meta = meta
+	}
+
+	oldContent, err := loadContent(l.pinnedFiles(packageName), dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	newContent, err := loadContent(headFiles, dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	u.Changes = diffDefinitions(oldContent, newContent)
+	u.content = newContent
+	return u, nil
+}
+
+// fetchedSource is a copy of the source a package was installed from,
+// fetched before taking the lock.
+type fetchedSource struct {
+	// source is the ah.lock source it was fetched from.
+	source string
+	dir    string
+	commit string
+	err    error
+}
+
+// fetchSources fetches the sources of the packages that were installed
+// from one, so that slow or unreachable remotes do not hold the lock. It
+// reads ah.lock without the lock; upstream checks the copies against the
+// entries it sees under the lock. Fetch errors are kept per package.
+// cleanup removes the copies and must be called when done.
+func fetchSources(pkgs []string) (map[string]fetchedSource, func(), error) {
+	var cleanups []func()
+	cleanup := func() {
+		for _, c := range cleanups {
+			c()
+		}
+	}
+	lock, err := LoadLockfile()
+	if err != nil {
+		return nil, cleanup, err
+	}
+
+	sources := make(map[string]fetchedSource)
+	for _, pkg := range pkgs {
+		entry, ok := lock.Packages[pkg]
+		if !ok || entry.Source == "" {
+			continue
+		}
+		f := fetchedSource{source: entry.Source}
+		if src, ok := ParseSource(entry.Source); !ok {
+			f.err = fmt.Errorf("invalid source %q in %s", entry.Source, LockFile)
+		} else {
+			var c func()
+			f.dir, f.commit, c, f.err = src.fetch()
+			cleanups = append(cleanups, c)
+			if f.err != nil {
+				f.err = fmt.Errorf("failed to fetch %s: %w", src, f.err)
+			}
+		}
+		sources[pkg] = f
+	}
+	return sources, cleanup, nil
+}
+
+// upstream returns the current files of the registry or source a pinned
+// package was installed from (the highest version within the constraint it
+// was installed with), and their commit. Sources are not fetched here but
+// taken from sources (see fetchSources). files is nil if there is none
+// (the package did not come from a registry, or its registry was
+// removed). Assumes LOCK IS HELD.
+func (l *Lockfile) upstream(packageName string, sources map[string]fetchedSource) (files packageFiles, commit string, err error) {
+	entry := l.Packages[packageName]
+	if entry.Source != "" {
+		f, ok := sources[packageName]
+		if !ok || f.source != entry.Source {
+			return nil, "", fmt.Errorf("%s changed while fetching its source; try again", packageName)
+		}
+		if f.err != nil {
+			return nil, "", f.err
+		}
+		return dirFiles(f.dir), f.commit, nil
+	}
+
+	reg := l.registryOf(packageName)
+	if reg == nil || !reg.Has(packageName) {
+		return nil, "", nil
+	}
+	if entry.Constraint == "" {
+		files, commit = reg.headFiles(packageName)
+		return files, commit, nil
+	}
+	c, err := semver.ParseConstraint(entry.Constraint)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid constraint for %s in %s: %w", packageName, LockFile, err)
+	}
+	files, commit, err = reg.selectVersion(packageName, c)
+	return files, commit, err
+}
+
+// UpgradePackage switches an enabled package to its registry copy. Like
+// InstallPackage it checks for conflicts, including those of dependencies
+// the new version adds, and asks the user to confirm after showing what
+// changes.
+func UpgradePackage(packageName string) error {
+	// Phase 0: Fetch a package installed from a source (NO LOCK - may be slow)
+	sources, cleanup, err := fetchSources([]string{packageName})
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	// Phase 1: Diff and conflict check (with lock)
+	var update *PackageUpdate
+	var deps []DependencyStep
+	err = WithLock(func() error {
+		root, err := GetRootDir()
+		if err != nil {
+			return err
+		}
+		if _, err := os.Lstat(filepath.Join(root, ActiveDir, packageName)); os.IsNotExist(err) {
+			return fmt.Errorf("package %s is not enabled", packageName)
+		}
+
+		lock, err := LoadLockfile()
+		if err != nil {
+			return err
+		}
+		update, err = lock.checkUpdate(packageName, sources)
+		if err != nil || update == nil {
+			return err
+		}
+
+		if update.meta == nil {
+			return fmt.Errorf("invalid package metadata in the new version of %s", packageName)
+		}
+		// The package itself is being replaced, so it is not checked
+		// against its installed version.
+		named := *update.meta
+		named.Name = packageName
+		overrides, err := LoadOverrides()
+		if err != nil {
+			return err
+		}
+		deps, err = lock.planDependencies(overrides, &named, update.content)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if update == nil {
+		fmt.Printf("%s is up to date.\n", packageName)
+		return nil
+	}
+
+	// Phase 2: Show diff and prompt user (NO LOCK)
+	fmt.Printf("\n📦 Package: %s (%s -> %s)\n", packageName, update.InstalledVersion, update.AvailableVersion)
+	if len(update.Changes) == 0 {
+		fmt.Println("No definitions change (only other files differ).")
+	}
+	for _, c := range update.Changes {
+		fmt.Printf("  %s\n", c)
+	}
+	if len(deps) > 0 {
+		fmt.Printf("\nNeeds %d packages:\n", len(deps))
+		for _, d := range deps {
+			fmt.Printf("  %s\n", d)
+		}
+	}
+	fmt.Print("\nProceed to upgrade? [Y/n]: ")
+
+	reader := bufio.NewReader(os.Stdin)
+	response, _ := reader.ReadString('\n')
+	response = strings.TrimSpace(strings.ToLower(response))
+
+	if response != "" && response != "y" && response != "yes" {
+		fmt.Println("Upgrade cancelled.")
+		return nil
+	}
+
+	// Phase 3: Re-pin (with lock again), unless the registry moved on
+	return WithLock(func() error {
+		lock, err := LoadLockfile()
+		if err != nil {
+			return err
+		}
+		files, commit, err := lock.upstream(packageName, sources)
+		if err != nil {
+			return err
+		}
+		if hash, err := hashPackage(files); err != nil || hash != update.hash {
+			return fmt.Errorf("%s changed while confirming; run 'ah upgrade %s' again", packageName, packageName)
+		}
+		entry := lock.Packages[packageName]
+		pinned := LockEntry{Commit: commit, Registry: entry.Registry, Source: entry.Source, Constraint: entry.Constraint}
+		if reg := lock.registryOf(packageName); reg != nil {
+			pinned.Path = reg.versionPath(packageName, files)
+		}
+		if err := lock.pinFiles(packageName, files, pinned, true); err != nil {
+			return fmt.Errorf("failed to pin %s: %w", packageName, err)
+		}
+		if err := lock.enableDependencies(packageName); err != nil {
+			return err
+		}
+		return finishEnable(lock, packageName)
+	})
+}
+
+// diffDefinitions compares the definitions of two revisions of a package.
+// Either may be nil.
+func diffDefinitions(oldContent, newContent *PackageContent) []DefinitionChange {
+	oldDefs := oldContent.definitions()
+	newDefs := newContent.definitions()
+
+	var changes []DefinitionChange
+	for name, o := range oldDefs {
+		n, ok := newDefs[name]
+		switch {
+		case !ok:
+			changes = append(changes, DefinitionChange{Name: name, Kind: Removed, Old: o})
+		case n != o:
+			changes = append(changes, DefinitionChange{Name: name, Kind: Changed, Old: o, New: n})
+		}
+	}
+	for name, n := range newDefs {
+		if _, ok := oldDefs[name]; !ok {
+			changes = append(changes, DefinitionChange{Name: name, Kind: Added, New: n})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+// definitions maps every name the package defines, including env
+// variables as "$NAME", to its one-line description.
+func (c *PackageContent) definitions() map[string]string {
+	defs := make(map[string]string)
+	if c == nil {
+		return defs
+	}
+	names := c.Names()
+	for _, v := range c.Env {
+		names = append(names, "$"+v.Name)
+	}
+	for _, name := range names {
+		if desc, ok := c.Describe(name); ok {
+			defs[name] = desc
+		}
+	}
+	return defs
+}
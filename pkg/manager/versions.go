@@ -0,0 +1,153 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sarkartanmay393/ah/pkg/semver"
+)
+
+// A registry can keep several versions of a package at once, besides the
+// ones in its history: as versioned subdirectories (registry/git-kit/2.1.0)
+// and as git tags named "<package>/v<version>".
+
+// subFiles returns the files of a subdirectory of a package.
+func subFiles(files packageFiles, dir string) packageFiles {
+	switch f := files.(type) {
+	case dirFiles:
+		return dirFiles(filepath.Join(string(f), filepath.FromSlash(dir)))
+	case gitFiles:
+		f.prefix = path.Join(f.prefix, dir)
+		return f
+	}
+	return files
+}
+
+// versionDirs returns the subdirectories of a package directory that hold
+// a version of it, highest version first. A directory with its own ah.yaml
+// is a plain package and has none.
+func versionDirs(files packageFiles) []string {
+	if _, err := files.ReadFile("ah.yaml"); !os.IsNotExist(err) {
+		return nil
+	}
+	entries, err := files.ReadDir(".")
+	if err != nil {
+		return nil
+	}
+	versions := make(map[string]semver.Version)
+	var dirs []string
+	for _, e := range entries {
+		v, err := semver.Parse(e.Name())
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		if _, err := files.ReadFile(e.Name() + "/ah.yaml"); err != nil {
+			continue
+		}
+		versions[e.Name()] = v
+		dirs = append(dirs, e.Name())
+	}
+	sort.Slice(dirs, func(i, j int) bool { return versions[dirs[j]].Less(versions[dirs[i]]) })
+	return dirs
+}
+
+// versionedFiles returns the highest release of a package kept in
+// versioned subdirectories (the highest pre-release if there is no
+// release), or files itself for a plain package.
+func versionedFiles(files packageFiles) packageFiles {
+	dirs := versionDirs(files)
+	for _, dir := range dirs {
+		if v, _ := semver.Parse(dir); v.Pre == "" {
+			return subFiles(files, dir)
+		}
+	}
+	if len(dirs) > 0 {
+		return subFiles(files, dirs[0])
+	}
+	return files
+}
+
+// versionedDir is versionedFiles for a package directory on disk.
+func versionedDir(dir string) string {
+	return string(versionedFiles(dirFiles(dir)).(dirFiles))
+}
+
+// versionPath returns the versioned subdirectory of a package that files
+// read from the registry's git history are in, or "" for the package
+// directory itself.
+func (r Registry) versionPath(packageName string, files packageFiles) string {
+	g, ok := files.(gitFiles)
+	if !ok {
+		return ""
+	}
+	if dir, ok := strings.CutPrefix(g.prefix, path.Join(r.Subdir, packageName)+"/"); ok {
+		return dir
+	}
+	return ""
+}
+
+// selectVersion returns the highest version of a package that satisfies a
+// constraint, from the registry's current files (including versioned
+// subdirectories) and its version tags. The registry history is only
+// searched if none of those match. On a tie the current files win.
+func (r Registry) selectVersion(packageName string, c *semver.Constraint) (packageFiles, string, error) {
+	var best packageFiles
+	var bestCommit string
+	var bestVersion semver.Version
+	consider := func(files packageFiles, commit string) {
+		meta, err := loadMetadata(files)
+		if err != nil {
+			return
+		}
+		v, err := semver.Parse(meta.Version)
+		if err != nil || !c.Check(v) || (best != nil && !bestVersion.Less(v)) {
+			return
+		}
+		best, bestCommit, bestVersion = files, commit, v
+	}
+
+	files, commit := r.currentFiles(packageName)
+	consider(files, commit)
+	for _, dir := range versionDirs(files) {
+		consider(subFiles(files, dir), commit)
+	}
+	for _, tag := range r.versionTags(packageName) {
+		consider(versionedFiles(r.gitFiles(tag, packageName)), tag)
+	}
+	if best == nil {
+		revs, _ := r.revisions(packageName)
+		for _, rev := range revs {
+			consider(rev, rev.commit)
+		}
+	}
+	if best == nil {
+		return nil, "", fmt.Errorf("no version of %s in registry %s satisfies %s", packageName, r.Name, c)
+	}
+	return best, bestCommit, nil
+}
+
+// versionTags returns the commits of the registry's "<package>/v<version>"
+// tags.
+func (r Registry) versionTags(packageName string) []string {
+	if r.Type == RegistryHTTP {
+		return nil
+	}
+	out, err := runGit(r.Dir(), "for-each-ref", "--format=%(objectname) %(*objectname)", "refs/tags/"+packageName+"/")
+	if err != nil {
+		return nil
+	}
+	var commits []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		// Annotated tags name the tag object first, then the commit.
+		commits = append(commits, fields[len(fields)-1])
+	}
+	return commits
+}
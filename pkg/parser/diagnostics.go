@@ -0,0 +1,97 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Severity classifies a Diagnostic.
+type Severity int
+
+const (
+	// SeverityInfo marks code that is valid shell but ignored by ah.
+	SeverityInfo Severity = iota
+	// SeverityWarning marks definitions that were skipped or are suspicious.
+	SeverityWarning
+	// SeverityError marks input that could not be parsed.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+// Diagnostic describes a problem found while parsing an alias file.
+type Diagnostic struct {
+	// File is the source the diagnostic refers to.
+	File string
+	// Line and Column give the 1-based position of the problem, or 0 if
+	// it concerns the whole file.
+	Line     int
+	Column   int
+	Severity Severity
+	Message  string
+}
+
+// String formats the diagnostic as "file:line:col: severity: message".
+// Diagnostics about a whole file (Line 0) omit the position.
+func (d Diagnostic) String() string {
+	if d.Line == 0 {
+		return fmt.Sprintf("%s: %s: %s", d.File, d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s: %s", d.File, d.Line, d.Column, d.Severity, d.Message)
+}
+
+// ParseResult holds the definitions extracted from a file together with
+// the diagnostics produced while parsing it.
+type ParseResult struct {
+	Aliases     []AliasDef
+	Functions   []FunctionDef
+	Diagnostics []Diagnostic
+
+	// syntaxErr is the tokenizer error, if any, kept for ParseAliases.
+	syntaxErr error
+}
+
+// HasErrors reports whether any diagnostic has SeverityError.
+func (r *ParseResult) HasErrors() bool {
+	return len(r.Filter(SeverityError)) > 0
+}
+
+// Filter returns the diagnostics at or above the given severity.
+func (r *ParseResult) Filter(min Severity) []Diagnostic {
+	var out []Diagnostic
+	for _, d := range r.Diagnostics {
+		if d.Severity >= min {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+func (r *ParseResult) report(file string, line, col int, sev Severity, format string, args ...any) {
+	r.Diagnostics = append(r.Diagnostics, Diagnostic{
+		File:     file,
+		Line:     line,
+		Column:   col,
+		Severity: sev,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// sortDiagnostics orders diagnostics by position in the file.
+func sortDiagnostics(diags []Diagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		if diags[i].Line != diags[j].Line {
+			return diags[i].Line < diags[j].Line
+		}
+		return diags[i].Column < diags[j].Column
+	})
+}
@@ -0,0 +1,145 @@
+package parser
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// FunctionDef represents a shell function defined in a package's
+// functions.sh.
+type FunctionDef struct {
+	// Name is the function name (e.g., "mkcd").
+	Name string
+	// Body is the source between the function's braces, verbatim.
+	Body string
+	// Source is the file path where this function was defined.
+	Source string
+	// Line is the 1-based line of the definition in Source.
+	Line int
+}
+
+// ParseFunctionsFile parses a functions.sh file. See ParseFunctions.
+func ParseFunctionsFile(filePath string) (*ParseResult, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseFunctions(file, filePath)
+}
+
+// ParseFunctions reads a functions.sh script from r. The file uses a
+// restricted grammar: its top level may only contain function definitions
+// of the form "name() { ... }" or "function name { ... }". Anything else
+// would run when the compiled file is sourced, so it is reported as an
+// error and dropped. Function bodies are kept verbatim.
+//
+// The returned error is only set if reading from r fails.
+func ParseFunctions(r io.Reader, source string) (*ParseResult, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseFunctionSource(string(data), source), nil
+}
+
+func parseFunctionSource(src, source string) *ParseResult {
+	res := &ParseResult{}
+
+	cmds, tokErr := Tokenize(src)
+	if synErr, ok := tokErr.(*SyntaxError); ok {
+		res.syntaxErr = synErr
+		res.report(source, synErr.Line, synErr.Column, SeverityError, "%s", synErr.Message)
+	}
+
+	defined := make(map[string]int)
+	for i := 0; i < len(cmds); i++ {
+		cmd := cmds[i]
+		if cmd.Depth > 0 {
+			// Only reachable inside a top-level compound command, which
+			// has already been reported.
+			continue
+		}
+
+		first := cmd.Words[0]
+		var nameWord Word
+		switch {
+		case first.Value == "function" && len(cmd.Words) == 2:
+			nameWord = cmd.Words[1]
+		case len(cmd.Words) == 1 && !isReservedWord(first.Value):
+			nameWord = first
+		default:
+			res.report(source, first.Line, first.Column, SeverityError,
+				"only function definitions are allowed in functions.sh")
+			continue
+		}
+
+		if i+1 >= len(cmds) || cmds[i+1].Words[0].Value != "{" || cmds[i+1].Depth != 0 {
+			res.report(source, nameWord.Line, nameWord.Column, SeverityError,
+				"function %q must have a { ... } body", nameWord.Value)
+			continue
+		}
+		open := cmds[i+1].Words[0]
+
+		// Between the name and "{" only "()" (optional with "function")
+		// may appear.
+		between := strings.Join(strings.Fields(src[nameWord.Offset+len(nameWord.Raw):open.Offset]), "")
+		if between != "()" && !(between == "" && first.Value == "function") {
+			res.report(source, nameWord.Line, nameWord.Column, SeverityError,
+				"malformed definition of function %q", nameWord.Value)
+			continue
+		}
+
+		j := i + 2
+		for j < len(cmds) && cmds[j].Depth > 0 {
+			j++
+		}
+		if j >= len(cmds) || cmds[j].Words[0].Value != "}" {
+			if res.syntaxErr == nil {
+				res.report(source, open.Line, open.Column, SeverityError,
+					"function %q is missing its closing }", nameWord.Value)
+			}
+			i = j - 1
+			continue
+		}
+		closing := cmds[j].Words[0]
+		i = j
+		if len(cmds[j].Words) > 1 {
+			extra := cmds[j].Words[1]
+			res.report(source, extra.Line, extra.Column, SeverityError,
+				"unexpected %q after function %q", extra.Value, nameWord.Value)
+			continue
+		}
+
+		name := nameWord.Value
+		body := strings.TrimSpace(src[open.Offset+1 : closing.Offset])
+		switch {
+		case !IsValidName(name) || strings.HasPrefix(name, "-"):
+			res.report(source, nameWord.Line, nameWord.Column, SeverityError,
+				"invalid function name %q", name)
+			continue
+		case body == "":
+			res.report(source, open.Line, open.Column, SeverityWarning,
+				"function %q has an empty body and is skipped", name)
+			continue
+		}
+
+		if prev, dup := defined[name]; dup {
+			res.report(source, nameWord.Line, nameWord.Column, SeverityWarning,
+				"function %q redefined (previous definition on line %d)", name, prev)
+		}
+		defined[name] = nameWord.Line
+
+		res.Functions = append(res.Functions, FunctionDef{
+			Name:   name,
+			Body:   body,
+			Source: source,
+			Line:   nameWord.Line,
+		})
+	}
+
+	sortDiagnostics(res.Diagnostics)
+	return res
+}
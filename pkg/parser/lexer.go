@@ -0,0 +1,504 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Word is a single shell word after quote removal.
+type Word struct {
+	// Value is the word with quotes removed and escapes resolved.
+	Value string
+	// Raw is the word exactly as it appears in the source.
+	Raw string
+	// Line and Column give the 1-based position of the word's first byte.
+	Line   int
+	Column int
+	// Offset is the 0-based byte offset of the word's first byte.
+	Offset int
+}
+
+// Command is a simple command: the words between two command separators
+// (newline, ";", "&", "|", "&&", "||", "(" or ")").
+type Command struct {
+	Words []Word
+	// Depth is the nesting level of the command inside compound commands
+	// ({ }, ( ), if/fi, for/done, while/done, until/done, case/esac).
+	// Top-level commands have depth 0.
+	Depth int
+}
+
+// SyntaxError reports input the tokenizer could not make sense of,
+// such as an unterminated quote.
+type SyntaxError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// Tokenize splits shell source into simple commands following POSIX shell
+// word rules: single and double quotes, backslash escapes, bash $'...'
+// strings, line continuations and "#" comments. Quoted segments that touch
+// are concatenated into one word ('a'"b"c -> abc). Parameter expansions and
+// command substitutions are kept verbatim. Here-document bodies (<<EOF,
+// <<-EOF) are skipped up to their terminator line.
+//
+// On a syntax error the commands completed before it are returned along
+// with a *SyntaxError.
+func Tokenize(src string) ([]Command, error) {
+	lx := &lexer{src: src, line: 1, col: 1}
+	var cmds []Command
+	var cur []Word
+	var open []string      // enclosing compound commands, innermost last
+	var heredocs []heredoc // here-documents whose body starts on the next line
+
+	flush := func() {
+		if len(cur) > 0 {
+			cmds = append(cmds, Command{Words: cur, Depth: len(open)})
+			cur = nil
+		}
+	}
+	closeCompound := func(openers ...string) {
+		if n := len(open); n > 0 {
+			for _, o := range openers {
+				if open[n-1] == o {
+					open = open[:n-1]
+					return
+				}
+			}
+		}
+	}
+
+	for {
+		lx.skipBlanks()
+		if lx.eof() {
+			break
+		}
+
+		c := lx.peek()
+		switch {
+		case c == '#':
+			lx.skipComment()
+		case c == '\n':
+			lx.advance()
+			flush()
+			for _, h := range heredocs {
+				if err := lx.skipHeredoc(h); err != nil {
+					return cmds, err
+				}
+			}
+			heredocs = nil
+		case c == ';' || c == '&' || c == '|':
+			lx.advance()
+			if !lx.eof() && lx.peek() == c {
+				lx.advance()
+			}
+			flush()
+		case c == '(':
+			lx.advance()
+			flush()
+			open = append(open, "(")
+		case c == ')':
+			// Inside "case" a ")" ends a pattern, not a subshell.
+			lx.advance()
+			flush()
+			closeCompound("(")
+		case c == '<' || c == '>':
+			// Redirections: the operator and its target are not arguments.
+			start := lx.pos
+			lx.advance()
+			for !lx.eof() && strings.IndexByte("<>&|-", lx.peek()) >= 0 {
+				lx.advance()
+			}
+			op := lx.src[start:lx.pos]
+			lx.skipBlanks()
+			if !lx.eof() && !isMeta(lx.peek()) {
+				line, col := lx.line, lx.col
+				target, err := lx.word()
+				if err != nil {
+					return cmds, err
+				}
+				if op == "<<" || op == "<<-" {
+					// Quoting the delimiter only disables expansions in
+					// the body, which is skipped anyway.
+					heredocs = append(heredocs, heredoc{delim: target.Value, stripTabs: op == "<<-", line: line, col: col})
+				}
+			}
+		default:
+			w, err := lx.word()
+			if err != nil {
+				// The unfinished command is dropped.
+				return cmds, err
+			}
+			if len(cur) == 2 && cur[0].Value == "function" && w.Value == "{" {
+				// "function name {": the brace opens the body.
+				flush()
+			}
+			if len(cur) > 0 {
+				cur = append(cur, w)
+				continue
+			}
+			// Reserved words are only recognised at the start of a command.
+			// Those followed directly by another command ("then ls") are
+			// emitted on their own so the next word starts a new command.
+			switch w.Value {
+			case "{", "if", "while", "until":
+				cmds = append(cmds, Command{Words: []Word{w}, Depth: len(open)})
+				open = append(open, w.Value)
+			case "then", "do", "else", "elif", "!":
+				cmds = append(cmds, Command{Words: []Word{w}, Depth: len(open)})
+			case "}", "fi", "done", "esac":
+				closeCompound(closerOf[w.Value]...)
+				cur = append(cur, w)
+			case "for", "case":
+				open = append(open, w.Value)
+				cur = append(cur, w)
+			default:
+				cur = append(cur, w)
+			}
+		}
+	}
+	flush()
+	if len(heredocs) > 0 {
+		h := heredocs[0]
+		return cmds, lx.errorf(h.line, h.col, "here-document %q has no body", h.delim)
+	}
+	return cmds, nil
+}
+
+// heredoc is a pending here-document: its body starts after the newline
+// that ends the command, and runs up to a line consisting of delim.
+type heredoc struct {
+	delim string
+	// stripTabs is set for <<-, which allows the terminator (and body
+	// lines) to be indented with tabs.
+	stripTabs bool
+	// line and col locate the delimiter word, for errors.
+	line, col int
+}
+
+// closerOf maps reserved words that end a compound command to the words
+// that may have opened it.
+var closerOf = map[string][]string{
+	"}":    {"{"},
+	"fi":   {"if"},
+	"done": {"for", "while", "until"},
+	"esac": {"case"},
+}
+
+// isMeta reports whether c terminates an unquoted word.
+func isMeta(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', ';', '&', '|', '(', ')', '<', '>':
+		return true
+	}
+	return false
+}
+
+type lexer struct {
+	src  string
+	pos  int
+	line int
+	col  int
+}
+
+func (lx *lexer) eof() bool  { return lx.pos >= len(lx.src) }
+func (lx *lexer) peek() byte { return lx.src[lx.pos] }
+
+func (lx *lexer) advance() byte {
+	c := lx.src[lx.pos]
+	lx.pos++
+	if c == '\n' {
+		lx.line++
+		lx.col = 1
+	} else {
+		lx.col++
+	}
+	return c
+}
+
+func (lx *lexer) errorf(line, col int, format string, args ...any) error {
+	return &SyntaxError{Line: line, Column: col, Message: fmt.Sprintf(format, args...)}
+}
+
+// skipBlanks consumes spaces, tabs, carriage returns and line continuations.
+func (lx *lexer) skipBlanks() {
+	for !lx.eof() {
+		c := lx.peek()
+		if c == ' ' || c == '\t' || c == '\r' {
+			lx.advance()
+			continue
+		}
+		if c == '\\' && lx.pos+1 < len(lx.src) && lx.src[lx.pos+1] == '\n' {
+			lx.advance()
+			lx.advance()
+			continue
+		}
+		return
+	}
+}
+
+func (lx *lexer) skipComment() {
+	for !lx.eof() && lx.peek() != '\n' {
+		lx.advance()
+	}
+}
+
+// skipHeredoc consumes the body of a here-document and its terminator
+// line. The current position must be at the start of the body.
+func (lx *lexer) skipHeredoc(h heredoc) error {
+	for !lx.eof() {
+		start := lx.pos
+		for !lx.eof() && lx.peek() != '\n' {
+			lx.advance()
+		}
+		line := strings.TrimSuffix(lx.src[start:lx.pos], "\r")
+		if !lx.eof() {
+			lx.advance()
+		}
+		if h.stripTabs {
+			line = strings.TrimLeft(line, "\t")
+		}
+		if line == h.delim {
+			return nil
+		}
+	}
+	return lx.errorf(h.line, h.col, "unterminated here-document (expected %q)", h.delim)
+}
+
+// word reads one word starting at the current position.
+func (lx *lexer) word() (Word, error) {
+	start := lx.pos
+	w := Word{Line: lx.line, Column: lx.col, Offset: lx.pos}
+	var sb strings.Builder
+
+	for !lx.eof() {
+		c := lx.peek()
+		if c == '\r' && lx.pos+1 < len(lx.src) && lx.src[lx.pos+1] == '\n' {
+			lx.advance()
+			continue
+		}
+		if isMeta(c) {
+			break
+		}
+		switch c {
+		case '\\':
+			lx.advance()
+			if lx.eof() {
+				sb.WriteByte('\\')
+				break
+			}
+			if e := lx.advance(); e != '\n' {
+				sb.WriteByte(e)
+			}
+		case '\'':
+			if err := lx.singleQuoted(&sb); err != nil {
+				return w, err
+			}
+		case '"':
+			if err := lx.doubleQuoted(&sb); err != nil {
+				return w, err
+			}
+		case '$':
+			if err := lx.dollar(&sb); err != nil {
+				return w, err
+			}
+		case '`':
+			if err := lx.backquoted(&sb); err != nil {
+				return w, err
+			}
+		default:
+			sb.WriteByte(lx.advance())
+		}
+	}
+
+	w.Value = sb.String()
+	w.Raw = lx.src[start:lx.pos]
+	return w, nil
+}
+
+func (lx *lexer) singleQuoted(sb *strings.Builder) error {
+	line, col := lx.line, lx.col
+	lx.advance()
+	for !lx.eof() {
+		c := lx.advance()
+		if c == '\'' {
+			return nil
+		}
+		sb.WriteByte(c)
+	}
+	return lx.errorf(line, col, "unterminated single quote")
+}
+
+func (lx *lexer) doubleQuoted(sb *strings.Builder) error {
+	line, col := lx.line, lx.col
+	lx.advance()
+	for !lx.eof() {
+		c := lx.peek()
+		switch c {
+		case '"':
+			lx.advance()
+			return nil
+		case '\\':
+			lx.advance()
+			if lx.eof() {
+				return lx.errorf(line, col, "unterminated double quote")
+			}
+			e := lx.advance()
+			switch e {
+			case '$', '`', '"', '\\':
+				sb.WriteByte(e)
+			case '\n':
+				// Line continuation: removed entirely.
+			default:
+				sb.WriteByte('\\')
+				sb.WriteByte(e)
+			}
+		case '$':
+			if lx.pos+1 < len(lx.src) && lx.src[lx.pos+1] == '\'' {
+				// $'...' is not special inside double quotes.
+				sb.WriteByte(lx.advance())
+				continue
+			}
+			if err := lx.dollar(sb); err != nil {
+				return err
+			}
+		case '`':
+			if err := lx.backquoted(sb); err != nil {
+				return err
+			}
+		default:
+			sb.WriteByte(lx.advance())
+		}
+	}
+	return lx.errorf(line, col, "unterminated double quote")
+}
+
+// dollar copies a "$" expansion verbatim. $'...' strings are decoded;
+// ${...}, $(...) and $((...)) are copied including their nested quoting.
+func (lx *lexer) dollar(sb *strings.Builder) error {
+	line, col := lx.line, lx.col
+	lx.advance()
+	if lx.eof() {
+		sb.WriteByte('$')
+		return nil
+	}
+	switch lx.peek() {
+	case '\'':
+		return lx.ansiQuoted(sb)
+	case '{':
+		sb.WriteByte('$')
+		return lx.balanced(sb, '{', '}', line, col)
+	case '(':
+		sb.WriteByte('$')
+		return lx.balanced(sb, '(', ')', line, col)
+	}
+	sb.WriteByte('$')
+	return nil
+}
+
+// balanced copies text up to the matching close byte, honouring quotes so
+// that "}" or ")" inside them do not end the expansion.
+func (lx *lexer) balanced(sb *strings.Builder, open, close byte, line, col int) error {
+	depth := 0
+	for !lx.eof() {
+		c := lx.peek()
+		switch c {
+		case '\\':
+			sb.WriteByte(lx.advance())
+			if !lx.eof() {
+				sb.WriteByte(lx.advance())
+			}
+			continue
+		case '\'', '"':
+			start := lx.pos
+			var discard strings.Builder
+			var err error
+			if c == '\'' {
+				err = lx.singleQuoted(&discard)
+			} else {
+				err = lx.doubleQuoted(&discard)
+			}
+			if err != nil {
+				return err
+			}
+			sb.WriteString(lx.src[start:lx.pos])
+			continue
+		case open:
+			depth++
+		case close:
+			depth--
+		}
+		sb.WriteByte(lx.advance())
+		if depth == 0 {
+			return nil
+		}
+	}
+	return lx.errorf(line, col, "unterminated $%c", open)
+}
+
+func (lx *lexer) backquoted(sb *strings.Builder) error {
+	line, col := lx.line, lx.col
+	sb.WriteByte(lx.advance())
+	for !lx.eof() {
+		c := lx.advance()
+		sb.WriteByte(c)
+		if c == '\\' && !lx.eof() {
+			sb.WriteByte(lx.advance())
+			continue
+		}
+		if c == '`' {
+			return nil
+		}
+	}
+	return lx.errorf(line, col, "unterminated backquote")
+}
+
+// ansiQuoted decodes a bash $'...' string. The leading "$" has already
+// been consumed.
+func (lx *lexer) ansiQuoted(sb *strings.Builder) error {
+	line, col := lx.line, lx.col-1
+	lx.advance()
+	for !lx.eof() {
+		c := lx.advance()
+		if c == '\'' {
+			return nil
+		}
+		if c != '\\' {
+			sb.WriteByte(c)
+			continue
+		}
+		if lx.eof() {
+			break
+		}
+		e := lx.advance()
+		switch e {
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'a':
+			sb.WriteByte('\a')
+		case 'b':
+			sb.WriteByte('\b')
+		case 'e', 'E':
+			sb.WriteByte(0x1b)
+		case 'f':
+			sb.WriteByte('\f')
+		case 'v':
+			sb.WriteByte('\v')
+		case '\\', '\'', '"', '?':
+			sb.WriteByte(e)
+		default:
+			sb.WriteByte('\\')
+			sb.WriteByte(e)
+		}
+	}
+	return lx.errorf(line, col, "unterminated $' string")
+}
@@ -3,7 +3,7 @@
 package parser
 
 import (
-	"bufio"
+	"io"
 	"os"
 	"strings"
 )
@@ -16,11 +16,19 @@ type AliasDef struct {
 	Command string
 	// Source is the file path where this alias was defined.
 	Source string
+	// Line is the 1-based line of the definition in Source.
+	Line int
 }
 
 // ParseAliases extracts alias definitions from a shell script file.
-// It strictly parses "alias name='command'" or 'alias name="command"' lines,
-// ignoring comments, functions, and other shell constructs.
+// The file is tokenized with POSIX shell quoting rules and only top-level
+// "alias" commands are kept; comments, functions, conditionals and other
+// shell constructs are ignored. A single "alias" command may define several
+// aliases ("alias a=b c=d").
+//
+// If the file has a syntax error (e.g. an unterminated quote), the aliases
+// defined before it are returned along with a *SyntaxError. Use ParseFile
+// to get the full list of diagnostics.
 func ParseAliases(filePath string) ([]AliasDef, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -28,52 +36,148 @@ func ParseAliases(filePath string) ([]AliasDef, error) {
 	}
 	defer file.Close()
 
-	var aliases []AliasDef
-	scanner := bufio.NewScanner(file)
+	return ParseAliasesFrom(file, filePath)
+}
+
+// ParseAliasesFrom is like ParseAliases but reads the script from r.
+// source labels the content in AliasDef.Source (e.g. "<stdin>" or
+// "registry@abc123:git-kit/alias.sh").
+func ParseAliasesFrom(r io.Reader, source string) ([]AliasDef, error) {
+	res, err := Parse(r, source)
+	if err != nil {
+		return nil, err
+	}
+	return res.Aliases, res.syntaxErr
+}
+
+// ParseFile parses a shell script file like ParseAliases, but instead of
+// silently skipping malformed definitions it reports each one as a
+// Diagnostic. The returned error is only set if the file cannot be read.
+func ParseFile(filePath string) (*ParseResult, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Parse(file, filePath)
+}
+
+// Parse reads a shell script from r and returns its aliases and
+// diagnostics. source is used as AliasDef.Source and Diagnostic.File.
+// The returned error is only set if reading from r fails.
+func Parse(r io.Reader, source string) (*ParseResult, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseSource(string(data), source), nil
+}
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+func parseSource(src, source string) *ParseResult {
+	res := &ParseResult{}
 
-		// 1. Filter: Must start with "alias "
-		if !strings.HasPrefix(line, "alias ") {
+	cmds, tokErr := Tokenize(src)
+	if synErr, ok := tokErr.(*SyntaxError); ok {
+		res.syntaxErr = synErr
+		res.report(source, synErr.Line, synErr.Column, SeverityError, "%s", synErr.Message)
+	}
+
+	defined := make(map[string]int)
+	for _, cmd := range cmds {
+		if len(cmd.Words) == 0 {
 			continue
 		}
-
-		// 2. Split by first "="
-		// alias foo='bar baz'
-		// left: "alias foo", right: "'bar baz'"
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
+		first := cmd.Words[0]
+		if first.Value != "alias" {
+			if cmd.Depth == 0 && !isReservedWord(first.Value) {
+				res.report(source, first.Line, first.Column, SeverityInfo,
+					"ignoring %q: only alias definitions are compiled", first.Value)
+			}
+			continue
+		}
+		if cmd.Depth > 0 {
+			res.report(source, first.Line, first.Column, SeverityWarning,
+				"alias inside a function or compound command is ignored")
 			continue
 		}
 
-		// 3. Extract Name
-		// "alias foo" -> "foo"
-		namePart := strings.TrimSpace(parts[0])
-		name := strings.TrimPrefix(namePart, "alias ")
-		name = strings.TrimSpace(name) // "foo"
-
-		// 4. Extract Value
-		value := strings.TrimSpace(parts[1])
-
-		// 5. Unquote (Basic)
-		// We want the raw command to re-quote it safely later.
-		if len(value) >= 2 {
-			first := value[0]
-			last := value[len(value)-1]
-			if (first == '"' && last == '"') || (first == '\'' && last == '\'') {
-				value = value[1 : len(value)-1]
-			}
+		args := cmd.Words[1:]
+		if len(args) > 0 && args[0].Value == "--" {
+			args = args[1:]
+		} else if len(args) > 0 && strings.HasPrefix(args[0].Value, "-") && !strings.Contains(args[0].Value, "=") {
+			res.report(source, args[0].Line, args[0].Column, SeverityWarning,
+				"unsupported alias option %q", args[0].Value)
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			res.report(source, first.Line, first.Column, SeverityWarning,
+				"'alias' without arguments defines nothing")
 		}
 
-		if name != "" && value != "" {
-			aliases = append(aliases, AliasDef{
+		for _, arg := range args {
+			// Split on the first "=" after quote removal, like the builtin.
+			name, value, ok := strings.Cut(arg.Value, "=")
+			switch {
+			case !ok:
+				res.report(source, arg.Line, arg.Column, SeverityWarning,
+					"'alias %s' has no '=' and defines nothing", arg.Value)
+				continue
+			case !IsValidName(name):
+				res.report(source, arg.Line, arg.Column, SeverityError,
+					"invalid alias name %q", name)
+				continue
+			case value == "":
+				res.report(source, arg.Line, arg.Column, SeverityWarning,
+					"alias %q has an empty command and is skipped", name)
+				continue
+			}
+
+			if prev, dup := defined[name]; dup {
+				res.report(source, arg.Line, arg.Column, SeverityWarning,
+					"alias %q redefined (previous definition on line %d)", name, prev)
+			}
+			defined[name] = arg.Line
+
+			res.Aliases = append(res.Aliases, AliasDef{
 				Name:    name,
 				Command: value,
-				Source:  filePath,
+				Source:  source,
+				Line:    arg.Line,
 			})
 		}
 	}
 
-	return aliases, scanner.Err()
+	sortDiagnostics(res.Diagnostics)
+	return res
+}
+
+// isReservedWord reports whether s is shell syntax rather than a command.
+func isReservedWord(s string) bool {
+	switch s {
+	case "{", "}", "if", "then", "else", "elif", "fi", "for", "while", "until",
+		"do", "done", "case", "esac", "!", "function":
+		return true
+	}
+	return false
+}
+
+// IsValidName reports whether name is safe to use as an alias name.
+// Names are emitted unquoted into generated shell files, so anything that
+// the shell would interpret (quotes, expansions, separators, "/") is
+// rejected.
+func IsValidName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.IndexByte("_-.:+@,%", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
 }
@@ -1,8 +1,10 @@
 package parser
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -160,6 +162,309 @@ func TestParseAliases_SourceField(t *testing.T) {
 	}
 }
 
+func TestParseAliases_ShellQuoting(t *testing.T) {
+	content := `alias a='echo '\''hi'\'''
+alias b="say \"quoted\" \$HOME"
+alias c=plain\ word
+alias d='one'"two"three
+alias e=$'tab\tx'
+alias f='echo hi' # trailing comment
+alias g="a#b" h=x#y
+alias i="$(date +%s) ${HOME:-/}"
+`
+	tmpFile := createTempFile(t, content)
+
+	aliases, err := ParseAliases(tmpFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]string{
+		"a": "echo 'hi'",
+		"b": `say "quoted" $HOME`,
+		"c": "plain word",
+		"d": "onetwothree",
+		"e": "tab\tx",
+		"f": "echo hi",
+		"g": "a#b",
+		"h": "x#y",
+		"i": "$(date +%s) ${HOME:-/}",
+	}
+	if len(aliases) != len(want) {
+		t.Fatalf("expected %d aliases, got %d: %+v", len(want), len(aliases), aliases)
+	}
+	for _, a := range aliases {
+		if a.Command != want[a.Name] {
+			t.Errorf("alias %s: expected %q, got %q", a.Name, want[a.Name], a.Command)
+		}
+	}
+}
+
+func TestParseAliases_MultipleDefinitions(t *testing.T) {
+	content := `alias a=b c='d e'; alias -- -x='ls -x'
+alias 'q=quoted name'
+alias lookup
+alias bad\;name=x
+`
+	tmpFile := createTempFile(t, content)
+
+	aliases, err := ParseAliases(tmpFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []AliasDef{
+		{Name: "a", Command: "b"},
+		{Name: "c", Command: "d e"},
+		{Name: "-x", Command: "ls -x"},
+		{Name: "q", Command: "quoted name"},
+	}
+	if len(aliases) != len(want) {
+		t.Fatalf("expected %d aliases, got %d: %+v", len(want), len(aliases), aliases)
+	}
+	for i, w := range want {
+		if aliases[i].Name != w.Name || aliases[i].Command != w.Command {
+			t.Errorf("alias %d: expected %s=%q, got %s=%q", i, w.Name, w.Command, aliases[i].Name, aliases[i].Command)
+		}
+	}
+}
+
+func TestParseAliases_IgnoresNestedAliases(t *testing.T) {
+	content := `f() {
+    alias inner='x'
+}
+if true; then alias cond='y'; fi
+alias top='z'
+`
+	tmpFile := createTempFile(t, content)
+
+	aliases, err := ParseAliases(tmpFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(aliases) != 1 || aliases[0].Name != "top" {
+		t.Errorf("expected only 'top', got %+v", aliases)
+	}
+}
+
+func TestParseAliases_UnterminatedQuote(t *testing.T) {
+	content := `alias ok='fine'
+alias broken='oops
+`
+	tmpFile := createTempFile(t, content)
+
+	aliases, err := ParseAliases(tmpFile)
+	synErr, ok := err.(*SyntaxError)
+	if !ok {
+		t.Fatalf("expected *SyntaxError, got %v", err)
+	}
+	if synErr.Line != 2 || synErr.Column != 14 {
+		t.Errorf("expected error at 2:14, got %d:%d", synErr.Line, synErr.Column)
+	}
+	if len(aliases) != 1 || aliases[0].Name != "ok" {
+		t.Errorf("expected aliases before the error to be kept, got %+v", aliases)
+	}
+}
+
+func TestTokenize_Positions(t *testing.T) {
+	cmds, err := Tokenize("alias  a='b c'\n  echo \"x\"y")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cmds) != 2 {
+		t.Fatalf("expected 2 commands, got %d", len(cmds))
+	}
+
+	w := cmds[0].Words[1]
+	if w.Value != "a=b c" || w.Raw != "a='b c'" || w.Line != 1 || w.Column != 8 {
+		t.Errorf("unexpected word: %+v", w)
+	}
+	w = cmds[1].Words[1]
+	if w.Value != "xy" || w.Line != 2 || w.Column != 8 {
+		t.Errorf("unexpected word: %+v", w)
+	}
+}
+
+func TestTokenize_Heredoc(t *testing.T) {
+	src := "cat <<EOF >out\ndon't\nalias x='y'\nEOF\nalias a='b'\n" +
+		"cat <<-'END'\n\tit's indented\n\tEND\necho done\n"
+	cmds, err := Tokenize(src)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []string
+	for _, c := range cmds {
+		got = append(got, c.Words[0].Value)
+	}
+	if want := "cat alias cat echo"; strings.Join(got, " ") != want {
+		t.Errorf("expected commands %q, got %v", want, got)
+	}
+	if w := cmds[1].Words[1]; w.Value != "a=b" || w.Line != 5 {
+		t.Errorf("unexpected word after the body: %+v", w)
+	}
+
+	if _, err := Tokenize("cat <<EOF\nno end\n"); err == nil {
+		t.Error("expected an error for an unterminated here-document")
+	}
+}
+
+func TestParseAliases_IgnoresHeredocBodies(t *testing.T) {
+	content := `cat <<EOF
+don't
+alias inner='x'
+EOF
+alias top='z'
+`
+	tmpFile := createTempFile(t, content)
+
+	aliases, err := ParseAliases(tmpFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(aliases) != 1 || aliases[0].Name != "top" {
+		t.Errorf("expected only 'top', got %+v", aliases)
+	}
+}
+
+func TestIsValidName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"ll", true},
+		{"git-st", true},
+		{"-x", true},
+		{"k8s.ctx", true},
+		{"", false},
+		{"a b", false},
+		{"a;b", false},
+		{"a/b", false},
+		{"$x", false},
+		{"a'b", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsValidName(tt.name); got != tt.expected {
+			t.Errorf("IsValidName(%q) = %v, want %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestParseFile_Diagnostics(t *testing.T) {
+	content := `alias ok='fine'
+alias lookup
+alias bad\;x=y
+f() { alias nested=x; }
+alias dup=1
+alias dup=2
+alias broken='oops
+`
+	tmpFile := createTempFile(t, content)
+
+	res, err := ParseFile(tmpFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []struct {
+		line, col int
+		sev       Severity
+	}{
+		{2, 7, SeverityWarning},
+		{3, 7, SeverityError},
+		{4, 7, SeverityWarning},
+		{6, 7, SeverityWarning},
+		{7, 14, SeverityError},
+	}
+	diags := res.Filter(SeverityWarning)
+	if len(diags) != len(want) {
+		t.Fatalf("expected %d diagnostics, got %d: %v", len(want), len(diags), diags)
+	}
+	for i, w := range want {
+		d := diags[i]
+		if d.Line != w.line || d.Column != w.col || d.Severity != w.sev || d.File != tmpFile {
+			t.Errorf("diagnostic %d: expected %d:%d %s, got %s", i, w.line, w.col, w.sev, d)
+		}
+	}
+	if !res.HasErrors() {
+		t.Error("expected HasErrors to be true")
+	}
+	if len(res.Aliases) != 3 {
+		t.Errorf("expected 3 aliases, got %d", len(res.Aliases))
+	}
+}
+
+func TestParse_Reader(t *testing.T) {
+	src := "alias ll='ls -la'\nalias gs='git status'\n"
+
+	res, err := Parse(strings.NewReader(src), "<stdin>")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.Aliases) != 2 {
+		t.Fatalf("expected 2 aliases, got %d", len(res.Aliases))
+	}
+	for _, a := range res.Aliases {
+		if a.Source != "<stdin>" {
+			t.Errorf("expected source '<stdin>', got '%s'", a.Source)
+		}
+	}
+}
+
+func TestParseAliasesFrom_ReadError(t *testing.T) {
+	_, err := ParseAliasesFrom(failingReader{}, "broken")
+	if err == nil {
+		t.Error("expected read error to be returned")
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("read failed") }
+
+func TestParseFunctions(t *testing.T) {
+	src := `# helpers
+mkcd() {
+  mkdir -p "$1" && cd "$1"
+}
+function up { cd ..; }
+function gclone() { git clone "$1" && cd "$(basename "$1" .git)"; }
+rm -rf ~
+empty() { }
+`
+
+	res, err := ParseFunctions(strings.NewReader(src), "functions.sh")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []FunctionDef{
+		{Name: "mkcd", Body: `mkdir -p "$1" && cd "$1"`, Line: 2},
+		{Name: "up", Body: "cd ..;", Line: 5},
+		{Name: "gclone", Body: `git clone "$1" && cd "$(basename "$1" .git)";`, Line: 6},
+	}
+	if len(res.Functions) != len(want) {
+		t.Fatalf("expected %d functions, got %d: %+v", len(want), len(res.Functions), res.Functions)
+	}
+	for i, w := range want {
+		f := res.Functions[i]
+		if f.Name != w.Name || f.Body != w.Body || f.Line != w.Line || f.Source != "functions.sh" {
+			t.Errorf("function %d: expected %+v, got %+v", i, w, f)
+		}
+	}
+
+	diags := res.Filter(SeverityWarning)
+	if len(diags) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %v", diags)
+	}
+	if diags[0].Line != 7 || diags[0].Severity != SeverityError {
+		t.Errorf("expected top-level command error on line 7, got %s", diags[0])
+	}
+	if diags[1].Line != 8 || diags[1].Severity != SeverityWarning {
+		t.Errorf("expected empty body warning on line 8, got %s", diags[1])
+	}
+}
+
 // Helper function to create temp files for testing
 func createTempFile(t *testing.T, content string) string {
 	t.Helper()
@@ -0,0 +1,165 @@
+package semver
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Constraint is a set of version ranges. A version satisfies it if it is
+// in any of the ranges ("||"); a range is a list of comparisons that must
+// all hold (separated by spaces or commas). Supported forms:
+//
+//	1.2.3  =1.2.3  !=1.2.3  >1.2.3  >=1.2  <2  <=1.2.x
+//	^1.2.3  (>=1.2.3 <2.0.0; ^0.2.3 is >=0.2.3 <0.3.0)
+//	~1.2.3  (>=1.2.3 <1.3.0)
+//	1.2  1.2.x  (>=1.2.0 <1.3.0)   *  or empty (any version)
+//
+// Pre-releases only satisfy a range that names a pre-release of the same
+// MAJOR.MINOR.PATCH.
+type Constraint struct {
+	text   string
+	ranges [][]comparison
+}
+
+type comparison struct {
+	op string // "=", "!=", ">", ">=", "<", "<="
+	v  Version
+}
+
+// ParseConstraint parses a version constraint.
+func ParseConstraint(s string) (*Constraint, error) {
+	c := &Constraint{text: strings.TrimSpace(s)}
+	for _, alt := range strings.Split(s, "||") {
+		var rng []comparison
+		for _, term := range strings.Fields(strings.ReplaceAll(alt, ",", " ")) {
+			cmps, err := parseTerm(term)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version constraint %q: %w", s, err)
+			}
+			rng = append(rng, cmps...)
+		}
+		c.ranges = append(c.ranges, rng)
+	}
+	return c, nil
+}
+
+// parseTerm expands one term of a range into comparisons.
+func parseTerm(term string) ([]comparison, error) {
+	if term == "*" || term == "x" || term == "X" {
+		return nil, nil
+	}
+	op := ""
+	for _, prefix := range []string{">=", "<=", "!=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(term, prefix) {
+			op = prefix
+			break
+		}
+	}
+	v, parts, err := parsePartial(strings.TrimPrefix(term, op))
+	if err != nil {
+		return nil, err
+	}
+
+	// next returns the lowest version above the partial version
+	// (1.2 -> 1.3.0, 1 -> 2.0.0).
+	next := func(parts int) Version {
+		switch parts {
+		case 0:
+			return Version{Major: 1 << 30}
+		case 1:
+			return Version{Major: v.Major + 1}
+		case 2:
+			return Version{Major: v.Major, Minor: v.Minor + 1}
+		}
+		return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+	}
+	lower := Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch, Pre: v.Pre}
+
+	switch op {
+	case "^":
+		// The first non-zero part may not change.
+		upper := next(1)
+		switch {
+		case v.Major == 0 && parts >= 3 && v.Minor == 0:
+			upper = next(3)
+		case v.Major == 0 && parts >= 2:
+			upper = next(2)
+		}
+		return []comparison{{">=", lower}, {"<", upper}}, nil
+	case "~":
+		upper := next(2)
+		if parts == 1 {
+			upper = next(1)
+		}
+		return []comparison{{">=", lower}, {"<", upper}}, nil
+	case "", "=":
+		if parts == 3 {
+			return []comparison{{"=", v}}, nil
+		}
+		return []comparison{{">=", lower}, {"<", next(parts)}}, nil
+	case ">":
+		if parts == 3 {
+			return []comparison{{">", v}}, nil
+		}
+		return []comparison{{">=", next(parts)}}, nil
+	case "<=":
+		if parts == 3 {
+			return []comparison{{"<=", v}}, nil
+		}
+		return []comparison{{"<", next(parts)}}, nil
+	case "!=":
+		if parts != 3 {
+			return nil, fmt.Errorf("!= needs a full version")
+		}
+		return []comparison{{"!=", v}}, nil
+	}
+	// ">=" and "<" with a partial version use its lowest version.
+	return []comparison{{op, lower}}, nil
+}
+
+// Check reports whether v satisfies the constraint.
+func (c *Constraint) Check(v Version) bool {
+	for _, rng := range c.ranges {
+		if rangeAllows(rng, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func rangeAllows(rng []comparison, v Version) bool {
+	preAllowed := v.Pre == ""
+	for _, cmp := range rng {
+		d := v.Compare(cmp.v)
+		ok := false
+		switch cmp.op {
+		case "=":
+			ok = d == 0
+		case "!=":
+			ok = d != 0
+		case ">":
+			ok = d > 0
+		case ">=":
+			ok = d >= 0
+		case "<":
+			ok = d < 0
+		case "<=":
+			ok = d <= 0
+		}
+		if !ok {
+			return false
+		}
+		if cmp.v.Pre != "" && cmp.v.Major == v.Major && cmp.v.Minor == v.Minor && cmp.v.Patch == v.Patch {
+			preAllowed = true
+		}
+	}
+	return preAllowed
+}
+
+// String returns the constraint as written.
+func (c *Constraint) String() string {
+	if c.text == "" {
+		return "*"
+	}
+	return c.text
+}
@@ -0,0 +1,170 @@
+// Package semver parses semantic versions (https://semver.org) and the
+// version constraints packages use to declare dependencies.
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed semantic version. Build metadata is ignored.
+type Version struct {
+	Major, Minor, Patch int
+	// Pre is the pre-release part ("beta.1"), empty for releases.
+	Pre string
+}
+
+// Parse parses a version of the form MAJOR.MINOR.PATCH[-PRE][+BUILD]. A
+// leading "v" is accepted.
+func Parse(s string) (Version, error) {
+	v, parts, err := parsePartial(s)
+	if err != nil {
+		return Version{}, err
+	}
+	if parts != 3 {
+		return Version{}, fmt.Errorf("invalid version %q: want MAJOR.MINOR.PATCH", s)
+	}
+	return v, nil
+}
+
+// MustParse is like Parse but panics on error.
+func MustParse(s string) Version {
+	v, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// ParseLoose is like Parse but also accepts versions that omit MINOR or
+// PATCH ("2", "1.4"), which are taken as 0. It is meant for versions
+// outside ah's control, such as release tags.
+func ParseLoose(s string) (Version, error) {
+	v, parts, err := parsePartial(s)
+	core, _, _ := strings.Cut(s, "-")
+	if err == nil && parts < strings.Count(core, ".")+1 {
+		err = fmt.Errorf("invalid version %q", s)
+	}
+	if err != nil {
+		return Version{}, err
+	}
+	return v, nil
+}
+
+// parsePartial parses a version that may omit MINOR and PATCH (or give
+// them as "x" or "*") and returns how many numeric parts it has.
+func parsePartial(s string) (Version, int, error) {
+	var v Version
+	rest := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	rest, _, _ = strings.Cut(rest, "+")
+	rest, v.Pre, _ = strings.Cut(rest, "-")
+	if strings.HasSuffix(s, "-") || (v.Pre != "" && !validPre(v.Pre)) {
+		return Version{}, 0, fmt.Errorf("invalid pre-release in version %q", s)
+	}
+
+	fields := strings.Split(rest, ".")
+	if len(fields) > 3 || rest == "" {
+		return Version{}, 0, fmt.Errorf("invalid version %q", s)
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	parts := 0
+	for i, f := range fields {
+		if f == "x" || f == "X" || f == "*" {
+			if i+1 < len(fields) || v.Pre != "" {
+				return Version{}, 0, fmt.Errorf("invalid version %q", s)
+			}
+			break
+		}
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 || (len(f) > 1 && f[0] == '0') {
+			return Version{}, 0, fmt.Errorf("invalid version %q", s)
+		}
+		*nums[i] = n
+		parts++
+	}
+	if v.Pre != "" && parts != 3 {
+		return Version{}, 0, fmt.Errorf("invalid version %q", s)
+	}
+	return v, parts, nil
+}
+
+// validPre reports whether a pre-release is made of non-empty dot-separated
+// alphanumeric identifiers.
+func validPre(pre string) bool {
+	for _, id := range strings.Split(pre, ".") {
+		if id == "" {
+			return false
+		}
+		for _, c := range id {
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 if v is lower than, equal to or higher than o.
+// Pre-releases are lower than their release and compared by identifier,
+// numerically where both are numbers.
+func (v Version) Compare(o Version) int {
+	for _, d := range [][2]int{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		if d[0] != d[1] {
+			return cmpInt(d[0], d[1])
+		}
+	}
+	switch {
+	case v.Pre == o.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case o.Pre == "":
+		return -1
+	}
+
+	a, b := strings.Split(v.Pre, "."), strings.Split(o.Pre, ".")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+		an, aErr := strconv.Atoi(a[i])
+		bn, bErr := strconv.Atoi(b[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			return cmpInt(an, bn)
+		case aErr == nil:
+			return -1 // numeric identifiers sort first
+		case bErr == nil:
+			return 1
+		case a[i] < b[i]:
+			return -1
+		default:
+			return 1
+		}
+	}
+	return cmpInt(len(a), len(b))
+}
+
+// Less reports whether v is lower than o.
+func (v Version) Less(o Version) bool {
+	return v.Compare(o) < 0
+}
+
+func cmpInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+package semver
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	valid := map[string]string{
+		"1.2.3":            "1.2.3",
+		"v1.2.3":           "1.2.3",
+		"1.2.3-beta.1":     "1.2.3-beta.1",
+		"1.2.3+build.5":    "1.2.3",
+		"10.20.30-rc-1+x1": "10.20.30-rc-1",
+	}
+	for in, want := range valid {
+		v, err := Parse(in)
+		if err != nil || v.String() != want {
+			t.Errorf("Parse(%q) = %v, %v; want %s", in, v, err, want)
+		}
+	}
+	for _, in := range []string{"", "1", "1.2", "1.2.3.4", "01.2.3", "1.2.x", "1.2.3-", "1.2.3-be..ta", "a.b.c", "latest"} {
+		if _, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) should fail", in)
+		}
+	}
+}
+
+func TestParseLoose(t *testing.T) {
+	valid := map[string]string{
+		"2":          "2.0.0",
+		"1.4":        "1.4.0",
+		"v1.2.3":     "1.2.3",
+		"1.0.1-beta": "1.0.1-beta",
+	}
+	for in, want := range valid {
+		v, err := ParseLoose(in)
+		if err != nil || v.String() != want {
+			t.Errorf("ParseLoose(%q) = %v, %v; want %s", in, v, err, want)
+		}
+	}
+	for _, in := range []string{"", "1.x", "1.*.0", "1-beta", "abc", "1.2.3.4", "dev"} {
+		if _, err := ParseLoose(in); err == nil {
+			t.Errorf("ParseLoose(%q) should fail", in)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// In ascending order, per the semver spec.
+	order := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta",
+		"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.2.0", "1.10.0", "2.0.0",
+	}
+	for i := range order {
+		for j := range order {
+			got := MustParse(order[i]).Compare(MustParse(order[j]))
+			if want := cmpInt(i, j); got != want {
+				t.Errorf("Compare(%s, %s) = %d, want %d", order[i], order[j], got, want)
+			}
+		}
+	}
+}
+
+func TestConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		yes, no    []string
+	}{
+		{"", []string{"0.0.1", "9.9.9"}, []string{"1.0.0-beta"}},
+		{"1.2.3", []string{"1.2.3"}, []string{"1.2.4"}},
+		{"^1.2", []string{"1.2.0", "1.9.9"}, []string{"1.1.9", "2.0.0", "2.0.0-rc.1"}},
+		{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.3.0"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4"}},
+		{"~1.2.3", []string{"1.2.3", "1.2.9"}, []string{"1.3.0"}},
+		{"~1", []string{"1.0.0", "1.9.0"}, []string{"2.0.0"}},
+		{"1.2.x", []string{"1.2.0", "1.2.7"}, []string{"1.3.0"}},
+		{">=1.2, <2", []string{"1.2.0", "1.99.0"}, []string{"1.1.0", "2.0.0"}},
+		{">1.2", []string{"1.3.0"}, []string{"1.2.9"}},
+		{"<=1.2", []string{"1.2.9"}, []string{"1.3.0"}},
+		{"^1 || ^3", []string{"1.5.0", "3.0.0"}, []string{"2.0.0"}},
+		{"!=1.0.0", []string{"1.0.1"}, []string{"1.0.0"}},
+		{">=2.0.0-beta", []string{"2.0.0-beta.2", "2.0.0", "3.0.0"}, []string{"2.0.0-alpha", "3.0.0-beta"}},
+	}
+	for _, tt := range tests {
+		c, err := ParseConstraint(tt.constraint)
+		if err != nil {
+			t.Fatalf("ParseConstraint(%q) failed: %v", tt.constraint, err)
+		}
+		for _, v := range tt.yes {
+			if !c.Check(MustParse(v)) {
+				t.Errorf("%q should allow %s", tt.constraint, v)
+			}
+		}
+		for _, v := range tt.no {
+			if c.Check(MustParse(v)) {
+				t.Errorf("%q should not allow %s", tt.constraint, v)
+			}
+		}
+	}
+
+	for _, bad := range []string{"^", ">=a", "~1.2.3.4", "!=1.2"} {
+		if _, err := ParseConstraint(bad); err == nil {
+			t.Errorf("ParseConstraint(%q) should fail", bad)
+		}
+	}
+}
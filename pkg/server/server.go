@@ -11,12 +11,11 @@ import (
 	"io/fs"
 	"net/http"
 	"os/exec"
-	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/sarkartanmay393/ah/pkg/manager"
-	"github.com/sarkartanmay393/ah/pkg/parser"
 )
 
 //go:embed web_dist/*
@@ -45,9 +44,16 @@ type ResolveRequest struct {
 var currentConflicts []Conflict
 
 // Start launches the conflict resolution web server on port 9999.
-// It opens the user's browser and blocks until the user closes the UI.
+// It pins the package (optionally "name@constraint") at the version
+// 'ah install' would pick, opens the user's browser and blocks until the
+// user closes the UI. The package is enabled at that revision once its
+// conflicts are resolved.
 func Start(newPkgName string) error {
-	// 1. Calculate Conflicts
+	// 1. Pin the package, then Calculate Conflicts
+	if err := manager.PinPackage(newPkgName); err != nil {
+		return err
+	}
+	newPkgName, _, _ = strings.Cut(newPkgName, "@")
 	var err error
 	currentConflicts, err = calculateConflicts(newPkgName)
 	if err != nil {
@@ -113,30 +119,51 @@ func handleResolve(w http.ResponseWriter, r *http.Request) {
 	fmt.Printf("Action Received: %s for %s (Target: %s)\n", req.Action, req.Alias, req.TargetPackage)
 
 	// Resolution Logic
-	switch req.Action {
+	action, newName, _ := strings.Cut(req.Action, ":")
+	switch action {
 	case "replace":
-		// User chose the NEW package.
-		// We need to Enable the new package.
-		// NOTE: This might cause OTHER conflicts if the new package has other aliases.
-		// But for the specific conflict at hand, this resolves it.
-		// We use the Atomic EnablePackage.
-		if err := manager.EnablePackage(req.TargetPackage); err != nil {
+		// User chose the NEW package's definition. The decision is stored,
+		// so it outlives recompiles, upgrades and 'ah apply'.
+		if err := manager.ResolveConflict(req.Alias, req.TargetPackage); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to resolve: %v", err), 500)
+			return
+		}
+		fmt.Printf("✅ Resolved: %s from '%s' wins\n", req.Alias, req.TargetPackage)
+		if err := enableIfResolved(req.TargetPackage); err != nil {
 			http.Error(w, fmt.Sprintf("Failed to enable package: %v", err), 500)
 			return
 		}
-		fmt.Printf("✅ Resolved: Switched to package '%s'\n", req.TargetPackage)
 
 	case "keep_existing":
-		// User chose to KEEP valid installation.
-		// We don't need to do anything technically, as the existing one is already active.
-		// But we might want to "mark" it resolved in the GUI?
-		// The GUI removes it from the list client-side.
-		fmt.Printf("✅ Resolved: Kept existing package for '%s'\n", req.Alias)
+		// User chose the definition of the package already enabled.
+		existing, ok := existingPackage(req.Alias)
+		if !ok {
+			http.Error(w, fmt.Sprintf("No conflict on %s", req.Alias), 400)
+			return
+		}
+		if err := manager.ResolveConflict(req.Alias, existing); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to resolve: %v", err), 500)
+			return
+		}
+		fmt.Printf("✅ Resolved: Kept %s from '%s'\n", req.Alias, existing)
+		if err := enableIfResolved(req.TargetPackage); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to enable package: %v", err), 500)
+			return
+		}
 
 	case "rename":
-		// Not supported yet in this architecture.
-		http.Error(w, "Rename not supported in this version", 400)
-		return
+		// User chose to keep the existing alias and expose the incoming one
+		// under another name. The rename is stored in the overrides, so it
+		// applies once the package is enabled.
+		if err := manager.RenameDefinition(req.TargetPackage, req.Alias, newName); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to rename: %v", err), http.StatusConflict)
+			return
+		}
+		fmt.Printf("✅ Resolved: %s from '%s' will be available as '%s'\n", req.Alias, req.TargetPackage, newName)
+		if err := enableIfResolved(req.TargetPackage); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to enable package: %v", err), 500)
+			return
+		}
 
 	default:
 		http.Error(w, "Unknown action", 400)
@@ -146,44 +173,53 @@ func handleResolve(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(200)
 }
 
-func calculateConflicts(pkgName string) ([]Conflict, error) {
-	registryPath, err := manager.GetRegistryPackagePath(pkgName)
+// existingPackage returns the enabled package a conflict on alias is with.
+func existingPackage(alias string) (string, bool) {
+	for _, c := range currentConflicts {
+		if c.Alias == alias {
+			return c.Existing.Package, true
+		}
+	}
+	return "", false
+}
+
+// enableIfResolved enables the incoming package, at the revision pinned
+// by Start, once none of its definitions (or its dependencies') conflict
+// any more.
+func enableIfResolved(pkgName string) error {
+	enabled, err := manager.EnableIfResolved(pkgName)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	if enabled {
+		fmt.Printf("✅ All conflicts resolved: enabled package '%s'\n", pkgName)
+	}
+	return nil
+}
 
-	// 1. Get raw conflict map (Alias -> ExistingPkgName)
-	rawConflicts, err := manager.CheckConflicts(registryPath)
+func calculateConflicts(pkgName string) ([]Conflict, error) {
+	// 1. Get raw conflict map (Alias -> ExistingPkgName) and the pinned
+	// definitions, to get commands
+	rawConflicts, newContent, err := manager.PendingConflicts(pkgName)
 	if err != nil {
 		return nil, err
 	}
 
 	var list []Conflict
 
-	// 2. Parse New Package Aliases to get commands
-	newAliases, _ := parser.ParseAliases(filepath.Join(registryPath, "alias.sh"))
-
-	// 3. Build detailed conflict objects
+	// 2. Build detailed conflict objects
 	for alias, existingPkgName := range rawConflicts {
-		// Find New Command
+		// Find New Command (empty if a dependency defines it)
 		var newCmd string
-		for _, a := range newAliases {
-			if a.Name == alias {
-				newCmd = a.Command
-				break
-			}
+		if newContent != nil {
+			newCmd, _ = newContent.Describe(alias)
 		}
 
-		// Find Existing Command
-		root, _ := manager.GetRootDir()
-		existingPath := filepath.Join(root, manager.ActiveDir, existingPkgName, "alias.sh")
-		existParams, _ := parser.ParseAliases(existingPath)
+		// Find Existing Command (at its pinned revision)
 		var existCmd string
-		for _, a := range existParams {
-			if a.Name == alias {
-				existCmd = a.Command
-				break
-			}
+		existing, err := manager.LoadActiveContent(existingPkgName)
+		if err == nil {
+			existCmd, _ = existing.Describe(alias)
 		}
 
 		list = append(list, Conflict{
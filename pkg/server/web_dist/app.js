@@ -79,20 +79,22 @@ function selectConflict(idx) {
     document.getElementById('cmd-new').innerText = currentConflict.new.command;
 }
 
-async function resolve(action) {
-    if (!currentConflict) return;
-
-    // Optimistic UI update
+function notify(text, color) {
     const note = document.createElement('div');
     note.className = 'glass';
-    note.style = 'position: fixed; bottom: 20px; right: 20px; padding: 16px; border-radius: 8px; background: var(--success); color: white; animation: slideIn 0.3s;';
-    note.innerText = 'Resolved: ' + action;
+    note.style = 'position: fixed; bottom: 20px; right: 20px; padding: 16px; border-radius: 8px; color: white; animation: slideIn 0.3s;';
+    note.style.background = color;
+    note.innerText = text;
     document.body.appendChild(note);
-    setTimeout(() => note.remove(), 2000);
+    setTimeout(() => note.remove(), 3000);
+}
+
+async function resolve(action) {
+    if (!currentConflict) return;
 
     // Call API
     try {
-        await fetch('/api/resolve', {
+        const res = await fetch('/api/resolve', {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify({
@@ -101,7 +103,17 @@ async function resolve(action) {
                 targetPackage: currentConflict.new.package
             })
         });
-    } catch (e) { console.error(e); }
+        if (!res.ok) {
+            // e.g. the new name is taken: keep the conflict open
+            notify(await res.text(), 'var(--danger)');
+            return;
+        }
+    } catch (e) {
+        console.error(e);
+        notify('Request failed: ' + e.message, 'var(--danger)');
+        return;
+    }
+    notify('Resolved: ' + action, 'var(--success)');
 
     // Remove from list
     conflicts = conflicts.filter(c => c.alias !== currentConflict.alias);
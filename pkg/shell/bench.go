@@ -0,0 +1,155 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The stat-based hooks shipped before the generation counter, kept so
+// Benchmark can compare against them. They are renamed so that sourcing
+// the current env file does not replace them.
+const (
+	legacyPosixHook = `ah_check_state_legacy() {
+	local state_file="$AH_ROOT/state"
+	if [ -f "$state_file" ]; then
+		local current_mtime=""
+		if stat -f "%m" "$state_file" >/dev/null 2>&1; then
+			current_mtime=$(stat -f "%m" "$state_file")
+		else
+			current_mtime=$(stat -c "%Y" "$state_file" 2>/dev/null)
+		fi
+		if [ -n "$current_mtime" ] && [ "$current_mtime" != "$AH_LAST_MTIME" ]; then
+			export AH_LAST_MTIME="$current_mtime"
+			source "$AH_ROOT/env.sh"
+		fi
+	fi
+}
+ah_bench_noop() { :; }
+`
+	legacyFishHook = `function ah_check_state_legacy
+	set -l state_file "$AH_ROOT/state"
+	test -f "$state_file"; or return
+	set -l current_mtime
+	if stat -f "%m" "$state_file" >/dev/null 2>&1
+		set current_mtime (stat -f "%m" "$state_file")
+	else
+		set current_mtime (stat -c "%Y" "$state_file" 2>/dev/null)
+	end
+	if test -n "$current_mtime"; and test "$current_mtime" != "$AH_LAST_MTIME"
+		set -gx AH_LAST_MTIME $current_mtime
+		source "$AH_ROOT/env.fish"
+	end
+end
+function ah_bench_noop
+end
+`
+)
+
+// BenchResult is the measured cost of one run of the live update hook when
+// nothing changed, i.e. on a typical prompt.
+type BenchResult struct {
+	Shell      string
+	Iterations int
+	// Current is the cost of the generation counter hook.
+	Current time.Duration
+	// Legacy is the cost of the previous stat-based hook.
+	Legacy time.Duration
+}
+
+// Benchmark runs the shell's hook iterations times in a scratch ah root and
+// reports the average cost per call, with loop and startup overhead
+// subtracted. The shell binary must be on $PATH.
+func (s *Shell) Benchmark(iterations int) (*BenchResult, error) {
+	if iterations <= 0 {
+		return nil, fmt.Errorf("iterations must be positive")
+	}
+	bin, err := exec.LookPath(s.Name)
+	if err != nil {
+		return nil, fmt.Errorf("%s not found in PATH", s.Name)
+	}
+
+	root, err := os.MkdirTemp("", "ah-bench-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(root)
+
+	for name, content := range EnvFiles(root) {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "state"), []byte("1\n"), 0644); err != nil {
+		return nil, err
+	}
+
+	run := func(fn string) (time.Duration, error) {
+		script := s.benchScript(root, fn, iterations)
+		// Best of three, to keep scheduler noise out of the result.
+		var best time.Duration
+		for i := 0; i < 3; i++ {
+			start := time.Now()
+			out, err := exec.Command(bin, "-c", script).CombinedOutput()
+			if err != nil {
+				return 0, fmt.Errorf("%s: %v: %s", s.Name, err, strings.TrimSpace(string(out)))
+			}
+			if d := time.Since(start); i == 0 || d < best {
+				best = d
+			}
+		}
+		return best, nil
+	}
+
+	base, err := run("ah_bench_noop")
+	if err != nil {
+		return nil, err
+	}
+	current, err := run("ah_check_state")
+	if err != nil {
+		return nil, err
+	}
+	legacy, err := run("ah_check_state_legacy")
+	if err != nil {
+		return nil, err
+	}
+
+	perCall := func(d time.Duration) time.Duration {
+		if d < base {
+			return 0
+		}
+		return (d - base) / time.Duration(iterations)
+	}
+	return &BenchResult{
+		Shell:      s.Name,
+		Iterations: iterations,
+		Current:    perCall(current),
+		Legacy:     perCall(legacy),
+	}, nil
+}
+
+// benchScript sources the env file and calls fn in a loop.
+func (s *Shell) benchScript(root, fn string, iterations int) string {
+	env := filepath.Join(root, s.EnvFile)
+	if s.Name == "fish" {
+		return fmt.Sprintf(`source %q
+%s
+set -l i 0
+while test $i -lt %d
+	%s
+	set i (math $i + 1)
+end
+`, env, legacyFishHook, iterations, fn)
+	}
+	return fmt.Sprintf(`source %q
+%s
+i=0
+while [ $i -lt %d ]; do
+	%s
+	i=$((i + 1))
+done
+`, env, legacyPosixHook, iterations, fn)
+}
@@ -0,0 +1,81 @@
+package shell
+
+import "fmt"
+
+// The state file under the ah root holds a generation counter that ah
+// increments whenever the compiled definitions change. The hooks below read
+// it with the shell's builtin "read", so a prompt where nothing changed
+// costs no fork; only a changed counter re-sources the env file.
+
+// posixEnvScript is env.sh, shared by bash and zsh.
+func posixEnvScript(root string) string {
+	return fmt.Sprintf(`#!/bin/sh
+# Auto-generated by ah
+AH_ROOT="%s"
+AH_COMPILED="$AH_ROOT/aliases.compiled.sh"
+
+# 1. Source Compiled Aliases
+if [ -f "$AH_COMPILED" ]; then
+  source "$AH_COMPILED"
+fi
+
+# Package executables
+case ":$PATH:" in
+  *":$AH_ROOT/bin:"*) ;;
+  *) export PATH="$AH_ROOT/bin:$PATH" ;;
+esac
+
+# Remember the generation just loaded so the first prompt does not reload.
+AH_GENERATION=
+{ read -r AH_GENERATION < "$AH_ROOT/state"; } 2>/dev/null
+
+# 2. Define Live Update Hook (builtins only: no fork unless state changed)
+ah_check_state() {
+	local gen=
+	{ read -r gen < "$AH_ROOT/state"; } 2>/dev/null
+	if [ "$gen" != "$AH_GENERATION" ]; then
+		source "$AH_ROOT/env.sh"
+	fi
+}
+
+# 3. Register Hook
+if [ -n "$ZSH_VERSION" ]; then
+	autoload -Uz add-zsh-hook
+	add-zsh-hook precmd ah_check_state
+elif [ -n "$BASH_VERSION" ]; then
+	if [[ "$PROMPT_COMMAND" != *"ah_check_state"* ]]; then
+		PROMPT_COMMAND="ah_check_state; $PROMPT_COMMAND"
+	fi
+fi
+`, root)
+}
+
+// fishEnvScript is env.fish.
+func fishEnvScript(root string) string {
+	return fmt.Sprintf(`# Auto-generated by ah
+set -gx AH_ROOT "%s"
+
+# 1. Source Compiled Aliases
+if test -f "$AH_ROOT/aliases.compiled.fish"
+	source "$AH_ROOT/aliases.compiled.fish"
+end
+
+# Package executables
+if not contains -- "$AH_ROOT/bin" $PATH
+	set -gx PATH "$AH_ROOT/bin" $PATH
+end
+
+# Remember the generation just loaded so the first prompt does not reload.
+set -g AH_GENERATION ""
+test -f "$AH_ROOT/state"; and read -g AH_GENERATION < "$AH_ROOT/state"
+
+# 2. Define Live Update Hook (runs before every prompt, builtins only)
+function ah_check_state --on-event fish_prompt
+	set -l gen ""
+	test -f "$AH_ROOT/state"; and read gen < "$AH_ROOT/state"
+	if test "$gen" != "$AH_GENERATION"
+		source "$AH_ROOT/env.fish"
+	end
+end
+`, root)
+}
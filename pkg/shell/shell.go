@@ -0,0 +1,319 @@
+// Package shell knows how ah integrates with each supported shell: where
+// its startup files live, how the live-update hook is registered and how
+// the snippet that loads ah is added to and removed from them.
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Markers delimiting the snippet ah adds to startup files.
+const (
+	BeginMarker = "# >>> Alias Hub >>>"
+	EndMarker   = "# <<< Alias Hub <<<"
+)
+
+// Shell describes one supported shell.
+type Shell struct {
+	// Name is the shell's name as used on the command line ("zsh").
+	Name string
+	// EnvFile is the script under the ah root that the snippet sources.
+	EnvFile string
+	// Hook describes how the live-update hook runs before each prompt.
+	Hook string
+	// Dedicated is true if the config file belongs to ah entirely, so it
+	// is created and deleted rather than edited.
+	Dedicated bool
+
+	configFiles func(home string) []string
+	snippet     func(root string) string
+	envScript   func(root string) string
+}
+
+var shells = []*Shell{
+	{
+		Name:        "zsh",
+		EnvFile:     "env.sh",
+		Hook:        "precmd (add-zsh-hook)",
+		configFiles: zshConfigFiles,
+		snippet:     posixSnippet,
+		envScript:   posixEnvScript,
+	},
+	{
+		Name:        "bash",
+		EnvFile:     "env.sh",
+		Hook:        "PROMPT_COMMAND",
+		configFiles: bashConfigFiles,
+		snippet:     posixSnippet,
+		envScript:   posixEnvScript,
+	},
+	{
+		Name:        "fish",
+		EnvFile:     "env.fish",
+		Hook:        "fish_prompt event",
+		Dedicated:   true,
+		configFiles: fishConfigFiles,
+		snippet:     fishSnippet,
+		envScript:   fishEnvScript,
+	},
+}
+
+// All returns every supported shell.
+func All() []*Shell {
+	return shells
+}
+
+// Names returns the names of all supported shells.
+func Names() []string {
+	names := make([]string, len(shells))
+	for i, s := range shells {
+		names[i] = s.Name
+	}
+	return names
+}
+
+// Get returns the shell with the given name.
+func Get(name string) (*Shell, error) {
+	for _, s := range shells {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported shell %q (supported: %s)", name, strings.Join(Names(), ", "))
+}
+
+// Parse resolves a comma-separated list of shell names ("zsh,bash").
+func Parse(list string) ([]*Shell, error) {
+	var out []*Shell
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		s, err := Get(name)
+		if err != nil {
+			return nil, err
+		}
+		seen[name] = true
+		out = append(out, s)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no shell given")
+	}
+	return out, nil
+}
+
+// Detect returns the user's login shell based on $SHELL, defaulting to
+// bash.
+func Detect() *Shell {
+	base := filepath.Base(os.Getenv("SHELL"))
+	for _, s := range shells {
+		if strings.Contains(base, s.Name) {
+			return s
+		}
+	}
+	bash, _ := Get("bash")
+	return bash
+}
+
+// EnvFiles returns the distinct env scripts of all shells, keyed by file
+// name.
+func EnvFiles(root string) map[string]string {
+	files := make(map[string]string)
+	for _, s := range shells {
+		if _, ok := files[s.EnvFile]; !ok {
+			files[s.EnvFile] = s.EnvScript(root)
+		}
+	}
+	return files
+}
+
+// EnvScript returns the contents of the shell's env file for the given ah
+// root.
+func (s *Shell) EnvScript(root string) string {
+	return s.envScript(root)
+}
+
+// ConfigFiles returns every startup file ah may have configured, most
+// preferred first.
+func (s *Shell) ConfigFiles(home string) []string {
+	return s.configFiles(home)
+}
+
+// ConfigFile returns the startup file the snippet is installed into.
+func (s *Shell) ConfigFile(home string) string {
+	files := s.configFiles(home)
+	for _, f := range files {
+		if fileExists(f) {
+			return f
+		}
+	}
+	return files[0]
+}
+
+// Snippet returns the block that loads ah from the given root.
+func (s *Shell) Snippet(root string) string {
+	return s.snippet(root)
+}
+
+// Installed returns the startup file that loads ah, if any.
+func (s *Shell) Installed(home string) (string, bool) {
+	for _, f := range s.configFiles(home) {
+		content, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		if s.Dedicated || strings.Contains(string(content), "AH_PATH") {
+			return f, true
+		}
+	}
+	return "", false
+}
+
+// Install adds the snippet to the shell's startup file. It returns the
+// file and whether the snippet was already there.
+func (s *Shell) Install(home, root string) (string, bool, error) {
+	if f, ok := s.Installed(home); ok {
+		return f, true, nil
+	}
+
+	rcFile := s.ConfigFile(home)
+	if err := os.MkdirAll(filepath.Dir(rcFile), 0755); err != nil {
+		return rcFile, false, err
+	}
+
+	if s.Dedicated {
+		return rcFile, false, os.WriteFile(rcFile, []byte(s.Snippet(root)), 0644)
+	}
+
+	f, err := os.OpenFile(rcFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return rcFile, false, err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString("\n" + s.Snippet(root))
+	return rcFile, false, err
+}
+
+// Remove deletes the snippet from every startup file of the shell and
+// returns the files that were changed.
+func (s *Shell) Remove(home string) ([]string, error) {
+	var cleaned []string
+	for _, rcFile := range s.configFiles(home) {
+		if s.Dedicated {
+			if !fileExists(rcFile) {
+				continue
+			}
+			if err := os.Remove(rcFile); err != nil {
+				return cleaned, err
+			}
+			cleaned = append(cleaned, rcFile)
+			continue
+		}
+
+		content, err := os.ReadFile(rcFile)
+		if err != nil {
+			continue
+		}
+		newContent, changed := removeSnippet(string(content))
+		if !changed {
+			continue
+		}
+		if err := os.WriteFile(rcFile, []byte(newContent), 0644); err != nil {
+			return cleaned, err
+		}
+		cleaned = append(cleaned, rcFile)
+	}
+	return cleaned, nil
+}
+
+// removeSnippet strips ah's block (and the marker-less block written by
+// older versions) from a startup file.
+func removeSnippet(content string) (string, bool) {
+	lines := strings.Split(content, "\n")
+	var newLines []string
+	inBlock := false
+
+	for _, line := range lines {
+		// Check for block start marker (new style)
+		if strings.Contains(line, BeginMarker) {
+			inBlock = true
+			continue
+		}
+		// Check for block end marker (new style)
+		if strings.Contains(line, EndMarker) {
+			inBlock = false
+			continue
+		}
+		// Legacy support: old style marker
+		if strings.Contains(line, "# Alias Hub") && !inBlock {
+			// Start of legacy block - skip until we find a non-matching line
+			inBlock = true
+			continue
+		}
+		if inBlock {
+			// For legacy blocks, exit when we hit a line that's not part of our config
+			if !strings.Contains(line, "AH_PATH") && !strings.Contains(line, "env.sh") && strings.TrimSpace(line) != "" {
+				inBlock = false
+				newLines = append(newLines, line)
+			}
+			continue
+		}
+		newLines = append(newLines, line)
+	}
+
+	return strings.Join(newLines, "\n"), len(lines) != len(newLines)
+}
+
+func zshConfigFiles(home string) []string {
+	var files []string
+	if zdotdir := os.Getenv("ZDOTDIR"); zdotdir != "" && zdotdir != home {
+		files = append(files, filepath.Join(zdotdir, ".zshrc"))
+	}
+	return append(files, filepath.Join(home, ".zshrc"))
+}
+
+func bashConfigFiles(home string) []string {
+	bashrc := filepath.Join(home, ".bashrc")
+	profile := filepath.Join(home, ".bash_profile")
+	// macOS terminals start login shells, which read .bash_profile only.
+	if runtime.GOOS == "darwin" {
+		return []string{profile, bashrc}
+	}
+	return []string{bashrc, profile}
+}
+
+func fishConfigFiles(home string) []string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = filepath.Join(home, ".config")
+	}
+	return []string{filepath.Join(configHome, "fish", "conf.d", "ah.fish")}
+}
+
+func posixSnippet(root string) string {
+	return fmt.Sprintf(`%s
+export AH_PATH="%s"
+[ -f "$AH_PATH/env.sh" ] && source "$AH_PATH/env.sh"
+%s
+`, BeginMarker, root, EndMarker)
+}
+
+func fishSnippet(root string) string {
+	return fmt.Sprintf(`%s
+set -gx AH_PATH "%s"
+test -f "$AH_PATH/env.fish"; and source "$AH_PATH/env.fish"
+%s
+`, BeginMarker, root, EndMarker)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
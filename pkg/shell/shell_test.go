@@ -0,0 +1,139 @@
+package shell
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	shells, err := Parse("zsh, bash,zsh")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(shells) != 2 || shells[0].Name != "zsh" || shells[1].Name != "bash" {
+		t.Errorf("unexpected shells: %v", shells)
+	}
+
+	if _, err := Parse("zsh,tcsh"); err == nil || !strings.Contains(err.Error(), "tcsh") {
+		t.Errorf("expected unsupported shell error, got %v", err)
+	}
+	if _, err := Parse(" , "); err == nil {
+		t.Error("expected error for empty list")
+	}
+}
+
+func TestDetect(t *testing.T) {
+	t.Setenv("SHELL", "/usr/local/bin/fish")
+	if got := Detect().Name; got != "fish" {
+		t.Errorf("Detect() = %s, want fish", got)
+	}
+	t.Setenv("SHELL", "")
+	if got := Detect().Name; got != "bash" {
+		t.Errorf("Detect() = %s, want bash", got)
+	}
+}
+
+func TestInstallRemove_Bash(t *testing.T) {
+	home := t.TempDir()
+	bash, _ := Get("bash")
+	rcFile := bash.ConfigFile(home)
+	os.WriteFile(rcFile, []byte("export EDITOR=vim\n"), 0644)
+
+	file, already, err := bash.Install(home, "/home/u/.ah")
+	if err != nil || already || file != rcFile {
+		t.Fatalf("Install() = %s, %v, %v", file, already, err)
+	}
+	if _, already, _ := bash.Install(home, "/home/u/.ah"); !already {
+		t.Error("second Install should report already configured")
+	}
+	if f, ok := bash.Installed(home); !ok || f != rcFile {
+		t.Errorf("Installed() = %s, %v", f, ok)
+	}
+
+	cleaned, err := bash.Remove(home)
+	if err != nil || len(cleaned) != 1 {
+		t.Fatalf("Remove() = %v, %v", cleaned, err)
+	}
+	content, _ := os.ReadFile(rcFile)
+	if strings.Contains(string(content), "AH_PATH") || !strings.Contains(string(content), "EDITOR=vim") {
+		t.Errorf("unexpected content after Remove:\n%s", content)
+	}
+}
+
+func TestInstallRemove_Fish(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", "")
+	fish, _ := Get("fish")
+
+	file, _, err := fish.Install(home, "/home/u/.ah")
+	if err != nil {
+		t.Fatalf("Install failed: %v", err)
+	}
+	if want := filepath.Join(home, ".config", "fish", "conf.d", "ah.fish"); file != want {
+		t.Errorf("Install() wrote %s, want %s", file, want)
+	}
+	if _, err := fish.Remove(home); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if fileExists(file) {
+		t.Error("dedicated fish config should be deleted")
+	}
+}
+
+func TestZshConfigFiles_ZDOTDIR(t *testing.T) {
+	home := t.TempDir()
+	zdotdir := filepath.Join(home, ".config", "zsh")
+	t.Setenv("ZDOTDIR", zdotdir)
+	zsh, _ := Get("zsh")
+
+	file, _, err := zsh.Install(home, "/home/u/.ah")
+	if err != nil {
+		t.Fatalf("Install failed: %v", err)
+	}
+	if want := filepath.Join(zdotdir, ".zshrc"); file != want {
+		t.Errorf("Install() wrote %s, want %s", file, want)
+	}
+
+	// A snippet left in ~/.zshrc is still found and removed.
+	legacy := filepath.Join(home, ".zshrc")
+	os.WriteFile(legacy, []byte("# Alias Hub\nexport AH_PATH=\"/x\"\n[ -f \"$AH_PATH/env.sh\" ] && source \"$AH_PATH/env.sh\"\nalias ll='ls -l'\n"), 0644)
+	cleaned, err := zsh.Remove(home)
+	if err != nil || len(cleaned) != 2 {
+		t.Fatalf("Remove() = %v, %v", cleaned, err)
+	}
+	content, _ := os.ReadFile(legacy)
+	if string(content) != "alias ll='ls -l'\n" {
+		t.Errorf("legacy block not removed:\n%s", content)
+	}
+}
+
+func TestPosixHook_ReloadsOnGenerationChange(t *testing.T) {
+	bash, _ := Get("bash")
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "env.sh"), []byte(bash.EnvScript(root)), 0644)
+	os.WriteFile(filepath.Join(root, "state"), []byte("1\n"), 0644)
+
+	// Count how often env.sh is sourced: once at startup, then only when
+	// the generation changes.
+	script := `ah_loads=0
+source "$1/env.sh"
+source() { ah_loads=$((ah_loads + 1)); builtin source "$@"; }
+ah_check_state; ah_check_state
+echo 2 > "$1/state"
+ah_check_state; ah_check_state
+echo "$ah_loads $AH_GENERATION"
+`
+	out, err := exec.Command("bash", "-c", script, "bash", root).CombinedOutput()
+	if err != nil {
+		t.Fatalf("bash failed: %v: %s", err, out)
+	}
+	if got := strings.TrimSpace(string(out)); got != "1 2" {
+		t.Errorf("got %q, want %q (one reload, generation 2)", got, "1 2")
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/sarkartanmay393/ah/pkg/semver"
 	"github.com/sarkartanmay393/ah/pkg/version"
 )
 
@@ -62,39 +63,19 @@ func CheckForUpdates() (string, error) {
 	return "", nil
 }
 
-// isNewerVersion compares two semver strings and returns true if latest > current
+// isNewerVersion reports whether latest is a higher semantic version than
+// current. Versions that cannot be parsed (such as "dev" builds) are never
+// newer, nor older: no update is offered.
 func isNewerVersion(latest, current string) bool {
-	latestParts := strings.Split(latest, ".")
-	currentParts := strings.Split(current, ".")
-
-	// Pad to ensure same length
-	for len(latestParts) < 3 {
-		latestParts = append(latestParts, "0")
-	}
-	for len(currentParts) < 3 {
-		currentParts = append(currentParts, "0")
+	l, err := semver.ParseLoose(latest)
+	if err != nil {
+		return false
 	}
-
-	for i := 0; i < 3; i++ {
-		l := parseVersionPart(latestParts[i])
-		c := parseVersionPart(currentParts[i])
-		if l > c {
-			return true
-		}
-		if l < c {
-			return false
-		}
+	c, err := semver.ParseLoose(current)
+	if err != nil {
+		return false
 	}
-	return false // Equal
-}
-
-// parseVersionPart extracts the numeric part of a version segment
-func parseVersionPart(s string) int {
-	// Handle pre-release suffixes like "1-beta"
-	s = strings.Split(s, "-")[0]
-	var n int
-	fmt.Sscanf(s, "%d", &n)
-	return n
+	return c.Less(l)
 }
 
 // SelfUpdate downloads and installs the latest version
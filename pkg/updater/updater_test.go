@@ -22,6 +22,13 @@ func TestIsNewerVersion(t *testing.T) {
 		{"short version", "1.1", "1.0.5", true},
 		{"very short version", "2", "1.9.9", true},
 		{"pre-release tag", "1.0.1-beta", "1.0.0", true},
+		{"release after pre-release", "1.0.0", "1.0.0-rc1", true},
+		{"pre-release before release", "1.0.0-rc1", "1.0.0", false},
+		{"pre-release order", "1.0.0-rc.10", "1.0.0-rc.9", true},
+		{"v prefix", "v1.2.0", "1.1.0", true},
+		{"invalid latest", "latest", "1.0.0", false},
+		{"dev build", "1.0.0", "dev", false},
+		{"trailing garbage", "2.0.0abc", "1.0.0", false},
 	}
 
 	for _, tt := range tests {
@@ -34,29 +41,3 @@ func TestIsNewerVersion(t *testing.T) {
 		})
 	}
 }
-
-func TestParseVersionPart(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected int
-	}{
-		{"0", 0},
-		{"1", 1},
-		{"10", 10},
-		{"123", 123},
-		{"5-beta", 5},
-		{"3-rc1", 3},
-		{"", 0},
-		{"abc", 0},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.input, func(t *testing.T) {
-			result := parseVersionPart(tt.input)
-			if result != tt.expected {
-				t.Errorf("parseVersionPart(%q) = %d, want %d",
-					tt.input, result, tt.expected)
-			}
-		})
-	}
-}